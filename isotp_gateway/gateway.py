@@ -13,6 +13,7 @@ Options:
 
 """
 from docopt import docopt
+import json
 import threading
 import time
 import isotp
@@ -25,9 +26,15 @@ class ThreadedSocket(object):
         self.url = url
         self.rxid = rxid
         self.txid = txid
+        # responses and events share the socket, sends are serialized
+        self.lock = threading.Lock()
+        self.s = self.socket()
         self.thread = threading.Thread(target=self.run, args=())
         self.thread.daemon = True
         self.thread.start()
+        self.events = threading.Thread(target=self.forward_events, args=())
+        self.events.daemon = True
+        self.events.start()
     
     def socket(self):
         s = isotp.socket()
@@ -35,28 +42,52 @@ class ThreadedSocket(object):
         s.bind("vcan0", isotp.Address(rxid=self.rxid, txid=self.txid))
         return s
 
+    def send(self, x):
+        with self.lock:
+            self.s.send(bytes.fromhex(x['sid']) + bytes.fromhex(x['data']))
+
     def run(self):
-        s = self.socket()
         while True:
             try:
-                data = s.recv()
+                data = self.s.recv()
             except OSError:
                 # I'm not sure why we have to do this, but if there is not recv() on the other end of the socket
                 # the next recv will throw an OSError. Looks like this is something known.
                 # https://www.spinics.net/lists/linux-can/msg07419.html
                 print('exception was thrown from the socket. have recv ready prior to send.')
-                s.close()
-                s = self.socket()
+                with self.lock:
+                    self.s.close()
+                    self.s = self.socket()
                 continue
             if data:
                 sid = "{:x}".format(int(data[0]))
                 o = {'sid': sid, 'data': data[1:].hex()}
-                r = requests.post('{0}/uds/{1}'.format(self.url, int_to_hex_formatted_string(self.rxid)), json=o)
-                x = r.json()
-                s.send(bytes.fromhex(x['sid']) + bytes.fromhex(x['data']))
+                r = requests.post('{0}/uds/{1}'.format(self.url, int_to_hex_formatted_string(self.rxid)), json=o,
+                                  stream=True)
+                if r.status_code == 204:
+                    # positive response suppressed, nothing to send back
+                    continue
+                # a busy node streams responsePending messages before the final response, one per line
+                for line in r.iter_lines():
+                    if line:
+                        self.send(json.loads(line))
             else:
                 time.sleep(0.2)
 
+    def forward_events(self):
+        # ResponseOnEvent messages are streamed by the node, one per line, for as long as the connection lasts
+        while True:
+            try:
+                r = requests.get('{0}/events/{1}'.format(self.url, int_to_hex_formatted_string(self.rxid)),
+                                 stream=True)
+                for line in r.iter_lines():
+                    if line:
+                        self.send(json.loads(line))
+            except (requests.exceptions.RequestException, OSError):
+                pass
+            # the node went away or was restarted, subscribe again
+            time.sleep(1)
+
 
 def int_to_hex_formatted_string(i):
     return '{0:#0{1}x}'.format(i, 4)
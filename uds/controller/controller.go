@@ -12,6 +12,7 @@ import (
 
 	"github.com/atredispartners/uds-zoo/uds/node"
 	"github.com/atredispartners/uds-zoo/uds/store"
+	"github.com/atredispartners/uds-zoo/uds/uds"
 	"github.com/gin-gonic/gin"
 	"github.com/tidwall/buntdb"
 )
@@ -82,64 +83,169 @@ func (app *App) routeUDS(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := app.DB.View(func(tx *buntdb.Tx) error {
+	instance, err := app.instance(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// the node may take a while to answer, the lookup must not hold the
+	// transaction open meanwhile
+	if err := proxyUDS(c, instance, udsReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
 
-		val, err := tx.Get(fmt.Sprintf("%s:instance", c.Param("id")))
+// proxyUDS sends udsReq to the node of instance and copies its response.
+func proxyUDS(c *gin.Context, instance store.InstanceRecord, udsReq node.UDSHTTPRequestResponse) error {
+	httpc, httpURL, err := nodeClient(instance)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(udsReq)
+	if err != nil {
+		return err
+	}
+	nodeReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/uds", httpURL), bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	nodeReq.Header.Set("Content-Type", "application/json")
+	nodeReq.Header.Set(node.ClientHeader, clientID(c))
+	res, err := httpc.Do(nodeReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNoContent {
+		// the node suppressed its positive response
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+	if res.StatusCode != http.StatusOK {
+		errorText := new(strings.Builder)
+		io.Copy(errorText, res.Body)
+		return fmt.Errorf("%s", errorText)
+	}
+	// responsePending messages are streamed as they arrive
+	c.Header("Content-Type", res.Header.Get("Content-Type"))
+	copyFlush(c.Writer, res.Body)
+	return nil
+}
+
+// routeEvents streams the messages a node sends for ResponseOnEvent events,
+// for as long as the client stays connected.
+func (app *App) routeEvents(c *gin.Context) {
+	// the stream outlives the lookup, it must not hold the transaction open
+	instance, err := app.instance(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	httpc, httpURL, err := nodeClient(instance)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	nodeReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/events", httpURL), nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	nodeReq = nodeReq.WithContext(c.Request.Context())
+	nodeReq.Header.Set(node.ClientHeader, clientID(c))
+	res, err := httpc.Do(nodeReq)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		errorText := new(strings.Builder)
+		io.Copy(errorText, res.Body)
+		c.JSON(http.StatusBadRequest, gin.H{"error": errorText.String()})
+		return
+	}
+	c.Header("Content-Type", res.Header.Get("Content-Type"))
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	copyFlush(c.Writer, res.Body)
+}
+
+// instance looks up the record of the instance registered as id.
+func (app *App) instance(id string) (store.InstanceRecord, error) {
+	var instance store.InstanceRecord
+	err := app.DB.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(fmt.Sprintf("%s:instance", id))
 		if err != nil {
 			return err
 		}
-		var instance store.InstanceRecord
-		if err := json.Unmarshal([]byte(val), &instance); err != nil {
-			return err
-		}
+		return json.Unmarshal([]byte(val), &instance)
+	})
+	return instance, err
+}
 
-		addrParts := strings.SplitN(instance.Addr, ":", 2)
-		if len(addrParts) != 2 {
-			return fmt.Errorf("finding network for instance")
-		}
-		network := addrParts[0]
-		addr := addrParts[1]
-
-		var (
-			httpc   *http.Client
-			httpURL string
-		)
-		switch network {
-		case "unix":
-			httpc = &http.Client{
-				Transport: &http.Transport{
-					DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-						return net.Dial("unix", addr)
-					},
+// nodeClient returns a client connecting to the listener of instance and the
+// base URL of its routes.
+func nodeClient(instance store.InstanceRecord) (*http.Client, string, error) {
+	addrParts := strings.SplitN(instance.Addr, ":", 2)
+	if len(addrParts) != 2 {
+		return nil, "", fmt.Errorf("finding network for instance")
+	}
+	network := addrParts[0]
+	addr := addrParts[1]
+	switch network {
+	case "unix":
+		return &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return net.Dial("unix", addr)
 				},
+			},
+		}, "http://unix", nil
+	case "tcp":
+		return http.DefaultClient, addr, nil
+	default:
+		return nil, "", fmt.Errorf("unknown network type %s", network)
+	}
+}
+
+// copyFlush copies src to w, flushing after every read.
+func copyFlush(w gin.ResponseWriter, src io.Reader) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
 			}
-			httpURL = "http://unix"
-		case "tcp":
-			httpc = http.DefaultClient
-			httpURL = addr
-		default:
-			return fmt.Errorf("unknown network type %s", network)
+			w.Flush()
 		}
-		data, err := json.Marshal(udsReq)
-		if err != nil {
-			return err
+		if err == io.EOF {
+			return nil
 		}
-		res, err := httpc.Post(fmt.Sprintf("%s/uds", httpURL), "application/json", bytes.NewBuffer(data))
 		if err != nil {
 			return err
 		}
-		if res.StatusCode != http.StatusOK {
-			errorText := new(strings.Builder)
-			io.Copy(errorText, res.Body)
-			return fmt.Errorf("%s", errorText)
-		}
-		c.Header("Content-Type", "application/json")
-		io.Copy(c.Writer, res.Body)
-		return nil
-	}); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	}
+}
+
+// clientID identifies the client of a request, a client may name itself
+// using the X-UDS-Client header and is otherwise known by its IP.
+func clientID(c *gin.Context) string {
+	if client := c.GetHeader(node.ClientHeader); client != "" {
+		return client
+	}
+	return c.ClientIP()
+}
 
+// getNRCs returns the name of every negative response code keyed by its hex
+// value, so clients don't have to keep their own copy of the list.
+func (app *App) getNRCs(c *gin.Context) {
+	nrcs := make(map[string]string, len(uds.ResponseCodes))
+	for code, name := range uds.ResponseCodes {
+		nrcs[fmt.Sprintf("%02x", byte(code))] = name
+	}
+	c.JSON(http.StatusOK, nrcs)
 }
 
 func (app *App) Start(addr string) {
@@ -161,6 +267,8 @@ func New(opts *Opts) *App {
 	r.GET("/instances", app.getInstances)
 	r.GET("/instances/:id", app.getInstance)
 	r.POST("/uds/:id", app.routeUDS)
+	r.GET("/events/:id", app.routeEvents)
+	r.GET("/nrc", app.getNRCs)
 	//hacky way to serve from '/'
 	r.NoRoute(func(c *gin.Context) {
 		c.Redirect(http.StatusMovedPermanently, "/client/index.html")
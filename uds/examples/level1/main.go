@@ -45,7 +45,8 @@ func main() {
 				"An example request for 0x1234:\n 22 1234\n" +
 				"An example positive server response:\n 62 1234ABCDEF\n",
 		},
-		Service: poc,
+		Service:         poc,
+		S3ServerTimeout: node.NoS3Timeout,
 	})
 	if err != nil {
 		panic(err)
@@ -9,35 +9,29 @@ import (
 
 type VulnPoc struct {
 	node.Service
-	DiagnosticStatus int
-	Flag             []byte
-	Memory           []byte
+	Flag   []byte
+	Memory []byte
 }
 
 func (v *VulnPoc) DiagnosticSessionControl(payload []byte) []byte {
 	if bytes.Equal(payload, []byte{0x2}) {
-		v.DiagnosticStatus = 2
 		return []byte{0x50, 0x02}
 	}
-	return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SNS}
+	return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SNS).Bytes()
 }
 
 func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 	// check that the correct Identifier has been requested
+	// the session is checked by the access policy set in main
 	if bytes.Equal(payload, []byte{0x13, 0x37}) {
-		if v.DiagnosticStatus != 2 {
-			// if the sessions is not in diagnostic mode 2, service not supported in active session
-			return []byte{uds.NR, uds.ReadDataByIdentifier, uds.SNSIAS}
-		}
 		return append([]byte{byte(uds.ReadDataByIdentifier + 0x40)}, v.Flag...)
 	}
-	return []byte{uds.NR, uds.ReadDataByIdentifier, uds.CNC}
+	return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.CNC).Bytes()
 }
 
 func main() {
 	poc := &VulnPoc{Service: &node.DefaultService{}}
 	poc.Flag = []byte("d1agn0s1ng-y0ur-sess10n")
-	poc.DiagnosticStatus = 0x1
 	//node.DONTREGISTERINSTANCE = true // Remove to register with the node.
 	x, err := node.NewInstance(&node.InstanceConfig{
 		ControllerURL: "http://localhost:8888",
@@ -51,7 +45,17 @@ func main() {
 				"An example request for a programming session (0x02):\n 10 02\n" +
 				"An example positive server response:\n 50 02\n",
 		},
-		Service: poc,
+		Service:         poc,
+		S3ServerTimeout: node.NoS3Timeout,
+		AccessPolicy: node.AccessPolicy{
+			// if the session is not the programming session 0x02, service not supported in active session
+			{
+				SID:             uds.ReadDataByIdentifier,
+				DataIdentifiers: []uint16{0x1337},
+				Sessions:        []byte{uds.ProgrammingSession},
+				NRC:             uds.SNSIAS,
+			},
+		},
 	})
 	if err != nil {
 		panic(err)
@@ -9,11 +9,9 @@ import (
 
 type VulnPoc struct {
 	node.Service
-	DiagnosticStatus    int
-	SecurityAccessLevel int
-	SeedSent            int
-	Flag                []byte
-	Memory              []byte
+	SeedSent int
+	Flag     []byte
+	Memory   []byte
 }
 
 func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
@@ -28,54 +26,51 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 	if payload[0] == byte(0x2) {
 		// check a seed was requested first
 		if v.SeedSent == 0x0 {
-			return []byte{uds.NR, uds.SecurityAccess, uds.RSE}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.RSE).Bytes()
 		}
 		// check the auth attempt
 		password := []byte{0x1, 0x2, 0x3, 0x4}
 		if bytes.Equal(payload[1:], password) {
-			// set the access level and return positive response
-			v.SecurityAccessLevel = 0x2
+			// return positive response, the node unlocks security level 0x01
 			return []byte{byte(uds.SecurityAccess + 0x40), payload[0]}
 		} else {
 			// auth attempt failed, negative response for invalid key
-			return []byte{uds.NR, uds.SecurityAccess, uds.IK}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.IK).Bytes()
 		}
 	}
 	// default return an error
-	return []byte{uds.NR, uds.SecurityAccess, uds.SAD}
+	return uds.NewNegativeResponse(uds.SecurityAccess, uds.SAD).Bytes()
 }
 
 func (v *VulnPoc) DiagnosticSessionControl(payload []byte) []byte {
-	// check if we have proper security access level
-	if v.SecurityAccessLevel != 0x2 {
-		return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SAD}
-	}
+	// the security access level is checked by the access policy set in main
 	if bytes.Equal(payload, []byte{0x2}) {
-		v.DiagnosticStatus = 2
-		return []byte{uds.DiagnosticSessionControl + 0x40, 0x02}
+		return []byte{byte(uds.DiagnosticSessionControl + 0x40), 0x02}
 	}
-	return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SFNS}
+	return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 	// check that the correct Identifier has been requested
 	if bytes.Equal(payload, []byte{0x13, 0x37}) {
-		if v.DiagnosticStatus != 2 {
-			// if the sessions is not in diagnostic mode 2, spec states conditions not correct is valid error
-			return []byte{uds.NR, uds.ReadDataByIdentifier, uds.CNC}
-		}
 		return append([]byte{byte(uds.ReadDataByIdentifier + 0x40)}, v.Flag...)
 	}
 	// otherwise request out of range
-	return []byte{uds.NR, uds.ReadDataByIdentifier, uds.ROOR}
+	return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.ROOR).Bytes()
 }
 
 func main() {
 	poc := &VulnPoc{Service: &node.DefaultService{}}
 	poc.Flag = []byte("babbysfirstunlock")
-	poc.DiagnosticStatus = 0x1
-	poc.SecurityAccessLevel = 0x0
 	poc.SeedSent = 0x0
+	// sessions can only be changed once unlocked, requesting the programming
+	// session again keeps security access unlocked like it always did here
+	session := node.NewSessionManager()
+	session.Hooks.OnSessionChange = func(s *node.SessionManager, from byte, to byte) {
+		if from == to {
+			s.Unlock(0x01)
+		}
+	}
 	//node.DONTREGISTERINSTANCE = true // Remove to register with the node.
 	x, err := node.NewInstance(&node.InstanceConfig{
 		ControllerURL: "http://localhost:8888",
@@ -90,7 +85,23 @@ func main() {
 				"Request seed 0x01: 27 01\n" +
 				"Submit computed key: 27 02 6C65746D65696E",
 		},
-		Service: poc,
+		Service:         poc,
+		Session:         session,
+		S3ServerTimeout: node.NoS3Timeout,
+		AccessPolicy: node.AccessPolicy{
+			// sessions can only be changed after unlocking security access 0x01
+			{
+				SID:           uds.DiagnosticSessionControl,
+				SecurityLevel: 0x01,
+			},
+			// if the session is not the programming session 0x02, spec states conditions not correct is valid error
+			{
+				SID:             uds.ReadDataByIdentifier,
+				DataIdentifiers: []uint16{0x1337},
+				Sessions:        []byte{uds.ProgrammingSession},
+				NRC:             uds.CNC,
+			},
+		},
 	})
 	if err != nil {
 		panic(err)
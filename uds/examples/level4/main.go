@@ -30,44 +30,44 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 	if payload[0] == byte(0x2) {
 		// check a seed was requested first
 		if v.SeedSent == 0x0 {
-			return []byte{uds.NR, uds.SecurityAccess, uds.RSE}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.RSE).Bytes()
 		}
 		// streets closed, find another way home pizza boy
-		return []byte{uds.NR, uds.SecurityAccess, uds.IK}
+		return uds.NewNegativeResponse(uds.SecurityAccess, uds.IK).Bytes()
 	}
 	// default return an error
-	return []byte{uds.NR, uds.SecurityAccess, uds.SAD}
+	return uds.NewNegativeResponse(uds.SecurityAccess, uds.SAD).Bytes()
 }
 
 func (v *VulnPoc) DiagnosticSessionControl(payload []byte) []byte {
 	// check if we have proper security access level
 	if v.SecurityAccessLevel != 0x2 {
-		return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SAD}
+		return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SAD).Bytes()
 	}
 	if bytes.Equal(payload, []byte{0x2}) {
 		v.DiagnosticStatus = 2
-		return []byte{uds.DiagnosticSessionControl + 0x40, 0x02}
+		return []byte{byte(uds.DiagnosticSessionControl + 0x40), 0x02}
 	}
-	return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SFNS}
+	return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 	//check that the total payload len fits the dataIdentifier size
 	if len(payload)%2 != 0 {
 		//invalid data identifier size
-		return []byte{uds.NR, uds.ReadDataByIdentifier, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.IMLOIF).Bytes()
 	}
 
 	// check if the client is attempting to read our protected flag
 	if bytes.Equal(payload, []byte{0x13, 0x37}) {
 		if v.DiagnosticStatus != 2 {
 			// if the sessions is not in diagnostic mode 2, spec states conditions not correct is valid error
-			return []byte{uds.NR, uds.ReadDataByIdentifier, uds.CNC}
+			return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.CNC).Bytes()
 		}
 	}
 
 	// set positive response sid
-	var response = []byte{uds.ReadDataByIdentifier + 0x40}
+	var response = []byte{byte(uds.ReadDataByIdentifier + 0x40)}
 	var dataIdentifier []byte
 	for len(payload) != 0 {
 		// grab the first identifier from the payload
@@ -95,7 +95,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 		return response
 	}
 	// otherwise request out of range
-	return []byte{uds.NR, uds.ReadDataByIdentifier, uds.ROOR}
+	return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.ROOR).Bytes()
 }
 
 func main() {
@@ -120,7 +120,8 @@ The bug in this level is that the ReadDataByIdentifier spec allows multiple Data
 The check for DiagnosticSession only checks the first submitted DataIdentifier for the flag DataIdentifier before entering the process loop, allowing the attacker to submit an open value (VIN 0xf190) followed by the flag (0x1337).
 `,
 		},
-		Service: poc,
+		Service:         poc,
+		S3ServerTimeout: node.NoS3Timeout,
 	})
 	if err != nil {
 		panic(err)
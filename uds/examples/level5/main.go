@@ -25,7 +25,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 
 	//check to see if we are locked out due to bad attempts
 	if v.AuthAttempts >= 3 {
-		return []byte{uds.NR, uds.SecurityAccess, uds.ENOA}
+		return uds.NewNegativeResponse(uds.SecurityAccess, uds.ENOA).Bytes()
 	}
 	// handle seed request 0x1
 	if bytes.Equal(payload, []byte{0x1}) {
@@ -38,7 +38,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 	if payload[0] == byte(0x2) {
 		// check a seed was requested first
 		if v.SeedSent == 0x0 {
-			return []byte{uds.NR, uds.SecurityAccess, uds.RSE}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.RSE).Bytes()
 		}
 		// check the auth attempt
 		password := [][]byte{
@@ -59,29 +59,29 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 		} else {
 			// auth attempt failed, increment the attempt counter and negative response for invalid key
 			v.AuthAttempts += 1
-			return []byte{uds.NR, uds.SecurityAccess, uds.IK}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.IK).Bytes()
 		}
 	}
 	// default return an error
-	return []byte{uds.NR, uds.SecurityAccess, uds.SAD}
+	return uds.NewNegativeResponse(uds.SecurityAccess, uds.SAD).Bytes()
 }
 
 func (v *VulnPoc) DiagnosticSessionControl(payload []byte) []byte {
 	// check if we have proper security access level
 	if v.SecurityAccessLevel != 0x2 {
-		return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SAD}
+		return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SAD).Bytes()
 	}
 	if bytes.Equal(payload, []byte{0x2}) {
 		v.DiagnosticStatus = 2
-		return []byte{uds.DiagnosticSessionControl + 0x40, 0x02}
+		return []byte{byte(uds.DiagnosticSessionControl + 0x40), 0x02}
 	}
-	return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SFNS}
+	return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ECUReset(payload []byte) []byte {
 
 	if len(payload) != 1 {
-		return []byte{uds.NR, uds.ECUReset, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ECUReset, uds.IMLOIF).Bytes()
 	}
 
 	// if reset subfunction is hardReset(0x1) or keyOffOnReset(0x2)
@@ -92,21 +92,21 @@ func (v *VulnPoc) ECUReset(payload []byte) []byte {
 		v.SeedSent = 0x0
 		v.AuthAttempts = 0x0
 		v.VIN = []byte("atredispartners1337")
-		return []byte{uds.ECUReset + 0x40, payload[0]}
+		return []byte{byte(uds.ECUReset + 0x40), payload[0]}
 
 	}
-	return []byte{uds.NR, uds.ECUReset, uds.SFNS}
+	return uds.NewNegativeResponse(uds.ECUReset, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 	//check that the total payload len fits the dataIdentifier size
 	if len(payload)%2 != 0 {
 		//invalid data identifier size
-		return []byte{uds.NR, uds.ReadDataByIdentifier, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.IMLOIF).Bytes()
 	}
 
 	// set positive response sid
-	var response = []byte{uds.ReadDataByIdentifier + 0x40}
+	var response = []byte{byte(uds.ReadDataByIdentifier + 0x40)}
 	var dataIdentifier []byte
 	for len(payload) != 0 {
 		// grab the first identifier from the payload
@@ -125,7 +125,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 			// SECURITY FIX.
 			if v.DiagnosticStatus != 2 {
 				// if the sessions is not in diagnostic mode 2, spec states conditions not correct is valid error
-				return []byte{uds.NR, uds.ReadDataByIdentifier, uds.CNC}
+				return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.CNC).Bytes()
 			}
 			//add the dataIdentifier to the response
 			response = append(response, dataIdentifier...)
@@ -139,7 +139,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 		return response
 	}
 	// otherwise request out of range
-	return []byte{uds.NR, uds.ReadDataByIdentifier, uds.ROOR}
+	return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.ROOR).Bytes()
 }
 
 func main() {
@@ -175,7 +175,8 @@ After 3 bad attempts the server will lock, preventing further guesses. The user
 an EcuReset (0x11) and continue guessing until they receive a positive response. Unlock again allows the user to access
 DiagnosticSession 0x02 and ReadDataIdentifier the flag 0x1337.`,
 		},
-		Service: poc,
+		Service:         poc,
+		S3ServerTimeout: node.NoS3Timeout,
 	})
 	if err != nil {
 		panic(err)
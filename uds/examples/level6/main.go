@@ -36,7 +36,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 
 	//check to see if we are locked out due to bad attempts
 	if v.Memory[AUTH_ATTEMPTS] >= 3 {
-		return []byte{uds.NR, uds.SecurityAccess, uds.ENOA}
+		return uds.NewNegativeResponse(uds.SecurityAccess, uds.ENOA).Bytes()
 	}
 	// handle seed request 0x1
 	if bytes.Equal(payload, []byte{0x1}) {
@@ -56,7 +56,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 	if payload[0] == byte(0x2) {
 		// check a seed was requested first
 		if v.Memory[SEED_SENT] == 0x0 {
-			return []byte{uds.NR, uds.SecurityAccess, uds.RSE}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.RSE).Bytes()
 		}
 		// check the auth attempt
 		// key == XorBytes(seed,xorkey)
@@ -70,29 +70,29 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 		} else {
 			// auth attempt failed, increment the attempt counter and negative response for invalid key
 			v.AuthAttempts += 1
-			return []byte{uds.NR, uds.SecurityAccess, uds.IK}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.IK).Bytes()
 		}
 	}
 	// default return an error
-	return []byte{uds.NR, uds.SecurityAccess, uds.SAD}
+	return uds.NewNegativeResponse(uds.SecurityAccess, uds.SAD).Bytes()
 }
 
 func (v *VulnPoc) DiagnosticSessionControl(payload []byte) []byte {
 	// check if we have proper security access level
 	if v.SecurityAccessLevel != 0x2 {
-		return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SAD}
+		return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SAD).Bytes()
 	}
 	if bytes.Equal(payload, []byte{0x2}) {
 		v.DiagnosticStatus = 2
-		return []byte{uds.DiagnosticSessionControl + 0x40, 0x02}
+		return []byte{byte(uds.DiagnosticSessionControl + 0x40), 0x02}
 	}
-	return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SFNS}
+	return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ECUReset(payload []byte) []byte {
 
 	if len(payload) != 1 {
-		return []byte{uds.NR, uds.ECUReset, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ECUReset, uds.IMLOIF).Bytes()
 	}
 
 	// if reset subfunction is hardReset(0x1) or keyOffOnReset(0x2)
@@ -104,10 +104,10 @@ func (v *VulnPoc) ECUReset(payload []byte) []byte {
 		v.Memory[AUTH_ATTEMPTS] = 0x0
 		// retain our auth attempts to fix lockout bypass
 		//v.AuthAttempts = 0x0
-		return []byte{uds.ECUReset + 0x40, payload[0]}
+		return []byte{byte(uds.ECUReset + 0x40), payload[0]}
 
 	}
-	return []byte{uds.NR, uds.ECUReset, uds.SFNS}
+	return uds.NewNegativeResponse(uds.ECUReset, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ReadMemoryByAddress(payload []byte) []byte {
@@ -120,27 +120,15 @@ func (v *VulnPoc) ReadMemoryByAddress(payload []byte) []byte {
 		                       addressSizeLength = addressAndLengthFormatIdentifier & 0xf
 
 	*/
-	addressFormat := payload[0]
-	addressLength := int(addressFormat & 0xf)
-	sizeLength := int(addressFormat&0xf0) >> 4
-	if sizeLength == 0 || addressLength == 0 {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-	//use PopBytes to split the rest of the payload up based on format specifiers
-	memoryAddress, memorySize, err := utils.PopBytes(payload[1:], addressLength)
-	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-
-	addr, err := utils.BytesToInt32(memoryAddress)
+	loc, err := uds.ParseAddressAndLength(uds.ReadMemoryByAddress, payload)
 	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-
+		return uds.ToNegativeResponse(uds.ReadMemoryByAddress, err).Bytes()
 	}
-	mSize, err := utils.BytesToInt32(memorySize)
-	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
+	// the memory is addressed with 32 bits
+	if addressLength, sizeLength := loc.Lengths(); addressLength > 4 || sizeLength > 4 {
+		return uds.NewNegativeResponse(uds.ReadMemoryByAddress, uds.ROOR).Bytes()
 	}
+	addr, mSize := uint(loc.Address), uint(loc.Size)
 
 	mem, _ := utils.ReadMemory(v.Memory, int(addr), int(mSize))
 	return append([]byte{byte(uds.ReadMemoryByAddress + 0x40)}, mem...)
@@ -151,11 +139,11 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 	//check that the total payload len fits the dataIdentifier size
 	if len(payload)%2 != 0 {
 		//invalid data identifier size
-		return []byte{uds.NR, uds.ReadDataByIdentifier, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.IMLOIF).Bytes()
 	}
 
 	// set positive response sid
-	var response = []byte{uds.ReadDataByIdentifier + 0x40}
+	var response = []byte{byte(uds.ReadDataByIdentifier + 0x40)}
 	var dataIdentifier []byte
 	for len(payload) != 0 {
 		// grab the first identifier from the payload
@@ -175,7 +163,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 			// SECURITY FIX.
 			if v.DiagnosticStatus != 2 {
 				// if the sessions is not in diagnostic mode 2, spec states conditions not correct is valid error
-				return []byte{uds.NR, uds.ReadDataByIdentifier, uds.CNC}
+				return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.CNC).Bytes()
 			}
 			//add the dataIdentifier to the response
 			response = append(response, dataIdentifier...)
@@ -189,7 +177,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 		return response
 	}
 	// otherwise request out of range
-	return []byte{uds.NR, uds.ReadDataByIdentifier, uds.ROOR}
+	return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.ROOR).Bytes()
 }
 
 func main() {
@@ -231,7 +219,8 @@ Example using alternate AddressAndLengthFormat:
 23 33 000050 000010
 63 00010000000000000000000000000000`,
 		},
-		Service: poc,
+		Service:         poc,
+		S3ServerTimeout: node.NoS3Timeout,
 	})
 	if err != nil {
 		panic(err)
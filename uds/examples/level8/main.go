@@ -36,7 +36,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 
 	//check to see if we are locked out due to bad attempts
 	if v.Memory[AUTH_ATTEMPTS] >= 3 {
-		return []byte{uds.NR, uds.SecurityAccess, uds.ENOA}
+		return uds.NewNegativeResponse(uds.SecurityAccess, uds.ENOA).Bytes()
 	}
 	// handle seed request 0x1
 	if bytes.Equal(payload, []byte{0x1}) {
@@ -56,7 +56,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 	if payload[0] == byte(0x2) {
 		// check a seed was requested first
 		if v.Memory[SEED_SENT] == 0x0 {
-			return []byte{uds.NR, uds.SecurityAccess, uds.RSE}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.RSE).Bytes()
 		}
 		// check the auth attempt
 		// key == XorBytes(seed,xorkey)
@@ -70,29 +70,29 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 		} else {
 			// auth attempt failed, increment the attempt counter and negative response for invalid key
 			v.Memory[AUTH_ATTEMPTS] += 1
-			return []byte{uds.NR, uds.SecurityAccess, uds.IK}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.IK).Bytes()
 		}
 	}
 	// default return an error
-	return []byte{uds.NR, uds.SecurityAccess, uds.SAD}
+	return uds.NewNegativeResponse(uds.SecurityAccess, uds.SAD).Bytes()
 }
 
 func (v *VulnPoc) DiagnosticSessionControl(payload []byte) []byte {
 	// check if we have proper security access level
 	if v.Memory[ACCESS_LEVEL] != 0x2 {
-		return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SAD}
+		return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SAD).Bytes()
 	}
 	if bytes.Equal(payload, []byte{0x2}) {
 		v.Memory[DIAG_STATUS] = 2
-		return []byte{uds.DiagnosticSessionControl + 0x40, 0x02}
+		return []byte{byte(uds.DiagnosticSessionControl + 0x40), 0x02}
 	}
-	return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SFNS}
+	return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ECUReset(payload []byte) []byte {
 
 	if len(payload) != 1 {
-		return []byte{uds.NR, uds.ECUReset, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ECUReset, uds.IMLOIF).Bytes()
 	}
 
 	// if reset subfunction is hardReset(0x1) or keyOffOnReset(0x2)
@@ -104,10 +104,10 @@ func (v *VulnPoc) ECUReset(payload []byte) []byte {
 		v.Memory[AUTH_ATTEMPTS] = 0x0
 		// retain our auth attempts to fix lockout bypass
 		//v.AuthAttempts = 0x0
-		return []byte{uds.ECUReset + 0x40, payload[0]}
+		return []byte{byte(uds.ECUReset + 0x40), payload[0]}
 
 	}
-	return []byte{uds.NR, uds.ECUReset, uds.SFNS}
+	return uds.NewNegativeResponse(uds.ECUReset, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) WriteMemoryByAddress(payload []byte) []byte {
@@ -120,53 +120,32 @@ func (v *VulnPoc) WriteMemoryByAddress(payload []byte) []byte {
 		                       addressSizeLength = addressAndLengthFormatIdentifier & 0xf
 
 	*/
-	addressFormat := payload[0]
-	addressLength := int(addressFormat & 0xf)
-	sizeLength := int(addressFormat&0xf0) >> 4
-	if sizeLength == 0 || addressLength == 0 {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-	//use PopBytes to split the memoryAddress from the full payload
-	memoryAddress, sizeAndData, err := utils.PopBytes(payload[1:], addressLength)
-	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
-	}
-	// use PopBytes again to split memorySize from dataRecord
-	memorySize, dataRecord, err := utils.PopBytes(sizeAndData, sizeLength)
-	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
-	}
-
-	addr, err := utils.BytesToUInt(memoryAddress)
-	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-
-	}
-	mSize, err := utils.BytesToUInt(memorySize)
+	// the dataRecord follows memoryAddress and memorySize
+	loc, dataRecord, err := uds.DecodeAddressAndLength(uds.WriteMemoryByAddress, payload)
 	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
+		return uds.ToNegativeResponse(uds.WriteMemoryByAddress, err).Bytes()
 	}
+	addr, mSize := uint(loc.Address), uint(loc.Size)
 
 	//check that length of dataRecord matches our input size
 	if int(mSize) != len(dataRecord) {
-		//return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
-		return []byte{uds.NR, uds.WriteMemoryByAddress, 0xFF}
+		//return uds.NewNegativeResponse(uds.WriteMemoryByAddress, uds.ROOR).Bytes()
+		return uds.NewNegativeResponse(uds.WriteMemoryByAddress, 0xFF).Bytes()
 	}
 
 	//check to make sure request cannot access from ACCESS_LEVEL (0x50) to XOR_KEY (0x78)
 	if (addr >= ACCESS_LEVEL && addr <= (XOR_KEY+SEED_LEN)) || (addr <= ACCESS_LEVEL && (addr+mSize) > ACCESS_LEVEL) {
 		//return security access denied
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.SAD}
+		return uds.NewNegativeResponse(uds.WriteMemoryByAddress, uds.SAD).Bytes()
 	}
 
 	err = utils.WriteMemory(&v.Memory, dataRecord, int(addr))
 	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
+		return uds.NewNegativeResponse(uds.WriteMemoryByAddress, uds.ROOR).Bytes()
 	}
 	// positive response [WriteMemoryByAddress][addressAndLengthFormat][MemoryAddress][MemorySize]
-	retPayload := append([]byte{addressFormat}, memoryAddress...)
-	retPayload = append(retPayload, memorySize...)
-	return append([]byte{byte(uds.WriteMemoryByAddress + 0x40)}, retPayload...)
+	response, _ := loc.Append([]byte{byte(uds.WriteMemoryByAddress + 0x40)}, uds.WriteMemoryByAddress)
+	return response
 
 }
 
@@ -180,37 +159,21 @@ func (v *VulnPoc) ReadMemoryByAddress(payload []byte) []byte {
 		                       addressSizeLength = addressAndLengthFormatIdentifier & 0xf
 
 	*/
-	addressFormat := payload[0]
-	addressLength := int(addressFormat & 0xf)
-	sizeLength := int(addressFormat&0xf0) >> 4
-	if sizeLength == 0 || addressLength == 0 {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-	//use PopBytes to split the rest of the payload up based on format specifiers
-	memoryAddress, memorySize, err := utils.PopBytes(payload[1:], addressLength)
-	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-
-	addr, err := utils.BytesToUInt(memoryAddress)
-	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-
-	}
-	mSize, err := utils.BytesToUInt(memorySize)
+	loc, err := uds.ParseAddressAndLength(uds.ReadMemoryByAddress, payload)
 	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
+		return uds.ToNegativeResponse(uds.ReadMemoryByAddress, err).Bytes()
 	}
+	addr, mSize := uint(loc.Address), uint(loc.Size)
 
 	//check to make sure request cannot access the seed + key
 	if (addr >= CURRENT_SEED && addr <= (XOR_KEY+SEED_LEN)) || (addr < CURRENT_SEED && (addr+mSize) > CURRENT_SEED) {
 		//return security access denied
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.SAD}
+		return uds.NewNegativeResponse(uds.ReadMemoryByAddress, uds.SAD).Bytes()
 	}
 
 	mem, err := utils.ReadMemory(v.Memory, int(addr), int(mSize))
 	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
+		return uds.NewNegativeResponse(uds.ReadMemoryByAddress, uds.ROOR).Bytes()
 	}
 	return append([]byte{byte(uds.ReadMemoryByAddress + 0x40)}, mem...)
 
@@ -220,11 +183,11 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 	//check that the total payload len fits the dataIdentifier size
 	if len(payload)%2 != 0 {
 		//invalid data identifier size
-		return []byte{uds.NR, uds.ReadDataByIdentifier, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.IMLOIF).Bytes()
 	}
 
 	// set positive response sid
-	var response = []byte{uds.ReadDataByIdentifier + 0x40}
+	var response = []byte{byte(uds.ReadDataByIdentifier + 0x40)}
 	var dataIdentifier []byte
 	for len(payload) != 0 {
 		// grab the first identifier from the payload
@@ -244,7 +207,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 			// ensure diag is 0x2 and access level is 0x2 - catch cases where someone writes their own diag status
 			if v.Memory[DIAG_STATUS] != 0x02 || v.Memory[ACCESS_LEVEL] != 0x2 {
 				// if the sessions is not in diagnostic mode 2, spec states conditions not correct is valid error
-				return []byte{uds.NR, uds.ReadDataByIdentifier, uds.CNC}
+				return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.CNC).Bytes()
 			}
 			//add the dataIdentifier to the response
 			response = append(response, dataIdentifier...)
@@ -258,7 +221,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 		return response
 	}
 	// otherwise request out of range
-	return []byte{uds.NR, uds.ReadDataByIdentifier, uds.ROOR}
+	return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.ROOR).Bytes()
 }
 
 func main() {
@@ -306,7 +269,8 @@ AddressAndLengthFormat - 0x11 - high nibble is length of memory size, low is len
 MemoryAddress - 0x00 - memory address to written to
 MemorySize - 0x01 - size of memory written`,
 		},
-		Service: poc,
+		Service:         poc,
+		S3ServerTimeout: node.NoS3Timeout,
 	})
 	if err != nil {
 		panic(err)
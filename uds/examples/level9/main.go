@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 
 	"github.com/atredispartners/uds-zoo/uds/node"
 	"github.com/atredispartners/uds-zoo/uds/uds"
@@ -45,7 +46,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 
 	//check to see if we are locked out due to bad attempts
 	if v.Memory[AUTH_ATTEMPTS] >= 3 {
-		return []byte{uds.NR, uds.SecurityAccess, uds.ENOA}
+		return uds.NewNegativeResponse(uds.SecurityAccess, uds.ENOA).Bytes()
 	}
 	// handle seed request 0x1
 	if bytes.Equal(payload, []byte{0x1}) {
@@ -65,7 +66,7 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 	if payload[0] == byte(0x2) {
 		// check a seed was requested first
 		if v.Memory[SEED_SENT] == 0x0 {
-			return []byte{uds.NR, uds.SecurityAccess, uds.RSE}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.RSE).Bytes()
 		}
 		// check the auth attempt
 		// key == XorBytes(seed,xorkey)
@@ -79,29 +80,29 @@ func (v *VulnPoc) SecurityAccess(payload []byte) []byte {
 		} else {
 			// auth attempt failed, increment the attempt counter and negative response for invalid key
 			v.Memory[AUTH_ATTEMPTS] += 1
-			return []byte{uds.NR, uds.SecurityAccess, uds.IK}
+			return uds.NewNegativeResponse(uds.SecurityAccess, uds.IK).Bytes()
 		}
 	}
 	// default return an error
-	return []byte{uds.NR, uds.SecurityAccess, uds.SAD}
+	return uds.NewNegativeResponse(uds.SecurityAccess, uds.SAD).Bytes()
 }
 
 func (v *VulnPoc) DiagnosticSessionControl(payload []byte) []byte {
 	// check if we have proper security access level
 	if v.Memory[ACCESS_LEVEL] != 0x2 {
-		return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SAD}
+		return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SAD).Bytes()
 	}
 	if bytes.Equal(payload, []byte{0x2}) {
 		v.Memory[DIAG_STATUS] = 2
-		return []byte{uds.DiagnosticSessionControl + 0x40, 0x02}
+		return []byte{byte(uds.DiagnosticSessionControl + 0x40), 0x02}
 	}
-	return []byte{uds.NR, uds.DiagnosticSessionControl, uds.SFNS}
+	return uds.NewNegativeResponse(uds.DiagnosticSessionControl, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) ECUReset(payload []byte) []byte {
 
 	if len(payload) != 1 {
-		return []byte{uds.NR, uds.ECUReset, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ECUReset, uds.IMLOIF).Bytes()
 	}
 
 	// if reset subfunction is hardReset(0x1) or keyOffOnReset(0x2)
@@ -113,10 +114,10 @@ func (v *VulnPoc) ECUReset(payload []byte) []byte {
 		v.Memory[AUTH_ATTEMPTS] = 0x0
 		// retain our auth attempts to fix lockout bypass
 		//v.AuthAttempts = 0x0
-		return []byte{uds.ECUReset + 0x40, payload[0]}
+		return []byte{byte(uds.ECUReset + 0x40), payload[0]}
 
 	}
-	return []byte{uds.NR, uds.ECUReset, uds.SFNS}
+	return uds.NewNegativeResponse(uds.ECUReset, uds.SFNS).Bytes()
 }
 
 func (v *VulnPoc) WriteMemoryByAddress(payload []byte) []byte {
@@ -129,53 +130,32 @@ func (v *VulnPoc) WriteMemoryByAddress(payload []byte) []byte {
 		                       addressSizeLength = addressAndLengthFormatIdentifier & 0xf
 
 	*/
-	addressFormat := payload[0]
-	addressLength := int(addressFormat & 0xf)
-	sizeLength := int(addressFormat&0xf0) >> 4
-	if sizeLength == 0 || addressLength == 0 {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-	//use PopBytes to split the memoryAddress from the full payload
-	memoryAddress, sizeAndData, err := utils.PopBytes(payload[1:], addressLength)
-	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
-	}
-	// use PopBytes again to split memorySize from dataRecord
-	memorySize, dataRecord, err := utils.PopBytes(sizeAndData, sizeLength)
-	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
-	}
-
-	addr, err := utils.BytesToUInt(memoryAddress)
+	// the dataRecord follows memoryAddress and memorySize
+	loc, dataRecord, err := uds.DecodeAddressAndLength(uds.WriteMemoryByAddress, payload)
 	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-
-	}
-	mSize, err := utils.BytesToUInt(memorySize)
-	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
+		return uds.ToNegativeResponse(uds.WriteMemoryByAddress, err).Bytes()
 	}
+	addr, mSize := uint(loc.Address), uint(loc.Size)
 
 	//check that length of dataRecord matches our input size
 	if int(mSize) != len(dataRecord) {
-		//return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
-		return []byte{uds.NR, uds.WriteMemoryByAddress, 0xFF}
+		//return uds.NewNegativeResponse(uds.WriteMemoryByAddress, uds.ROOR).Bytes()
+		return uds.NewNegativeResponse(uds.WriteMemoryByAddress, 0xFF).Bytes()
 	}
 
 	//check to make sure request cannot access from ACCESS_LEVEL (0x50) to XOR_KEY (0x78)
 	if (addr >= ACCESS_LEVEL && addr <= (XOR_KEY+SEED_LEN)) || (addr <= ACCESS_LEVEL && (addr+mSize) > ACCESS_LEVEL) {
 		//return security access denied
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.SAD}
+		return uds.NewNegativeResponse(uds.WriteMemoryByAddress, uds.SAD).Bytes()
 	}
 
 	err = utils.WriteMemory(&v.Memory, dataRecord, int(addr))
 	if err != nil {
-		return []byte{uds.NR, uds.WriteMemoryByAddress, uds.ROOR}
+		return uds.NewNegativeResponse(uds.WriteMemoryByAddress, uds.ROOR).Bytes()
 	}
 	// positive response [WriteMemoryByAddress][addressAndLengthFormat][MemoryAddress][MemorySize]
-	retPayload := append([]byte{addressFormat}, memoryAddress...)
-	retPayload = append(retPayload, memorySize...)
-	return append([]byte{byte(uds.WriteMemoryByAddress + 0x40)}, retPayload...)
+	response, _ := loc.Append([]byte{byte(uds.WriteMemoryByAddress + 0x40)}, uds.WriteMemoryByAddress)
+	return response
 
 }
 
@@ -189,37 +169,21 @@ func (v *VulnPoc) ReadMemoryByAddress(payload []byte) []byte {
 		                       addressSizeLength = addressAndLengthFormatIdentifier & 0xf
 
 	*/
-	addressFormat := payload[0]
-	addressLength := int(addressFormat & 0xf)
-	sizeLength := int(addressFormat&0xf0) >> 4
-	if sizeLength == 0 || addressLength == 0 {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-	//use PopBytes to split the rest of the payload up based on format specifiers
-	memoryAddress, memorySize, err := utils.PopBytes(payload[1:], addressLength)
-	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-	}
-
-	addr, err := utils.BytesToUInt(memoryAddress)
-	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
-
-	}
-	mSize, err := utils.BytesToUInt(memorySize)
+	loc, err := uds.ParseAddressAndLength(uds.ReadMemoryByAddress, payload)
 	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
+		return uds.ToNegativeResponse(uds.ReadMemoryByAddress, err).Bytes()
 	}
+	addr, mSize := uint(loc.Address), uint(loc.Size)
 
 	//check to make sure request cannot access the seed + key
 	if (addr >= CURRENT_SEED && addr <= (XOR_KEY+SEED_LEN)) || (addr < CURRENT_SEED && (addr+mSize) > CURRENT_SEED) {
 		//return security access denied
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.SAD}
+		return uds.NewNegativeResponse(uds.ReadMemoryByAddress, uds.SAD).Bytes()
 	}
 
 	mem, err := utils.ReadMemory(v.Memory, int(addr), int(mSize))
 	if err != nil {
-		return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
+		return uds.NewNegativeResponse(uds.ReadMemoryByAddress, uds.ROOR).Bytes()
 	}
 	return append([]byte{byte(uds.ReadMemoryByAddress + 0x40)}, mem...)
 
@@ -229,11 +193,11 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 	//check that the total payload len fits the dataIdentifier size
 	if len(payload)%2 != 0 {
 		//invalid data identifier size
-		return []byte{uds.NR, uds.ReadDataByIdentifier, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.IMLOIF).Bytes()
 	}
 
 	// set positive response sid
-	var response = []byte{uds.ReadDataByIdentifier + 0x40}
+	var response = []byte{byte(uds.ReadDataByIdentifier + 0x40)}
 	var dataIdentifier []byte
 	for len(payload) != 0 {
 		// grab the first identifier from the payload
@@ -253,7 +217,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 			// ensure diag is 0x2 and access level is 0x2 - catch cases where someone writes their own diag status
 			if v.Memory[DIAG_STATUS] != 0x02 || v.Memory[ACCESS_LEVEL] != 0x2 {
 				// if the sessions is not in diagnostic mode 2, spec states conditions not correct is valid error
-				return []byte{uds.NR, uds.ReadDataByIdentifier, uds.CNC}
+				return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.CNC).Bytes()
 			}
 			//add the dataIdentifier to the response
 			response = append(response, dataIdentifier...)
@@ -271,7 +235,7 @@ func (v *VulnPoc) ReadDataByIdentifier(payload []byte) []byte {
 		return response
 	}
 	// otherwise request out of range
-	return []byte{uds.NR, uds.ReadDataByIdentifier, uds.ROOR}
+	return uds.NewNegativeResponse(uds.ReadDataByIdentifier, uds.ROOR).Bytes()
 }
 
 func (v *VulnPoc) DynamicallyDefineDataIdentifier(payload []byte) []byte {
@@ -291,7 +255,7 @@ func (v *VulnPoc) DynamicallyDefineDataIdentifier(payload []byte) []byte {
 		return v.clearDynamicallyDefinedDataIdentifier(payload[1:])
 	}
 	// otherwise, subFunctionNotSupported (0x12)
-	return []byte{uds.NR, uds.DynamicallyDefineDataIdentifier, uds.SFNS}
+	return uds.NewNegativeResponse(uds.DynamicallyDefineDataIdentifier, uds.SFNS).Bytes()
 
 }
 
@@ -305,7 +269,7 @@ func (v *VulnPoc) defineByIdentifier(payload []byte) []byte {
 	*/
 	// check that the payload is well-formed by size
 	if (len(payload) % 6) != 0 {
-		return []byte{uds.NR, uds.DynamicallyDefineDataIdentifier, uds.IMLOIF}
+		return uds.NewNegativeResponse(uds.DynamicallyDefineDataIdentifier, uds.IMLOIF).Bytes()
 	}
 
 	// pull out our new DynamicDataIdentifier
@@ -325,7 +289,7 @@ func (v *VulnPoc) defineByIdentifier(payload []byte) []byte {
 		//cut our payload to the next
 		payload = payload[6:]
 	}
-	response := []byte{uds.DynamicallyDefineDataIdentifier + 0x40}
+	response := []byte{byte(uds.DynamicallyDefineDataIdentifier + 0x40)}
 	response = append(response, []byte{0x02}...)
 	response = append(response, dynamicDid...)
 	return response
@@ -338,50 +302,29 @@ func (v *VulnPoc) defineByMemoryAddress(payload []byte) []byte {
 		[3] addressAndLengthFormatIdentifier               - 0xFF
 		[4:4+addrSize]   memoryAddress				       - 0x01..addrSize
 		[4+addrSize:(4+addrSize)+mSize]   memorySize       - 0xFF..mSize
-
+		further memoryAddress and memorySize pairs reuse the addressAndLengthFormatIdentifier
 	*/
+	var req uds.DynamicallyDefineDataIdentifierRequest
+	if err := req.UnmarshalPayload(append([]byte{uds.DefineByMemoryAddress}, payload...)); err != nil {
+		return uds.ToNegativeResponse(uds.DynamicallyDefineDataIdentifier, err).Bytes()
+	}
 	// pull out our new DynamicDataIdentifier
 	dynamicDid := payload[0:2]
-	addrSize, mSize := utils.ParseAddressAndLengthFormat(payload[2])
-
-	memAddr := payload[3:(3 + addrSize)]
-	memoryLen := payload[(3 + addrSize) : (3+addrSize)+mSize]
-	newIdentifier := DynamicDataIdentifier{}
-	newIdentifier.SourceType = 0x02
-	newIdentifier.DataIdentifier = dynamicDid
-	newIdentifier.Source = memAddr
-	newIdentifier.Size, _ = utils.BytesToUInt(memoryLen)
-	newIdentifier.SourceOffset = 0
-
-	//add to our instance array
-	v.DynamicDataIdentifiers = append(v.DynamicDataIdentifiers, []DynamicDataIdentifier{newIdentifier}...)
-	// reslice the payload and iterate over the definitions
-	payload = payload[3+len(memAddr)+len(memoryLen):]
-
-	//if there are more
-	for len(payload) != 0 {
-
-		// check that the payload is well-formed by size - must be at least 5
-		if len(payload) < 2 {
-			return []byte{uds.NR, uds.DynamicallyDefineDataIdentifier, uds.IMLOIF}
-		}
-		memAddr := payload[:addrSize]
-		memoryLen := payload[addrSize : addrSize+mSize]
+	for _, src := range req.MemorySources {
+		memAddr := make([]byte, 8)
+		binary.BigEndian.PutUint64(memAddr, src.MemoryAddress)
 
 		newIdentifier := DynamicDataIdentifier{}
 		newIdentifier.SourceType = 0x02
 		newIdentifier.DataIdentifier = dynamicDid
 		newIdentifier.Source = memAddr
-		newIdentifier.Size, _ = utils.BytesToUInt(memoryLen)
+		newIdentifier.Size = uint(src.MemorySize)
 		newIdentifier.SourceOffset = 0
 
 		//add to our instance array
 		v.DynamicDataIdentifiers = append(v.DynamicDataIdentifiers, []DynamicDataIdentifier{newIdentifier}...)
-		//cut our payload to the next
-
-		payload = payload[len(memAddr)+len(memAddr):]
 	}
-	response := []byte{uds.DynamicallyDefineDataIdentifier + 0x40}
+	response := []byte{byte(uds.DynamicallyDefineDataIdentifier + 0x40)}
 	response = append(response, []byte{0x02}...)
 	response = append(response, dynamicDid...)
 	return response
@@ -414,10 +357,10 @@ func (v *VulnPoc) clearDynamicallyDefinedDataIdentifier(payload []byte) []byte {
 
 	}
 	if removed == 0 {
-		return []byte{uds.NR, uds.DynamicallyDefineDataIdentifier, uds.ROOR}
+		return uds.NewNegativeResponse(uds.DynamicallyDefineDataIdentifier, uds.ROOR).Bytes()
 	}
 
-	response := []byte{uds.DynamicallyDefineDataIdentifier + 0x40}
+	response := []byte{byte(uds.DynamicallyDefineDataIdentifier + 0x40)}
 	response = append(response, []byte{0x03}...)
 	response = append(response, dynamicDid...)
 	return response
@@ -437,7 +380,7 @@ func (v *VulnPoc) getDynamicallyDefinedDataIdentifier(dataIdentifier []byte) []b
 				addr, _ := utils.BytesToUInt(dyndid.Source)
 				mem, err := utils.ReadMemory(v.Memory, int(addr), int(dyndid.Size))
 				if err != nil {
-					return []byte{uds.NR, uds.ReadMemoryByAddress, uds.ROOR}
+					return uds.NewNegativeResponse(uds.ReadMemoryByAddress, uds.ROOR).Bytes()
 				}
 				response = append(response, mem...)
 
@@ -560,7 +503,8 @@ TX: 22 f300
 RX: 62 415452454449533133333700000000000000000000000000000000000000000041545245444953313333370000000000f1904154524544495331333337
 `,
 		},
-		Service: poc,
+		Service:         poc,
+		S3ServerTimeout: node.NoS3Timeout,
 	})
 	if err != nil {
 		panic(err)
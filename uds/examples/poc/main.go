@@ -1,6 +1,9 @@
 package main
 
-import "github.com/atredispartners/uds-zoo/uds/node"
+import (
+	"github.com/atredispartners/uds-zoo/uds/node"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
 
 type VulnPoc struct {
 	node.Service
@@ -24,6 +27,16 @@ func (v *VulnPoc) customHandler(payload []byte) []byte {
 	return []byte{0x00, 0x00}
 }
 
+// contextHandler shows a handler using the request context, it answers with the
+// active session and logs which client asked.
+func (v *VulnPoc) contextHandler(ctx *node.Context, req uds.Request) (uds.Response, error) {
+	if len(req.Data) != 0 {
+		return uds.Response{}, uds.ErrIncorrectMessageLength
+	}
+	ctx.Logger.Printf("%s requested the session at %s", ctx.Client, ctx.Received)
+	return uds.Response{SID: uds.PositiveResponseSID(req.SID), Data: []byte{ctx.Session.Session()}}, nil
+}
+
 func main() {
 	poc := &VulnPoc{Service: &node.DefaultService{}}
 	//node.DONTREGISTERINSTANCE = true // Remove to register with the node.
@@ -45,6 +58,15 @@ func main() {
 	// this example calls AddHandler on the instance registering the SID 0x41 for the function customHandler
 	// in the case you are overriding a function that exists within node/service it will be registered automatically
 	x.AddHandler(0x41, poc.customHandler)
+	// Handle registers a handler that also receives the request context, see node.Context
+	x.Handle(0x42, poc.contextHandler)
+	// data identifiers served by the default ReadDataByIdentifier are registered instead of handled,
+	// ReadAccess and WriteAccess restrict them to sessions and security levels, see memory.Access
+	x.DataIdentifiers().Register(node.DataIdentifier{
+		ID:    0x1337,
+		Name:  "Flag",
+		Value: []byte("registered-flag"),
+	})
 	if err := x.Start(); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,221 @@
+// Package auth implements the ISO 14229-1:2020 Authentication service with
+// X.509 certificates and ECDSA proofs of ownership, issued by a local test CA.
+//
+// A client sends its certificate with verifyCertificateUnidirectional or
+// verifyCertificateBidirectional and receives a challenge, which it signs
+// with its private key and returns with proofOfOwnership. Once the proof
+// verifies, the roles of the certificate are granted and unlock DIDs, memory
+// and services restricted to them, see memory.Access and node.AccessRule.
+//
+// Example, the flag DID 0x1337 is readable by a tester with the "engineer"
+// role:
+//
+//	ca, _ := auth.NewCA("UDS Zoo Test CA")
+//	x, err := node.NewInstance(&node.InstanceConfig{
+//		...
+//		Authenticator: auth.NewAuthenticator(ca.Pool()),
+//	})
+//	x.DataIdentifiers().Register(node.DataIdentifier{
+//		ID:         0x1337,
+//		Value:      []byte("flag"),
+//		ReadAccess: memory.Access{Role: "engineer"},
+//	})
+//
+// VerifyChain and VerifyProof are meant to be replaced by deliberately broken
+// variants, like SkipChainVerification.
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"sync"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// DefaultChallengeLength is the length of the challenges of a new
+// Authenticator.
+const DefaultChallengeLength = 32
+
+// State is the authentication state an Authenticator updates,
+// node.SessionManager implements it.
+type State interface {
+	Authenticate(roles ...string)
+	Deauthenticate()
+}
+
+// Authenticator answers Authentication requests, see package doc.
+type Authenticator struct {
+	// Roots verifies client certificates.
+	Roots *x509.CertPool
+	// Certificate and Key prove the identity of the server for
+	// verifyCertificateBidirectional, which is not supported without them.
+	Certificate *x509.Certificate
+	Key         *ecdsa.PrivateKey
+	// Roles returns the roles granted to an authenticated certificate, the
+	// organizational units of its subject when nil.
+	Roles func(cert *x509.Certificate) []string
+	// VerifyChain returns the negative response for a client certificate
+	// not issued by Roots, VerifyCertificate when nil.
+	VerifyChain func(cert *x509.Certificate, roots *x509.CertPool) error
+	// VerifyProof reports whether proof is the signature of challenge by the
+	// key of cert, VerifySignature when nil.
+	VerifyProof func(cert *x509.Certificate, challenge []byte, proof []byte) bool
+	// ChallengeLength is the length of the server challenges.
+	ChallengeLength int
+
+	mu sync.Mutex
+	// pending is the verified certificate waiting for its proof of
+	// ownership of challenge.
+	pending   *x509.Certificate
+	challenge []byte
+}
+
+// NewAuthenticator returns an authenticator accepting certificates issued by
+// roots.
+func NewAuthenticator(roots *x509.CertPool) *Authenticator {
+	return &Authenticator{Roots: roots, ChallengeLength: DefaultChallengeLength}
+}
+
+// Authenticate answers an Authentication request and updates s once a proof
+// of ownership completes it. Tasks other than deAuthenticate,
+// verifyCertificateUnidirectional, verifyCertificateBidirectional,
+// proofOfOwnership and authenticationConfiguration are not supported.
+func (a *Authenticator) Authenticate(s State, req *uds.AuthenticationRequest) (*uds.AuthenticationResponse, error) {
+	task := req.AuthenticationTask & 0x7F
+	resp := &uds.AuthenticationResponse{AuthenticationTask: req.AuthenticationTask}
+	switch task {
+	case uds.DeAuthenticate:
+		a.reset()
+		s.Deauthenticate()
+		resp.ReturnParameter = uds.DeAuthenticationSuccessful
+	case uds.AuthenticationConfiguration:
+		resp.ReturnParameter = uds.AuthenticationConfigurationAPCE
+	case uds.VerifyCertificateUnidirectional, uds.VerifyCertificateBidirectional:
+		if task == uds.VerifyCertificateBidirectional && (a.Certificate == nil || a.Key == nil) {
+			return nil, uds.ErrSubFunctionNotSupported
+		}
+		cert, err := a.verify(req.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		challenge := make([]byte, a.challengeLength())
+		if _, err := rand.Read(challenge); err != nil {
+			return nil, uds.ErrChallengeCalculationFailed
+		}
+		if task == uds.VerifyCertificateBidirectional {
+			if len(req.Challenge) == 0 {
+				return nil, uds.ErrRequestOutOfRange
+			}
+			digest := sha256.Sum256(req.Challenge)
+			proof, err := ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+			if err != nil {
+				return nil, uds.ErrChallengeCalculationFailed
+			}
+			resp.Certificate = a.Certificate.Raw
+			resp.ProofOfOwnership = proof
+		}
+		a.mu.Lock()
+		a.pending = cert
+		a.challenge = challenge
+		a.mu.Unlock()
+		resp.ReturnParameter = uds.CertificateVerifiedOwnershipVerificationNecessary
+		resp.Challenge = challenge
+	case uds.ProofOfOwnership:
+		a.mu.Lock()
+		cert, challenge := a.pending, a.challenge
+		a.mu.Unlock()
+		if cert == nil {
+			return nil, uds.ErrRequestSequenceError
+		}
+		// a challenge is only good for one proof
+		a.reset()
+		verify := a.VerifyProof
+		if verify == nil {
+			verify = VerifySignature
+		}
+		if !verify(cert, challenge, req.ProofOfOwnership) {
+			return nil, uds.ErrOwnershipVerificationFailed
+		}
+		roles := cert.Subject.OrganizationalUnit
+		if a.Roles != nil {
+			roles = a.Roles(cert)
+		}
+		s.Authenticate(roles...)
+		resp.ReturnParameter = uds.OwnershipVerifiedAuthenticationComplete
+	default:
+		return nil, uds.ErrSubFunctionNotSupported
+	}
+	return resp, nil
+}
+
+// reset forgets a certificate waiting for its proof of ownership.
+func (a *Authenticator) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = nil
+	a.challenge = nil
+}
+
+func (a *Authenticator) challengeLength() int {
+	if a.ChallengeLength <= 0 {
+		return DefaultChallengeLength
+	}
+	return a.ChallengeLength
+}
+
+// verify parses a DER client certificate and checks it with VerifyChain.
+func (a *Authenticator) verify(der []byte) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, uds.ErrCertificateInvalidFormat
+	}
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok {
+		return nil, uds.ErrCertificateInvalidType
+	}
+	verifyChain := a.VerifyChain
+	if verifyChain == nil {
+		verifyChain = VerifyCertificate
+	}
+	if err := verifyChain(cert, a.Roots); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// VerifyCertificate verifies cert against roots, mapping failures to the
+// certificate verification negative responses.
+func VerifyCertificate(cert *x509.Certificate, roots *x509.CertPool) error {
+	_, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	if err == nil {
+		return nil
+	}
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		return uds.ErrCertificateInvalidTimePeriod
+	}
+	if errors.Is(err, x509.ErrUnsupportedAlgorithm) {
+		return uds.ErrCertificateInvalidSignature
+	}
+	return uds.ErrCertificateInvalidChainOfTrust
+}
+
+// SkipChainVerification is a deliberately broken VerifyChain that accepts
+// every certificate, whoever issued it.
+func SkipChainVerification(cert *x509.Certificate, roots *x509.CertPool) error {
+	return nil
+}
+
+// VerifySignature reports whether proof is an ASN.1 ECDSA signature of the
+// SHA-256 digest of challenge by the key of cert.
+func VerifySignature(cert *x509.Certificate, challenge []byte, proof []byte) bool {
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	digest := sha256.Sum256(challenge)
+	return ecdsa.VerifyASN1(key, digest[:], proof)
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// state records the roles granted by an Authenticator.
+type state struct {
+	roles []string
+}
+
+func (s *state) Authenticate(roles ...string) { s.roles = append(s.roles, roles...) }
+func (s *state) Deauthenticate()              { s.roles = nil }
+
+func nrcOf(err error) uds.NRC {
+	if err == nil {
+		return 0
+	}
+	return uds.ToNegativeResponse(uds.Authentication, err).Code
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, challenge []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(challenge)
+	proof, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func testCA(t *testing.T, name string) *CA {
+	t.Helper()
+	ca, err := NewCA(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func testIssue(t *testing.T, ca *CA, roles ...string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	cert, key, err := ca.Issue("tester", roles...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// issueWith returns a certificate for key issued by ca, valid from notBefore
+// to notAfter.
+func issueWith(t *testing.T, ca *CA, key interface{}, notBefore time.Time, notAfter time.Time) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "tester"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	var public interface{}
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		public = &k.PublicKey
+	case *rsa.PrivateKey:
+		public = &k.PublicKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, public, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	ca := testCA(t, "Test CA")
+	other := testCA(t, "Other CA")
+	issued, _ := testIssue(t, ca)
+	foreign, _ := testIssue(t, other)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	now := time.Now()
+	tests := []struct {
+		name        string
+		certificate []byte
+		verifyChain func(cert *x509.Certificate, roots *x509.CertPool) error
+		nrc         uds.NRC
+	}{
+		{"issued", issued.Raw, nil, 0},
+		{"other CA", foreign.Raw, nil, uds.CVFICOT},
+		{"other CA without chain verification", foreign.Raw, SkipChainVerification, 0},
+		{"self-signed", other.Certificate.Raw, nil, uds.CVFICOT},
+		{"expired", issueWith(t, ca, ecKey, now.AddDate(-2, 0, 0), now.AddDate(-1, 0, 0)), nil, uds.CVFITP},
+		{"not yet valid", issueWith(t, ca, ecKey, now.AddDate(1, 0, 0), now.AddDate(2, 0, 0)), nil, uds.CVFITP},
+		{"RSA", issueWith(t, ca, rsaKey, now.Add(-time.Hour), now.Add(time.Hour)), nil, uds.CVFIT},
+		{"garbage", []byte{0x30, 0x03, 0x01, 0x02, 0x03}, nil, uds.CVFIF},
+	}
+	for _, tt := range tests {
+		a := NewAuthenticator(ca.Pool())
+		a.VerifyChain = tt.verifyChain
+		s := &state{}
+		resp, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.VerifyCertificateUnidirectional, Certificate: tt.certificate})
+		if nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+			continue
+		}
+		if err == nil && (resp.ReturnParameter != uds.CertificateVerifiedOwnershipVerificationNecessary || len(resp.Challenge) != DefaultChallengeLength) {
+			t.Errorf("%s: return parameter 0x%02X, challenge % X", tt.name, resp.ReturnParameter, resp.Challenge)
+		}
+	}
+}
+
+func TestProofOfOwnership(t *testing.T) {
+	ca := testCA(t, "Test CA")
+	cert, key := testIssue(t, ca, "engineer")
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests := []struct {
+		name string
+		// verified is whether the certificate was sent first
+		verified    bool
+		verifyProof func(cert *x509.Certificate, challenge []byte, proof []byte) bool
+		roles       func(cert *x509.Certificate) []string
+		proof       func(challenge []byte) []byte
+		nrc         uds.NRC
+		want        []string
+	}{
+		{"proof", true, nil, nil, func(c []byte) []byte { return sign(t, key, c) }, 0, []string{"engineer"}},
+		{"custom roles", true, nil, func(*x509.Certificate) []string { return []string{"admin"} }, func(c []byte) []byte { return sign(t, key, c) }, 0, []string{"admin"}},
+		{"other key", true, nil, nil, func(c []byte) []byte { return sign(t, otherKey, c) }, uds.OVF, nil},
+		{"other challenge", true, nil, nil, func(c []byte) []byte { return sign(t, key, append(c, 0x00)) }, uds.OVF, nil},
+		{"garbage", true, nil, nil, func(c []byte) []byte { return []byte{0x01} }, uds.OVF, nil},
+		{"broken verification", true, func(*x509.Certificate, []byte, []byte) bool { return true }, nil, func(c []byte) []byte { return nil }, 0, []string{"engineer"}},
+		{"without certificate", false, nil, nil, func(c []byte) []byte { return sign(t, key, c) }, uds.RSE, nil},
+	}
+	for _, tt := range tests {
+		a := NewAuthenticator(ca.Pool())
+		a.VerifyProof = tt.verifyProof
+		a.Roles = tt.roles
+		s := &state{}
+		var challenge []byte
+		if tt.verified {
+			resp, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.VerifyCertificateUnidirectional, Certificate: cert.Raw})
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			challenge = resp.Challenge
+		}
+		resp, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.ProofOfOwnership, ProofOfOwnership: tt.proof(challenge)})
+		if nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+		}
+		if err == nil && resp.ReturnParameter != uds.OwnershipVerifiedAuthenticationComplete {
+			t.Errorf("%s: return parameter 0x%02X", tt.name, resp.ReturnParameter)
+		}
+		if fmt.Sprint(s.roles) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: roles %v, want %v", tt.name, s.roles, tt.want)
+		}
+		// a challenge is only good for one proof
+		if _, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.ProofOfOwnership, ProofOfOwnership: tt.proof(challenge)}); nrcOf(err) != uds.RSE {
+			t.Errorf("%s: second proof %v, want %v", tt.name, err, uds.RSE)
+		}
+	}
+}
+
+func TestAuthenticationTasks(t *testing.T) {
+	ca := testCA(t, "Test CA")
+	cert, key := testIssue(t, ca, "engineer")
+	a := NewAuthenticator(ca.Pool())
+	s := &state{}
+
+	if _, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.VerifyCertificateBidirectional, Certificate: cert.Raw, Challenge: []byte{0x01}}); nrcOf(err) != uds.SFNS {
+		t.Errorf("bidirectional without server certificate: %v", err)
+	}
+	a.Certificate, a.Key = testIssue(t, ca, "server")
+	if _, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.VerifyCertificateBidirectional, Certificate: cert.Raw}); nrcOf(err) != uds.ROOR {
+		t.Errorf("bidirectional without client challenge: %v", err)
+	}
+	resp, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.VerifyCertificateBidirectional, Certificate: cert.Raw, Challenge: []byte("client challenge")})
+	if err != nil {
+		t.Fatalf("bidirectional: %v", err)
+	}
+	server, err := x509.ParseCertificate(resp.Certificate)
+	if err != nil || !VerifySignature(server, []byte("client challenge"), resp.ProofOfOwnership) {
+		t.Errorf("server proof of ownership does not verify: %v", err)
+	}
+	if _, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.ProofOfOwnership, ProofOfOwnership: sign(t, key, resp.Challenge)}); err != nil || len(s.roles) != 1 {
+		t.Errorf("proof: %v, roles %v", err, s.roles)
+	}
+
+	resp, err = a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.DeAuthenticate})
+	if err != nil || resp.ReturnParameter != uds.DeAuthenticationSuccessful || s.roles != nil {
+		t.Errorf("deAuthenticate: %v, roles %v", err, s.roles)
+	}
+	resp, err = a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: uds.AuthenticationConfiguration})
+	if err != nil || resp.ReturnParameter != uds.AuthenticationConfigurationAPCE {
+		t.Errorf("authenticationConfiguration: %v", err)
+	}
+	if _, err := a.Authenticate(s, &uds.AuthenticationRequest{AuthenticationTask: 0x05}); nrcOf(err) != uds.SFNS {
+		t.Errorf("unsupported task: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package node
+
+import (
+	"log"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// ClientHeader is the HTTP header the controller uses to forward the identity
+// of the client that sent a request.
+const ClientHeader = "X-UDS-Client"
+
+// Context carries the state a handler needs besides the request itself.
+type Context struct {
+	// Client identifies the requesting client, the ClientHeader value when
+	// present or else the remote address of the connection. It is empty for
+	// the services requested by ResponseOnEvent events.
+	Client string
+	// Session is the session and security access state of the instance.
+	Session *SessionManager
+	// Received is when the instance received the request.
+	Received time.Time
+	Logger   *log.Logger
+	Instance *Instance
+	// SuppressPositiveResponse is set when the request had the
+	// suppressPosRspMsgIndicationBit set. Handlers receive the sub-function
+	// without it and the instance drops their positive response.
+	SuppressPositiveResponse bool
+}
+
+// Handler handles a request for a service. A returned error is answered with
+// a negative response, see uds.ToNegativeResponse. A handler may run for as
+// long as the operation it simulates, the instance keeps the tester waiting
+// with responsePending negative responses, see InstanceConfig.P2ServerMax.
+//
+// Example:
+//
+//	func readVIN(ctx *node.Context, req uds.Request) (uds.Response, error) {
+//		if len(req.Data) != 2 {
+//			return uds.Response{}, uds.ErrIncorrectMessageLength
+//		}
+//		ctx.Logger.Printf("%s read the VIN", ctx.Client)
+//		return uds.Response{SID: uds.PositiveResponseSID(req.SID), Data: append(req.Data, vin...)}, nil
+//	}
+type Handler func(ctx *Context, req uds.Request) (uds.Response, error)
+
+// LegacyHandler adapts a handler working on raw payloads, as taken by
+// AddHandler, to a Handler. The first byte returned is the response SID.
+func LegacyHandler(handler func([]byte) []byte) Handler {
+	return func(ctx *Context, req uds.Request) (uds.Response, error) {
+		return responseFromBytes(handler(req.Data)), nil
+	}
+}
+
+// responseFromBytes splits a complete response message, an empty message is
+// returned as the zero Response.
+func responseFromBytes(b []byte) uds.Response {
+	if len(b) == 0 {
+		return uds.Response{}
+	}
+	return uds.Response{SID: uds.SID(b[0]), Data: b[1:]}
+}
+
+// suppressed reports whether resp is not sent because the request asked to
+// suppress positive responses.
+func (ctx *Context) suppressed(resp uds.Response) bool {
+	return ctx.SuppressPositiveResponse && resp.SID != uds.NR
+}
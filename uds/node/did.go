@@ -0,0 +1,244 @@
+package node
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// Standard data identifiers prefilled in every DIDRegistry.
+const (
+	ActiveDiagnosticSessionDataIdentifier          = 0xF186
+	SparePartNumberDataIdentifier                  = 0xF187
+	ECUSerialNumberDataIdentifier                  = 0xF18C
+	VINDataIdentifier                              = 0xF190
+	SystemSupplierECUSoftwareVersionDataIdentifier = 0xF195
+)
+
+// DefaultMaxResponseLength is the longest response a DIDRegistry builds, the
+// most an ISO-TP message is able to carry.
+const DefaultMaxResponseLength = 4095
+
+// DataIdentifier describes a DID served by a DIDRegistry.
+type DataIdentifier struct {
+	ID   uint16
+	Name string
+	// Length is the length of the data record, any length is allowed when zero.
+	Length int
+	// Value is the data record of a DID without a Read func.
+	Value []byte
+	// Writable lets WriteDataByIdentifier replace Value. Written values
+	// survive an ECUReset like EEPROM contents do, unless Volatile is set.
+	Writable bool
+	// Volatile restores the registered Value on ECUReset, like RAM would.
+	Volatile bool
+	// Read returns the data record, overriding Value.
+	Read func(s *SessionManager) ([]byte, error)
+	// Write stores a data record instead of Value, the DID is read only when
+	// nil and not Writable. The length of the record was checked against
+	// Length already.
+	Write func(s *SessionManager, data []byte) error
+	// Scaling holds the scalingByte and scalingByteExtension returned by
+	// ReadScalingDataByIdentifier, which is not supported for the DID when
+	// empty.
+	Scaling     []byte
+	ReadAccess  memory.Access
+	WriteAccess memory.Access
+
+	// initial is the registered Value, restored on reset when Volatile.
+	initial []byte
+}
+
+// DIDRegistry holds the data identifiers served by the DefaultService
+// ReadDataByIdentifier, WriteDataByIdentifier and ReadScalingDataByIdentifier
+// handlers.
+//
+// Example, the flag DID 0x1337 is only readable after unlocking security
+// level 0x01:
+//
+//	i.DataIdentifiers().Register(node.DataIdentifier{
+//		ID:         0x1337,
+//		Value:      []byte("flag"),
+//		ReadAccess: memory.Access{SecurityLevel: 0x01},
+//	})
+type DIDRegistry struct {
+	// MaxResponseLength limits the length of a ReadDataByIdentifier
+	// response, longer responses are answered with responseTooLong.
+	MaxResponseLength int
+
+	mu   sync.Mutex
+	dids map[uint16]*DataIdentifier
+}
+
+// NewDIDRegistry returns a registry holding the active diagnostic session
+// and placeholder part number, serial number, VIN and software version DIDs.
+// The VIN is writable in the extended and programming sessions.
+func NewDIDRegistry() *DIDRegistry {
+	r := &DIDRegistry{
+		MaxResponseLength: DefaultMaxResponseLength,
+		dids:              map[uint16]*DataIdentifier{},
+	}
+	r.Register(
+		DataIdentifier{
+			ID:     ActiveDiagnosticSessionDataIdentifier,
+			Name:   "ActiveDiagnosticSession",
+			Length: 1,
+			Read: func(s *SessionManager) ([]byte, error) {
+				return []byte{s.Session()}, nil
+			},
+		},
+		DataIdentifier{ID: SparePartNumberDataIdentifier, Name: "SparePartNumber", Value: []byte("UDSZOO-0001")},
+		DataIdentifier{ID: ECUSerialNumberDataIdentifier, Name: "ECUSerialNumber", Value: []byte("000000000001")},
+		DataIdentifier{
+			ID:          VINDataIdentifier,
+			Name:        "VIN",
+			Length:      17,
+			Value:       []byte("1UDSZ000000000001"),
+			Writable:    true,
+			WriteAccess: memory.Access{Sessions: []byte{uds.ExtendedDiagnosticSession, uds.ProgrammingSession}},
+		},
+		DataIdentifier{ID: SystemSupplierECUSoftwareVersionDataIdentifier, Name: "SystemSupplierECUSoftwareVersion", Value: []byte("1.0.0")},
+	)
+	return r
+}
+
+// Register adds dids to the registry, replacing any DID with the same ID.
+func (r *DIDRegistry) Register(dids ...DataIdentifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n := range dids {
+		did := dids[n]
+		did.Value = append([]byte(nil), did.Value...)
+		did.initial = did.Value
+		r.dids[did.ID] = &did
+	}
+}
+
+// Unregister removes the DIDs with the given IDs.
+func (r *DIDRegistry) Unregister(ids ...uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.dids, id)
+	}
+}
+
+// Lookup returns a copy of the DID with the given ID.
+func (r *DIDRegistry) Lookup(id uint16) (DataIdentifier, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	did, ok := r.dids[id]
+	if !ok {
+		return DataIdentifier{}, false
+	}
+	return *did, true
+}
+
+// IDs returns the ID of every registered DID in ascending order.
+func (r *DIDRegistry) IDs() []uint16 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]uint16, 0, len(r.dids))
+	for id := range r.dids {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	return ids
+}
+
+// Read answers a ReadDataByIdentifier request for ids. DIDs that are unknown
+// or not readable in the active session are left out and the request is out
+// of range when none is left. A DID requiring a locked security level fails
+// the request with securityAccessDenied.
+func (r *DIDRegistry) Read(s *SessionManager, ids []uint16) ([]uds.DataRecord, error) {
+	var dids []DataIdentifier
+	for _, id := range ids {
+		did, ok := r.Lookup(id)
+		if !ok {
+			continue
+		}
+		if err := did.ReadAccess.Check(s); err != nil {
+			if uds.ToNegativeResponse(uds.ReadDataByIdentifier, err).Code == uds.ROOR {
+				continue
+			}
+			return nil, err
+		}
+		dids = append(dids, did)
+	}
+	if len(dids) == 0 {
+		return nil, uds.ErrRequestOutOfRange
+	}
+	records := make([]uds.DataRecord, 0, len(dids))
+	length := 1
+	for _, did := range dids {
+		data, err := did.read(s)
+		if err != nil {
+			return nil, err
+		}
+		length += 2 + len(data)
+		if length > r.MaxResponseLength {
+			return nil, uds.ErrResponseTooLong
+		}
+		records = append(records, uds.DataRecord{DataIdentifier: did.ID, Data: data})
+	}
+	return records, nil
+}
+
+// Write answers a WriteDataByIdentifier request. Unknown and read only DIDs
+// and DIDs not writable in the active session are out of range, a data
+// record not matching Length has an incorrect length.
+func (r *DIDRegistry) Write(s *SessionManager, id uint16, data []byte) error {
+	did, ok := r.Lookup(id)
+	if !ok || (did.Write == nil && !did.Writable) {
+		return uds.ErrRequestOutOfRange
+	}
+	if err := did.WriteAccess.Check(s); err != nil {
+		return err
+	}
+	if did.Length != 0 && len(data) != did.Length {
+		return uds.ErrIncorrectMessageLength
+	}
+	if did.Write != nil {
+		return did.Write(s, data)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.dids[id]; ok {
+		stored.Value = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+// Reset restores the registered Value of every Volatile DID, as done after a
+// positive ECUReset response.
+func (r *DIDRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, did := range r.dids {
+		if did.Volatile {
+			did.Value = did.initial
+		}
+	}
+}
+
+// Scaling answers a ReadScalingDataByIdentifier request, DIDs without
+// scaling information are out of range.
+func (r *DIDRegistry) Scaling(s *SessionManager, id uint16) ([]byte, error) {
+	did, ok := r.Lookup(id)
+	if !ok || len(did.Scaling) == 0 {
+		return nil, uds.ErrRequestOutOfRange
+	}
+	if err := did.ReadAccess.Check(s); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), did.Scaling...), nil
+}
+
+func (did *DataIdentifier) read(s *SessionManager) ([]byte, error) {
+	if did.Read != nil {
+		return did.Read(s)
+	}
+	return append([]byte(nil), did.Value...), nil
+}
@@ -0,0 +1,134 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+func testDIDRegistry() *DIDRegistry {
+	r := NewDIDRegistry()
+	r.Register(
+		DataIdentifier{ID: 0x1337, Value: []byte("flag"), ReadAccess: memory.Access{SecurityLevel: 0x01}},
+		DataIdentifier{ID: 0x0100, Value: []byte{0x01, 0x02}, ReadAccess: memory.Access{Sessions: []byte{uds.ExtendedDiagnosticSession}}},
+		DataIdentifier{ID: 0x0200, Value: bytes.Repeat([]byte{0xAA}, 10), Scaling: []byte{0x01, 0x02}},
+		DataIdentifier{ID: 0x0300, Read: func(s *SessionManager) ([]byte, error) {
+			return nil, uds.ErrConditionsNotCorrect
+		}},
+	)
+	return r
+}
+
+func TestDIDRegistryRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  byte
+		unlocked byte
+		ids      []uint16
+		want     []uds.DataRecord
+		nrc      uds.NRC
+	}{
+		{"VIN", uds.DefaultSession, 0, []uint16{VINDataIdentifier}, []uds.DataRecord{{DataIdentifier: VINDataIdentifier, Data: []byte("1UDSZ000000000001")}}, 0},
+		{"active session", uds.ExtendedDiagnosticSession, 0, []uint16{ActiveDiagnosticSessionDataIdentifier}, []uds.DataRecord{{DataIdentifier: ActiveDiagnosticSessionDataIdentifier, Data: []byte{0x03}}}, 0},
+		{"unknown", uds.DefaultSession, 0, []uint16{0x4242}, nil, uds.ROOR},
+		{"unknown left out", uds.DefaultSession, 0, []uint16{0x4242, SparePartNumberDataIdentifier}, []uds.DataRecord{{DataIdentifier: SparePartNumberDataIdentifier, Data: []byte("UDSZOO-0001")}}, 0},
+		{"wrong session", uds.DefaultSession, 0, []uint16{0x0100}, nil, uds.ROOR},
+		{"wrong session left out", uds.DefaultSession, 0, []uint16{0x0100, SystemSupplierECUSoftwareVersionDataIdentifier}, []uds.DataRecord{{DataIdentifier: SystemSupplierECUSoftwareVersionDataIdentifier, Data: []byte("1.0.0")}}, 0},
+		{"session", uds.ExtendedDiagnosticSession, 0, []uint16{0x0100}, []uds.DataRecord{{DataIdentifier: 0x0100, Data: []byte{0x01, 0x02}}}, 0},
+		{"locked", uds.DefaultSession, 0, []uint16{VINDataIdentifier, 0x1337}, nil, uds.SAD},
+		{"unlocked", uds.DefaultSession, 0x01, []uint16{0x1337}, []uds.DataRecord{{DataIdentifier: 0x1337, Data: []byte("flag")}}, 0},
+		{"failing read", uds.DefaultSession, 0, []uint16{0x0300}, nil, uds.CNC},
+		{"too long", uds.DefaultSession, 0, []uint16{0x0200, 0x0200}, nil, uds.RTL},
+	}
+	for _, tt := range tests {
+		r := testDIDRegistry()
+		r.MaxResponseLength = 20
+		s := NewSessionManager()
+		s.ChangeSession(tt.session)
+		if tt.unlocked != 0 {
+			s.Unlock(tt.unlocked)
+		}
+		got, err := r.Read(s, tt.ids)
+		if nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for n := range got {
+			if got[n].DataIdentifier != tt.want[n].DataIdentifier || !bytes.Equal(got[n].Data, tt.want[n].Data) {
+				t.Errorf("%s: record %d = %04X % X, want %04X % X", tt.name, n, got[n].DataIdentifier, got[n].Data, tt.want[n].DataIdentifier, tt.want[n].Data)
+			}
+		}
+	}
+}
+
+func TestDIDRegistryScaling(t *testing.T) {
+	r := testDIDRegistry()
+	s := NewSessionManager()
+	if got, err := r.Scaling(s, 0x0200); err != nil || !bytes.Equal(got, []byte{0x01, 0x02}) {
+		t.Errorf("Scaling(0x0200) = % X, %v", got, err)
+	}
+	if _, err := r.Scaling(s, VINDataIdentifier); nrcOf(err) != uds.ROOR {
+		t.Errorf("Scaling of a DID without scaling = %v, want %v", err, uds.ROOR)
+	}
+}
+
+func TestReadDataByIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"VIN", "22 f190", "62 f190315544535a303030303030303030303031"},
+		{"two DIDs", "22 f186 f195", "62 f18601f195312e302e30"},
+		{"unknown", "22 4242", "7f 2231"},
+		{"odd length", "22 f1", "7f 2213"},
+		{"empty", "22", "7f 2213"},
+	}
+	i := newTestInstance(t, InstanceConfig{})
+	for _, tt := range tests {
+		if _, received := exchange(i, tt.request); len(received) != 1 || received[0] != tt.want {
+			t.Errorf("%s: received %v, want %s", tt.name, received, tt.want)
+		}
+	}
+}
+
+func TestWriteDataByIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"VIN in default session", "2e f190 3155445a5a393939393939393939393939", "7f 2e31"},
+		{"extended session", "10 03", "50 03003201f4"},
+		{"VIN", "2e f190 3155445330303030303030303030303432", "6e f190"},
+		{"VIN too short", "2e f190 3155", "7f 2e13"},
+		{"read only", "2e f195 322e30", "7f 2e31"},
+		{"unknown", "2e 4242 00", "7f 2e31"},
+		{"volatile", "2e 0100 0304", "6e 0100"},
+		{"custom write", "2e 0200 00", "7f 2e22"},
+		{"read back", "22 f190 0100", "62 f190315544533030303030303030303030343201000304"},
+		{"reset", "11 01", "51 01"},
+		{"extended session after reset", "10 03", "50 03003201f4"},
+		// the VIN is kept in non-volatile memory, 0x0100 is not
+		{"read after reset", "22 f190 0100", "62 f19031554453303030303030303030303034320100aaaa"},
+	}
+	r := NewDIDRegistry()
+	r.Register(
+		DataIdentifier{ID: 0x0100, Length: 2, Value: []byte{0xAA, 0xAA}, Writable: true, Volatile: true},
+		DataIdentifier{ID: 0x0200, Write: func(s *SessionManager, data []byte) error {
+			return uds.ErrConditionsNotCorrect
+		}},
+	)
+	i := newTestInstance(t, InstanceConfig{DataIdentifiers: r})
+	for _, tt := range tests {
+		if _, received := exchange(i, tt.request); len(received) != 1 || received[0] != tt.want {
+			t.Errorf("%s: received %v, want %s", tt.name, received, tt.want)
+		}
+	}
+}
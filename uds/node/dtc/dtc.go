@@ -0,0 +1,260 @@
+// Package dtc models the diagnostic trouble code memory of a node, read with
+// ReadDTCInformation (0x19), cleared with ClearDiagnosticInformation (0x14) and
+// frozen with ControlDTCSetting (0x85).
+//
+// Example, a confirmed DTC with a snapshot holding DID 0xF190 and an
+// occurrence counter as extended data record 0x01:
+//
+//	s := dtc.NewStore(dtc.DTC{
+//		Number:       0x012345,
+//		Status:       dtc.TestFailed | dtc.ConfirmedDTC,
+//		Snapshots:    map[byte][]byte{0x01: append([]byte{0x01, 0xF1, 0x90}, vin...)},
+//		ExtendedData: map[byte][]byte{0x01: {0x03}},
+//	})
+package dtc
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// Status is a DTC status byte.
+type Status byte
+
+// DTC status bits.
+const (
+	TestFailed                         Status = 0x01
+	TestFailedThisOperationCycle       Status = 0x02
+	PendingDTC                         Status = 0x04
+	ConfirmedDTC                       Status = 0x08
+	TestNotCompletedSinceLastClear     Status = 0x10
+	TestFailedSinceLastClear           Status = 0x20
+	TestNotCompletedThisOperationCycle Status = 0x40
+	WarningIndicatorRequested          Status = 0x80
+)
+
+// ClearedStatus is the status of a DTC after it was cleared.
+const ClearedStatus = TestNotCompletedSinceLastClear | TestNotCompletedThisOperationCycle
+
+// AllDTCs is the groupOfDTC selecting every DTC.
+const AllDTCs = 0xFFFFFF
+
+// ISO14229DTCFormat is the DTCFormatIdentifier reported by a Store.
+const ISO14229DTCFormat = 0x01
+
+// Report types supported by Store.ReadDTCInformation.
+const (
+	ReportNumberOfDTCByStatusMask      = 0x01
+	ReportDTCByStatusMask              = 0x02
+	ReportDTCSnapshotRecordByDTCNumber = 0x04
+	ReportDTCExtDataRecordByDTCNumber  = 0x06
+	ReportSupportedDTC                 = 0x0A
+)
+
+// allRecords selects every snapshot or extended data record of a DTC.
+const allRecords = 0xFF
+
+// DTC is a diagnostic trouble code and the data stored with it.
+type DTC struct {
+	// Number is the three byte DTC number.
+	Number uint32
+	Status Status
+	// Snapshots holds the DTCSnapshotRecord following each
+	// DTCSnapshotRecordNumber, the number of identifiers followed by each DID
+	// and its data.
+	Snapshots map[byte][]byte
+	// ExtendedData holds the DTCExtendedDataRecord of each
+	// DTCExtendedDataRecordNumber.
+	ExtendedData map[byte][]byte
+}
+
+// Store is the DTC memory of a node.
+type Store struct {
+	// AvailabilityMask holds the status bits the store supports, the others
+	// are never reported.
+	AvailabilityMask Status
+	// Groups maps a groupOfDTC to the DTC numbers cleared with it, besides
+	// AllDTCs and the number of every DTC.
+	Groups map[uint32][]uint32
+
+	mu       sync.Mutex
+	dtcs     map[uint32]*DTC
+	disabled bool
+}
+
+// NewStore returns a store holding dtcs and supporting every status bit.
+func NewStore(dtcs ...DTC) *Store {
+	s := &Store{AvailabilityMask: 0xFF, dtcs: map[uint32]*DTC{}}
+	s.Add(dtcs...)
+	return s
+}
+
+// Add adds dtcs to the store, replacing any DTC with the same number.
+func (s *Store) Add(dtcs ...DTC) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for n := range dtcs {
+		d := dtcs[n]
+		s.dtcs[d.Number] = &d
+	}
+}
+
+// Lookup returns a copy of the DTC with the given number.
+func (s *Store) Lookup(number uint32) (DTC, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.dtcs[number]
+	if !ok {
+		return DTC{}, false
+	}
+	return *d, true
+}
+
+// DTCs returns a copy of every DTC ordered by number.
+func (s *Store) DTCs() []DTC {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLocked()
+}
+
+func (s *Store) sortedLocked() []DTC {
+	dtcs := make([]DTC, 0, len(s.dtcs))
+	for _, d := range s.dtcs {
+		dtcs = append(dtcs, *d)
+	}
+	sort.Slice(dtcs, func(a, b int) bool { return dtcs[a].Number < dtcs[b].Number })
+	return dtcs
+}
+
+// SetEnabled switches updating DTC status bits on or off, as done by
+// ControlDTCSetting.
+func (s *Store) SetEnabled(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disabled = !enabled
+}
+
+// Enabled reports whether DTC status bits are updated.
+func (s *Store) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.disabled
+}
+
+// Report records the result of the test of a DTC and reports whether the
+// status was updated, which it is not for unknown DTCs or while updates are
+// switched off. A failed test sets the DTC pending and confirmed.
+func (s *Store) Report(number uint32, failed bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.dtcs[number]
+	if !ok || s.disabled {
+		return false
+	}
+	d.Status &^= TestNotCompletedSinceLastClear | TestNotCompletedThisOperationCycle
+	if failed {
+		d.Status |= TestFailed | TestFailedThisOperationCycle | PendingDTC | ConfirmedDTC | TestFailedSinceLastClear
+	} else {
+		d.Status &^= TestFailed
+	}
+	return true
+}
+
+// Clear resets the status and drops the snapshot and extended data of the
+// DTCs in group, which is AllDTCs, a key of Groups or a DTC number. Unknown
+// groups are out of range.
+func (s *Store) Clear(group uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var numbers []uint32
+	switch {
+	case group == AllDTCs:
+		for number := range s.dtcs {
+			numbers = append(numbers, number)
+		}
+	case s.Groups[group] != nil:
+		numbers = s.Groups[group]
+	case s.dtcs[group] != nil:
+		numbers = []uint32{group}
+	default:
+		return uds.ErrRequestOutOfRange
+	}
+	for _, number := range numbers {
+		if d, ok := s.dtcs[number]; ok {
+			d.Status = ClearedStatus
+			d.Snapshots = nil
+			d.ExtendedData = nil
+		}
+	}
+	return nil
+}
+
+// ReadDTCInformation answers a ReadDTCInformation request for reportType,
+// returning the record following the reportType in the positive response.
+func (s *Store) ReadDTCInformation(reportType byte, record []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch reportType {
+	case ReportNumberOfDTCByStatusMask, ReportDTCByStatusMask:
+		if len(record) != 1 {
+			return nil, uds.ErrIncorrectMessageLength
+		}
+		mask := Status(record[0]) & s.AvailabilityMask
+		var matches []DTC
+		for _, d := range s.sortedLocked() {
+			if d.Status&mask != 0 {
+				matches = append(matches, d)
+			}
+		}
+		if reportType == ReportNumberOfDTCByStatusMask {
+			return []byte{byte(s.AvailabilityMask), ISO14229DTCFormat, byte(len(matches) >> 8), byte(len(matches))}, nil
+		}
+		return s.appendDTCs([]byte{byte(s.AvailabilityMask)}, matches), nil
+	case ReportDTCSnapshotRecordByDTCNumber, ReportDTCExtDataRecordByDTCNumber:
+		if len(record) != 4 {
+			return nil, uds.ErrIncorrectMessageLength
+		}
+		number := uint32(record[0])<<16 | uint32(record[1])<<8 | uint32(record[2])
+		d, ok := s.dtcs[number]
+		if !ok {
+			return nil, uds.ErrRequestOutOfRange
+		}
+		records := d.Snapshots
+		if reportType == ReportDTCExtDataRecordByDTCNumber {
+			records = d.ExtendedData
+		}
+		resp := s.appendDTCs(nil, []DTC{*d})
+		if record[3] != allRecords {
+			data, ok := records[record[3]]
+			if !ok {
+				return nil, uds.ErrRequestOutOfRange
+			}
+			return append(append(resp, record[3]), data...), nil
+		}
+		numbers := make([]int, 0, len(records))
+		for n := range records {
+			numbers = append(numbers, int(n))
+		}
+		sort.Ints(numbers)
+		for _, n := range numbers {
+			resp = append(append(resp, byte(n)), records[byte(n)]...)
+		}
+		return resp, nil
+	case ReportSupportedDTC:
+		if len(record) != 0 {
+			return nil, uds.ErrIncorrectMessageLength
+		}
+		return s.appendDTCs([]byte{byte(s.AvailabilityMask)}, s.sortedLocked()), nil
+	}
+	return nil, uds.ErrSubFunctionNotSupported
+}
+
+// appendDTCs appends the number and available status bits of each DTC.
+func (s *Store) appendDTCs(buf []byte, dtcs []DTC) []byte {
+	for _, d := range dtcs {
+		buf = append(buf, byte(d.Number>>16), byte(d.Number>>8), byte(d.Number), byte(d.Status&s.AvailabilityMask))
+	}
+	return buf
+}
@@ -0,0 +1,125 @@
+package dtc
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+func nrcOf(err error) uds.NRC {
+	if err == nil {
+		return 0
+	}
+	return uds.ToNegativeResponse(uds.ReadDTCInformation, err).Code
+}
+
+func testStore() *Store {
+	s := NewStore(
+		DTC{
+			Number:       0x012345,
+			Status:       TestFailed | ConfirmedDTC,
+			Snapshots:    map[byte][]byte{0x02: {0x01, 0xF1, 0x86, 0x03}, 0x01: {0x01, 0xF1, 0x86, 0x01}},
+			ExtendedData: map[byte][]byte{0x01: {0x03}},
+		},
+		DTC{Number: 0xC0FFEE, Status: PendingDTC},
+		DTC{Number: 0x000100, Status: ClearedStatus},
+	)
+	s.AvailabilityMask = 0x7F
+	return s
+}
+
+func TestReadDTCInformation(t *testing.T) {
+	tests := []struct {
+		name       string
+		reportType byte
+		record     []byte
+		want       []byte
+		nrc        uds.NRC
+	}{
+		{"number by status mask", ReportNumberOfDTCByStatusMask, []byte{0x0C}, []byte{0x7F, 0x01, 0x00, 0x02}, 0},
+		{"number by unavailable bit", ReportNumberOfDTCByStatusMask, []byte{0x80}, []byte{0x7F, 0x01, 0x00, 0x00}, 0},
+		{"by status mask", ReportDTCByStatusMask, []byte{0x01}, []byte{0x7F, 0x01, 0x23, 0x45, 0x09}, 0},
+		{"by status mask ordered", ReportDTCByStatusMask, []byte{0xFF}, []byte{0x7F, 0x00, 0x01, 0x00, 0x50, 0x01, 0x23, 0x45, 0x09, 0xC0, 0xFF, 0xEE, 0x04}, 0},
+		{"status mask length", ReportDTCByStatusMask, nil, nil, uds.IMLOIF},
+		{"snapshot", ReportDTCSnapshotRecordByDTCNumber, []byte{0x01, 0x23, 0x45, 0x02}, []byte{0x01, 0x23, 0x45, 0x09, 0x02, 0x01, 0xF1, 0x86, 0x03}, 0},
+		{"every snapshot", ReportDTCSnapshotRecordByDTCNumber, []byte{0x01, 0x23, 0x45, 0xFF}, []byte{0x01, 0x23, 0x45, 0x09, 0x01, 0x01, 0xF1, 0x86, 0x01, 0x02, 0x01, 0xF1, 0x86, 0x03}, 0},
+		{"unknown snapshot", ReportDTCSnapshotRecordByDTCNumber, []byte{0x01, 0x23, 0x45, 0x03}, nil, uds.ROOR},
+		{"snapshot of unknown DTC", ReportDTCSnapshotRecordByDTCNumber, []byte{0x01, 0x23, 0x46, 0x01}, nil, uds.ROOR},
+		{"extended data", ReportDTCExtDataRecordByDTCNumber, []byte{0x01, 0x23, 0x45, 0x01}, []byte{0x01, 0x23, 0x45, 0x09, 0x01, 0x03}, 0},
+		{"no extended data", ReportDTCExtDataRecordByDTCNumber, []byte{0xC0, 0xFF, 0xEE, 0xFF}, []byte{0xC0, 0xFF, 0xEE, 0x04}, 0},
+		{"extended data length", ReportDTCExtDataRecordByDTCNumber, []byte{0x01, 0x23, 0x45}, nil, uds.IMLOIF},
+		{"supported", ReportSupportedDTC, nil, []byte{0x7F, 0x00, 0x01, 0x00, 0x50, 0x01, 0x23, 0x45, 0x09, 0xC0, 0xFF, 0xEE, 0x04}, 0},
+		{"supported length", ReportSupportedDTC, []byte{0x00}, nil, uds.IMLOIF},
+		{"unsupported report type", 0x42, nil, nil, uds.SFNS},
+	}
+	s := testStore()
+	for _, tt := range tests {
+		got, err := s.ReadDTCInformation(tt.reportType, tt.record)
+		if nrcOf(err) != tt.nrc || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got % X, %v, want % X, %v", tt.name, got, err, tt.want, tt.nrc)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		number  uint32
+		failed  bool
+		updated bool
+		status  Status
+	}{
+		{"failed", true, 0x000100, true, true, TestFailed | TestFailedThisOperationCycle | PendingDTC | ConfirmedDTC | TestFailedSinceLastClear},
+		{"passed", true, 0x012345, false, true, ConfirmedDTC},
+		{"passed after clear", true, 0x000100, false, true, 0},
+		{"disabled", false, 0x012345, false, false, TestFailed | ConfirmedDTC},
+		{"unknown", true, 0x424242, true, false, 0},
+	}
+	for _, tt := range tests {
+		s := testStore()
+		s.SetEnabled(tt.enabled)
+		if s.Enabled() != tt.enabled {
+			t.Errorf("%s: Enabled = %v", tt.name, s.Enabled())
+		}
+		if got := s.Report(tt.number, tt.failed); got != tt.updated {
+			t.Errorf("%s: Report = %v, want %v", tt.name, got, tt.updated)
+		}
+		if d, _ := s.Lookup(tt.number); d.Status != tt.status {
+			t.Errorf("%s: status 0x%02X, want 0x%02X", tt.name, byte(d.Status), byte(tt.status))
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	// 0x000100 was cleared to begin with
+	tests := []struct {
+		name    string
+		group   uint32
+		cleared []uint32
+		nrc     uds.NRC
+	}{
+		{"all", AllDTCs, []uint32{0x000100, 0x012345, 0xC0FFEE}, 0},
+		{"group", 0x010000, []uint32{0x000100, 0x012345, 0xC0FFEE}, 0},
+		{"single DTC", 0xC0FFEE, []uint32{0x000100, 0xC0FFEE}, 0},
+		{"unknown", 0x424242, []uint32{0x000100}, uds.ROOR},
+	}
+	for _, tt := range tests {
+		s := testStore()
+		s.Groups = map[uint32][]uint32{0x010000: {0x012345, 0xC0FFEE}}
+		if err := s.Clear(tt.group); nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+		}
+		var cleared []uint32
+		for _, d := range s.DTCs() {
+			if d.Status == ClearedStatus && d.Snapshots == nil && d.ExtendedData == nil {
+				cleared = append(cleared, d.Number)
+			}
+		}
+		if fmt.Sprint(cleared) != fmt.Sprint(tt.cleared) {
+			t.Errorf("%s: cleared %06X, want %06X", tt.name, cleared, tt.cleared)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package node
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// ResponseOnEvent eventTypes, without the storageState bit.
+const (
+	StopResponseOnEvent      byte = 0x00
+	OnDTCStatusChange        byte = 0x01
+	OnTimerInterrupt         byte = 0x02
+	OnChangeOfDataIdentifier byte = 0x03
+	ReportActivatedEvents    byte = 0x04
+	StartResponseOnEvent     byte = 0x05
+	ClearResponseOnEvent     byte = 0x06
+)
+
+// StoreEvent is the storageState bit of an eventType, events set up with it
+// survive entering the default session.
+const StoreEvent byte = 0x40
+
+// InfiniteTimeToResponse is the eventWindowTime of events that stay active
+// until stopped.
+const InfiniteTimeToResponse byte = 0x02
+
+// DefaultEventInterval is how often a new EventEngine checks its events.
+const DefaultEventInterval = 50 * time.Millisecond
+
+// DefaultTimerRates maps the onTimerInterrupt timer rates of a new
+// EventEngine to their period, slow, medium and fast.
+var DefaultTimerRates = map[byte]time.Duration{
+	0x01: time.Second,
+	0x02: 500 * time.Millisecond,
+	0x03: 100 * time.Millisecond,
+}
+
+// Event is an event set up with ResponseOnEvent.
+type Event struct {
+	// EventType is the eventType of the set up request, storageState
+	// included.
+	EventType byte
+	// WindowTime is the eventWindowTime of the set up request.
+	WindowTime byte
+	// Record is the eventTypeRecord: the DTCStatusMask, timer rate or DID
+	// watched.
+	Record []byte
+	// Service is the serviceToRespondToRecord, the request whose response
+	// is sent each time the event occurs.
+	Service []byte
+	// Identified counts the occurrences since the event was started.
+	Identified byte
+
+	// last is what the event watches as of the last check, due the time
+	// the timer interrupts next.
+	last []byte
+	due  time.Time
+}
+
+// EventEngine implements ResponseOnEvent: events are set up with
+// onDTCStatusChange, onTimerInterrupt and onChangeOfDataIdentifier, become
+// active with startResponseOnEvent, and each time one occurs the response
+// to its serviceToRespondToRecord is sent to the subscribers of the engine,
+// the GET /events stream of the instance. Nothing is sent while
+// CommunicationControl disabled transmitting normal messages.
+//
+// Only one event per event type is set up at a time, setting up an event
+// type again replaces it. Entering the default session clears the events set
+// up without StoreEvent. Once the eventWindowTime of the started events
+// passed they are stopped, and the final response to each set up request is
+// sent with the number of identified events.
+//
+// Example, sending the response to 0x22 0xF190 every time the DID changes:
+//
+//	0x86 0x03 0x02 0xF1 0x90 0x22 0xF1 0x90 (onChangeOfDataIdentifier)
+//	0x86 0x05 0x02                          (startResponseOnEvent)
+type EventEngine struct {
+	// Interval is how often DTC statuses, DIDs and timers are checked,
+	// DefaultEventInterval when zero.
+	Interval time.Duration
+	// TimerRates maps onTimerInterrupt timer rates to their period.
+	TimerRates map[byte]time.Duration
+	// WindowTimes maps the accepted eventWindowTimes other than
+	// InfiniteTimeToResponse to how long started events stay active.
+	WindowTimes map[byte]time.Duration
+
+	mu       sync.Mutex
+	instance *Instance
+	events   map[byte]*Event
+	active   bool
+	// window is the eventWindowTime the events were started with.
+	window byte
+	// stop ends the goroutine checking the started events.
+	stop        chan struct{}
+	subscribers map[chan uds.Response]struct{}
+}
+
+// NewEventEngine returns an engine without events, checking every
+// DefaultEventInterval.
+func NewEventEngine() *EventEngine {
+	return &EventEngine{
+		Interval:    DefaultEventInterval,
+		TimerRates:  DefaultTimerRates,
+		events:      map[byte]*Event{},
+		subscribers: map[chan uds.Response]struct{}{},
+	}
+}
+
+func (e *EventEngine) bind(i *Instance) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.instance = i
+}
+
+// Events returns a copy of every event set up, ordered by event type.
+func (e *EventEngine) Events() []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sortedLocked()
+}
+
+func (e *EventEngine) sortedLocked() []Event {
+	events := make([]Event, 0, len(e.events))
+	for _, eventType := range e.typesLocked() {
+		events = append(events, *e.events[eventType])
+	}
+	return events
+}
+
+func (e *EventEngine) typesLocked() []byte {
+	types := make([]byte, 0, len(e.events))
+	for eventType := range e.events {
+		types = append(types, eventType)
+	}
+	sort.Slice(types, func(a, b int) bool { return types[a] < types[b] })
+	return types
+}
+
+// Active reports whether the events were started.
+func (e *EventEngine) Active() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.active
+}
+
+// Subscribe returns a channel receiving the messages sent for events, and a
+// function ending the subscription. Messages are dropped for subscribers
+// that do not keep up.
+func (e *EventEngine) Subscribe() (<-chan uds.Response, func()) {
+	ch := make(chan uds.Response, 16)
+	e.mu.Lock()
+	e.subscribers[ch] = struct{}{}
+	e.mu.Unlock()
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subscribers, ch)
+	}
+}
+
+// Control answers a ResponseOnEvent request with the positive response.
+// Unknown event types are not supported, an unknown eventWindowTime, timer
+// rate or DID is out of range and starting without any event set up is a
+// requestSequenceError. Following ISO 14229-1 numberOfIdentifiedEvents is
+// zero except for reportActivatedEvents.
+func (e *EventEngine) Control(req *uds.ResponseOnEventRequest) (*uds.ResponseOnEventResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	eventType := req.EventType & 0x3F
+	resp := &uds.ResponseOnEventResponse{EventType: req.EventType}
+	if eventType != ReportActivatedEvents {
+		if _, ok := e.windowTime(req.EventWindowTime); !ok {
+			return nil, uds.ErrRequestOutOfRange
+		}
+	}
+	switch eventType {
+	case OnDTCStatusChange, OnTimerInterrupt, OnChangeOfDataIdentifier:
+		if err := e.check(eventType, req.EventTypeRecord, req.ServiceToRespondToRecord); err != nil {
+			return nil, err
+		}
+		ev := &Event{
+			EventType:  req.EventType,
+			WindowTime: req.EventWindowTime,
+			Record:     append([]byte(nil), req.EventTypeRecord...),
+			Service:    append([]byte(nil), req.ServiceToRespondToRecord...),
+		}
+		if e.active {
+			e.arm(ev, time.Now())
+		}
+		e.events[eventType] = ev
+		resp.Record = setupRecord(ev)
+	case StartResponseOnEvent:
+		if len(e.events) == 0 {
+			return nil, uds.ErrRequestSequenceError
+		}
+		e.startLocked(req.EventWindowTime)
+		resp.Record = []byte{req.EventWindowTime}
+	case StopResponseOnEvent, ClearResponseOnEvent:
+		e.stopLocked()
+		if eventType == ClearResponseOnEvent {
+			e.events = map[byte]*Event{}
+		}
+		resp.Record = []byte{req.EventWindowTime}
+	case ReportActivatedEvents:
+		if !e.active {
+			break
+		}
+		for _, ev := range e.sortedLocked() {
+			resp.NumberOfEvents++
+			resp.Record = append(append(resp.Record, ev.EventType), setupRecord(&ev)...)
+		}
+	default:
+		return nil, uds.ErrSubFunctionNotSupported
+	}
+	return resp, nil
+}
+
+// setupRecord returns the eventWindowTime, eventTypeRecord and
+// serviceToRespondToRecord of ev.
+func setupRecord(ev *Event) []byte {
+	record := append([]byte{ev.WindowTime}, ev.Record...)
+	return append(record, ev.Service...)
+}
+
+// check validates the eventTypeRecord of an event set up and its
+// serviceToRespondToRecord.
+func (e *EventEngine) check(eventType byte, record []byte, service []byte) error {
+	if uds.SID(service[0]) == uds.ResponseOnEvent {
+		return uds.ErrRequestOutOfRange
+	}
+	switch eventType {
+	case OnTimerInterrupt:
+		if _, ok := e.TimerRates[record[0]]; !ok {
+			return uds.ErrRequestOutOfRange
+		}
+	case OnChangeOfDataIdentifier:
+		if e.instance != nil {
+			if _, ok := e.instance.dids.Lookup(uint16(record[0])<<8 | uint16(record[1])); !ok {
+				return uds.ErrRequestOutOfRange
+			}
+		}
+	}
+	return nil
+}
+
+func (e *EventEngine) windowTime(window byte) (time.Duration, bool) {
+	if window == InfiniteTimeToResponse {
+		return 0, true
+	}
+	d, ok := e.WindowTimes[window]
+	return d, ok
+}
+
+// Reset stops the events and clears those set up without StoreEvent, the
+// stored events are started again when any are left.
+func (e *EventEngine) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	active := e.active
+	e.stopLocked()
+	for eventType, ev := range e.events {
+		if ev.EventType&StoreEvent == 0 {
+			delete(e.events, eventType)
+		}
+	}
+	if active && len(e.events) > 0 {
+		e.startLocked(e.window)
+	}
+}
+
+func (e *EventEngine) startLocked(window byte) {
+	e.stopLocked()
+	if e.instance == nil {
+		return
+	}
+	now := time.Now()
+	for _, ev := range e.events {
+		e.arm(ev, now)
+	}
+	e.active = true
+	e.window = window
+	e.stop = make(chan struct{})
+	var deadline <-chan time.Time
+	if d, _ := e.windowTime(window); d > 0 {
+		deadline = time.After(d)
+	}
+	go e.run(e.stop, deadline)
+}
+
+// arm readies ev to occur from now on.
+func (e *EventEngine) arm(ev *Event, now time.Time) {
+	ev.Identified = 0
+	ev.last = e.watch(ev)
+	if ev.EventType&0x3F == OnTimerInterrupt {
+		ev.due = now.Add(e.TimerRates[ev.Record[0]])
+	}
+}
+
+func (e *EventEngine) stopLocked() {
+	if e.active {
+		close(e.stop)
+	}
+	e.active = false
+}
+
+// run checks the started events every Interval until stop is closed or
+// the event window closes.
+func (e *EventEngine) run(stop chan struct{}, deadline <-chan time.Time) {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = DefaultEventInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-deadline:
+			e.closeWindow(stop)
+			return
+		case now := <-ticker.C:
+			e.occur(stop, now)
+		}
+	}
+}
+
+// occur sends the response to the service of every event that occurred.
+// Events are handled like requests, one at a time and through the
+// middleware.
+func (e *EventEngine) occur(stop chan struct{}, now time.Time) {
+	i := e.instance
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, service := range e.occurred(stop, now) {
+		ctx := &Context{Session: i.session, Received: now, Logger: i.logger, Instance: i}
+		req := uds.Request{SID: uds.SID(service[0]), Data: service[1:]}
+		resp, err := i.handle(ctx, req)
+		if err != nil {
+			resp = negativeResponse(req.SID, err)
+		}
+		e.send(resp)
+	}
+}
+
+// occurred returns the serviceToRespondToRecord of every event that
+// occurred since the last check.
+func (e *EventEngine) occurred(stop chan struct{}, now time.Time) [][]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running(stop) {
+		return nil
+	}
+	var services [][]byte
+	for _, eventType := range e.typesLocked() {
+		ev := e.events[eventType]
+		if eventType == OnTimerInterrupt {
+			if now.Before(ev.due) {
+				continue
+			}
+			ev.due = now.Add(e.TimerRates[ev.Record[0]])
+		} else {
+			value := e.watch(ev)
+			if bytes.Equal(value, ev.last) {
+				continue
+			}
+			ev.last = value
+		}
+		ev.Identified++
+		services = append(services, ev.Service)
+	}
+	return services
+}
+
+// closeWindow stops the events and sends the final response to each set up
+// request.
+func (e *EventEngine) closeWindow(stop chan struct{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running(stop) {
+		return
+	}
+	e.stopLocked()
+	for _, ev := range e.sortedLocked() {
+		e.sendLocked(uds.Response{
+			SID:  uds.PositiveResponseSID(uds.ResponseOnEvent),
+			Data: append([]byte{ev.EventType, ev.Identified}, setupRecord(&ev)...),
+		})
+	}
+}
+
+// running reports whether the goroutine owning stop was not stopped since.
+func (e *EventEngine) running(stop chan struct{}) bool {
+	return e.active && e.stop == stop
+}
+
+// watch returns what ev watches: the masked status of every DTC matching
+// its DTCStatusMask, or the value of its DID.
+func (e *EventEngine) watch(ev *Event) []byte {
+	i := e.instance
+	switch ev.EventType & 0x3F {
+	case OnDTCStatusChange:
+		var value []byte
+		for _, d := range i.dtcs.DTCs() {
+			if status := byte(d.Status) & ev.Record[0]; status != 0 {
+				value = append(value, byte(d.Number>>16), byte(d.Number>>8), byte(d.Number), status)
+			}
+		}
+		return value
+	case OnChangeOfDataIdentifier:
+		records, err := i.dids.Read(i.session, []uint16{uint16(ev.Record[0])<<8 | uint16(ev.Record[1])})
+		if err != nil || len(records) == 0 {
+			return nil
+		}
+		return records[0].Data
+	}
+	return nil
+}
+
+func (e *EventEngine) send(resp uds.Response) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sendLocked(resp)
+}
+
+// sendLocked hands resp to every subscriber unless transmitting normal
+// messages is disabled.
+func (e *EventEngine) sendLocked(resp uds.Response) {
+	if !e.instance.link.TxEnabled(NormalMessages) {
+		return
+	}
+	for ch := range e.subscribers {
+		select {
+		case ch <- resp:
+		default:
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// testEventInstance returns an instance checking its events every 5ms, with
+// the writable DID 0x0100, a 20ms fast timer rate and a 60ms event window
+// 0x03.
+func testEventInstance(t *testing.T) *Instance {
+	t.Helper()
+	r := NewDIDRegistry()
+	r.Register(DataIdentifier{ID: 0x0100, Length: 2, Value: []byte{0xAA, 0xAA}, Writable: true})
+	e := NewEventEngine()
+	e.Interval = 5 * time.Millisecond
+	e.TimerRates = map[byte]time.Duration{0x03: 20 * time.Millisecond}
+	e.WindowTimes = map[byte]time.Duration{0x03: 60 * time.Millisecond}
+	return newTestInstance(t, InstanceConfig{DataIdentifiers: r, Events: e})
+}
+
+// nextEvent returns the next message sent for an event as "sid data", or ""
+// when none is sent within wait.
+func nextEvent(ch <-chan uds.Response, wait time.Duration) string {
+	select {
+	case resp := <-ch:
+		return transcriptHex(resp.Bytes())
+	case <-time.After(wait):
+		return ""
+	}
+}
+
+func TestResponseOnEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"start without events", "86 05 02", "7f 8624"},
+		{"report without events", "86 04", "c6 0400"},
+		{"unknown window time", "86 03 08 0100 220100", "7f 8631"},
+		{"unknown DID", "86 03 02 4242 224242", "7f 8631"},
+		{"unknown timer rate", "86 02 02 01 3e00", "7f 8631"},
+		{"responding with ResponseOnEvent", "86 03 02 0100 8604", "7f 8631"},
+		{"comparison of values", "86 07 02 00000000000000000000 3e00", "7f 8612"},
+		{"DID change", "86 03 02 0100 220100", "c6 0300020100220100"},
+		{"timer", "86 02 02 03 3e00", "c6 020002033e00"},
+		{"timer replaced", "86 02 02 03 220100", "c6 02000203220100"},
+		{"report before start", "86 04", "c6 0400"},
+		{"start", "86 05 02", "c6 050002"},
+		{"report", "86 04", "c6 040202020322010003020100220100"},
+		{"stop", "86 00 02", "c6 000002"},
+		{"report after stop", "86 04", "c6 0400"},
+		{"start again", "86 05 02", "c6 050002"},
+		{"clear", "86 06 02", "c6 060002"},
+		{"start after clear", "86 05 02", "7f 8624"},
+	}
+	i := testEventInstance(t)
+	for _, tt := range tests {
+		if _, received := exchange(i, tt.request); len(received) != 1 || received[0] != tt.want {
+			t.Errorf("%s: received %v, want %s", tt.name, received, tt.want)
+		}
+	}
+}
+
+func TestResponseOnEventPanic(t *testing.T) {
+	r := NewDIDRegistry()
+	r.Register(DataIdentifier{ID: 0x0200, Read: func(s *SessionManager) ([]byte, error) {
+		panic("broken DID")
+	}})
+	e := NewEventEngine()
+	e.Interval = 5 * time.Millisecond
+	e.TimerRates = map[byte]time.Duration{0x03: 20 * time.Millisecond}
+	i := newTestInstance(t, InstanceConfig{DataIdentifiers: r, Events: e})
+	ch, cancel := i.Events().Subscribe()
+	defer cancel()
+	exchange(i, "86 02 02 03 220200")
+	exchange(i, "86 05 02")
+	// the service of an event is answered like a request, a panic in its
+	// handler is a generalReject
+	if got := nextEvent(ch, 50*time.Millisecond); got != "7f 2210" {
+		t.Errorf("event %q, want %q", got, "7f 2210")
+	}
+}
+
+func TestResponseOnEventOccurrences(t *testing.T) {
+	i := testEventInstance(t)
+	ch, cancel := i.Events().Subscribe()
+	defer cancel()
+	// drain discards the messages of events occurring until none is sent
+	// for 30ms
+	drain := func() {
+		for nextEvent(ch, 30*time.Millisecond) != "" {
+		}
+	}
+	tests := []struct {
+		name    string
+		request string
+		// event is the next message sent for an event, empty when none is
+		// expected
+		event string
+	}{
+		{"extended session", "10 03", ""},
+		{"DID change", "86 03 02 0100 220100", ""},
+		{"start", "86 05 02", ""},
+		{"DID written", "2e 0100 0304", "62 01000304"},
+		{"DID written unchanged", "2e 0100 0304", ""},
+		{"tx disabled", "28 01 01", ""},
+		{"DID written while tx disabled", "2e 0100 0506", ""},
+		{"tx enabled", "28 00 01", ""},
+		{"timer set up while started", "86 02 02 03 3e00", "7e 00"},
+		{"stop", "86 00 02", ""},
+		{"DID written while stopped", "2e 0100 0708", ""},
+	}
+	for _, tt := range tests {
+		exchange(i, tt.request)
+		wait := 50 * time.Millisecond
+		if tt.event == "" {
+			wait = 30 * time.Millisecond
+		}
+		if got := nextEvent(ch, wait); got != tt.event {
+			t.Errorf("%s: event %q, want %q", tt.name, got, tt.event)
+		}
+	}
+
+	// entering the default session keeps the stored events only, and
+	// starts them again
+	for _, request := range []string{"86 06 02", "86 43 02 0100 220100", "86 02 02 03 3e00", "86 05 02", "10 01", "10 03"} {
+		exchange(i, request)
+	}
+	drain()
+	if events := i.Events().Events(); len(events) != 1 || events[0].EventType != 0x43 || !i.Events().Active() {
+		t.Errorf("events after the default session %+v, active %v", events, i.Events().Active())
+	}
+	exchange(i, "2e 0100 0909")
+	if got := nextEvent(ch, 50*time.Millisecond); got != "62 01000909" {
+		t.Errorf("stored event %q, want %q", got, "62 01000909")
+	}
+
+	// once the event window closes the final response reports how often
+	// the event occurred
+	exchange(i, "86 05 03")
+	exchange(i, "2e 0100 0a0a")
+	for _, want := range []string{"62 01000a0a", "c6 4301020100220100"} {
+		if got := nextEvent(ch, 100*time.Millisecond); got != want {
+			t.Errorf("event %q, want %q", got, want)
+		}
+	}
+	if i.Events().Active() {
+		t.Errorf("events active after the event window")
+	}
+}
@@ -6,10 +6,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/atredispartners/uds-zoo/uds/node/auth"
+	"github.com/atredispartners/uds-zoo/uds/node/dtc"
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
+	"github.com/atredispartners/uds-zoo/uds/node/sdt"
+	"github.com/atredispartners/uds-zoo/uds/node/security"
 	"github.com/atredispartners/uds-zoo/uds/store"
 	"github.com/atredispartners/uds-zoo/uds/uds"
 )
@@ -35,15 +44,164 @@ type InstanceConfig struct {
 	ListenerConfig ListenerConfig
 	Info           InstanceInfo
 	Service        Service
+	// Session holds the session and security access state, when nil a new
+	// SessionManager is used.
+	Session *SessionManager
+	// AccessPolicy is enforced before a request reaches its handler.
+	AccessPolicy AccessPolicy
+	// Authenticator serves the DefaultService Authentication handler, which
+	// is not supported when nil.
+	Authenticator *auth.Authenticator
+	// SecuredData serves the DefaultService SecuredDataTransmission handler,
+	// which is not supported when nil.
+	SecuredData *sdt.Layer
+	// Security sets the Seed and ValidKey hooks of the session that are
+	// not set yet, unlocking SecurityAccess levels with their algorithms.
+	Security security.Levels
+	// DataIdentifiers serves the DefaultService ReadDataByIdentifier,
+	// WriteDataByIdentifier and ReadScalingDataByIdentifier handlers, when nil
+	// a new DIDRegistry is used.
+	DataIdentifiers *DIDRegistry
+	// Memory is read and written by the DefaultService ReadMemoryByAddress
+	// and WriteMemoryByAddress handlers, no memory is accessible when nil.
+	Memory *memory.Map
+	// Transfers serves the DefaultService RequestDownload, RequestUpload,
+	// TransferData and RequestTransferExit handlers, transferring to and from
+	// Memory, when nil a new TransferEngine is used.
+	Transfers *TransferEngine
+	// Events serves the DefaultService ResponseOnEvent handler and the
+	// GET /events stream, when nil a new EventEngine is used.
+	Events *EventEngine
+	// Link serves the DefaultService CommunicationControl and LinkControl
+	// handlers, when nil a new Link at DefaultBaudRate is used.
+	Link *Link
+	// Routines serves the DefaultService RoutineControl handler, when nil a
+	// new RoutineRegistry is used.
+	Routines *RoutineRegistry
+	// DTCs is the DTC memory served by the DefaultService ReadDTCInformation,
+	// ClearDiagnosticInformation and ControlDTCSetting handlers, when nil an
+	// empty dtc.Store is used.
+	DTCs *dtc.Store
+	// S3ServerTimeout replaces the S3Timeout of the session, after which
+	// a non-default session without requests falls back to the default
+	// session. NoS3Timeout disables the timeout.
+	S3ServerTimeout time.Duration
+	// P2ServerMax is how long a handler may take to answer before the
+	// instance sends a responsePending negative response, DefaultP2ServerMax
+	// when zero.
+	P2ServerMax time.Duration
+	// P2StarServerMax is how long a handler may take to answer after a
+	// responsePending, DefaultP2StarServerMax when zero.
+	P2StarServerMax time.Duration
+	// Logger is handed to handlers through their Context, when nil the
+	// instance logs to stderr prefixed with its name.
+	Logger *log.Logger
 }
 
 // Instance is used to launch and handle incoming messages to a service.
 type Instance struct {
 	service   Service
 	info      InstanceInfo
-	sidRoutes map[byte]func([]byte) []byte
+	sidRoutes map[uds.SID]Handler
 	listener  ListenerConfig
 	httpGWURL string
+	session   *SessionManager
+	policy    AccessPolicy
+	memory    *memory.Map
+	dids      *DIDRegistry
+	dtcs      *dtc.Store
+	routines  *RoutineRegistry
+	transfers *TransferEngine
+	link      *Link
+	events    *EventEngine
+	auth      *auth.Authenticator
+	sdt       *sdt.Layer
+	logger    *log.Logger
+	p2        time.Duration
+	p2Star    time.Duration
+	// middleware wraps dispatch, Recover is always the outermost.
+	middleware []Middleware
+	// serving is the context of the request being served, guarded by mu.
+	serving *Context
+	// mu serializes request handling, handlers don't need their own locking.
+	mu sync.Mutex
+}
+
+func buildOrUseSessionManager(s *SessionManager, s3 time.Duration, levels security.Levels) *SessionManager {
+	if s == nil {
+		s = NewSessionManager()
+	}
+	if s3 != 0 {
+		s.S3Timeout = s3
+	}
+	if levels != nil {
+		if s.Hooks.Seed == nil {
+			s.Hooks.Seed = levels.Seed
+		}
+		if s.Hooks.ValidKey == nil {
+			s.Hooks.ValidKey = levels.ValidKey
+		}
+		if s.Hooks.SeedLength == nil {
+			s.Hooks.SeedLength = levels.SeedLength
+		}
+	}
+	return s
+}
+
+func buildOrUseDIDRegistry(r *DIDRegistry) *DIDRegistry {
+	if r == nil {
+		return NewDIDRegistry()
+	}
+	return r
+}
+
+func buildOrUseRoutineRegistry(r *RoutineRegistry) *RoutineRegistry {
+	if r == nil {
+		return NewRoutineRegistry()
+	}
+	return r
+}
+
+func buildOrUseTransferEngine(e *TransferEngine) *TransferEngine {
+	if e == nil {
+		return NewTransferEngine()
+	}
+	return e
+}
+
+func buildOrUseEventEngine(e *EventEngine) *EventEngine {
+	if e == nil {
+		return NewEventEngine()
+	}
+	return e
+}
+
+func buildOrUseLink(l *Link) *Link {
+	if l == nil {
+		return NewLink(DefaultBaudRate)
+	}
+	return l
+}
+
+func buildOrUseDTCStore(s *dtc.Store) *dtc.Store {
+	if s == nil {
+		return dtc.NewStore()
+	}
+	return s
+}
+
+func buildOrUseTiming(d time.Duration, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+func buildOrUseLogger(l *log.Logger, name string) *log.Logger {
+	if l == nil {
+		return log.New(os.Stderr, fmt.Sprintf("[%s] ", name), log.LstdFlags)
+	}
+	return l
 }
 
 func buildOrUseListenerConfig(c ListenerConfig, name string) ListenerConfig {
@@ -86,13 +244,7 @@ func NewInstance(c *InstanceConfig) (*Instance, error) {
 	if err := validateInstanceConfig(c); err != nil {
 		return nil, err
 	}
-	return &Instance{
-		info:      c.Info,
-		service:   c.Service,
-		sidRoutes: buildSIDRouting(c.Service),
-		listener:  c.ListenerConfig,
-		httpGWURL: c.ControllerURL,
-	}, nil
+	return newInstance(c, c.Service), nil
 }
 
 // NewInstanceWithDefaultService returns an instance that uses
@@ -103,24 +255,160 @@ func NewInstanceWithDefaultService(c *InstanceConfig) (*Instance, error) {
 	if err := validateInstanceConfig(c); err != nil {
 		return nil, err
 	}
-	return &Instance{
-		info:      c.Info,
-		service:   s,
-		sidRoutes: buildSIDRouting(s),
-		listener:  c.ListenerConfig,
-		httpGWURL: c.ControllerURL,
-	}, nil
+	return newInstance(c, s), nil
+}
+
+func newInstance(c *InstanceConfig, s Service) *Instance {
+	i := &Instance{
+		info:       c.Info,
+		service:    s,
+		sidRoutes:  buildSIDRouting(s),
+		listener:   c.ListenerConfig,
+		httpGWURL:  c.ControllerURL,
+		session:    buildOrUseSessionManager(c.Session, c.S3ServerTimeout, c.Security),
+		policy:     c.AccessPolicy,
+		memory:     c.Memory,
+		dids:       buildOrUseDIDRegistry(c.DataIdentifiers),
+		dtcs:       buildOrUseDTCStore(c.DTCs),
+		routines:   buildOrUseRoutineRegistry(c.Routines),
+		transfers:  buildOrUseTransferEngine(c.Transfers),
+		link:       buildOrUseLink(c.Link),
+		events:     buildOrUseEventEngine(c.Events),
+		auth:       c.Authenticator,
+		sdt:        c.SecuredData,
+		logger:     buildOrUseLogger(c.Logger, c.Info.Name),
+		p2:         buildOrUseTiming(c.P2ServerMax, DefaultP2ServerMax),
+		p2Star:     buildOrUseTiming(c.P2StarServerMax, DefaultP2StarServerMax),
+		middleware: []Middleware{Recover()},
+	}
+	// ControlDTCSetting only lasts until the default session is entered again
+	i.session.whenDefaultSession(func() { i.dtcs.SetEnabled(true) })
+	// transfers only run in the session they were requested in
+	i.session.whenDefaultSession(i.transfers.Abort)
+	// CommunicationControl and LinkControl end with the non-default session
+	i.session.whenDefaultSession(i.link.Reset)
+	i.events.bind(i)
+	i.session.setExpire(i.locked)
+	i.session.whenDefaultSession(i.events.Reset)
+	s.Bind(i)
+	return i
 }
 
 // AddHandler creates or overwrites an existing service handler for an SID.
 // Example:
-// i.AddHandler(0x27, func(data []byte) []byte {
+// i.AddHandler(uds.SecurityAccess, func(data []byte) []byte {
 //	return []byte{0x63, 0x41, 0x41}
 // })
-func (i *Instance) AddHandler(sid byte, handler func([]byte) []byte) {
+func (i *Instance) AddHandler(sid uds.SID, handler func([]byte) []byte) {
+	i.sidRoutes[sid] = LegacyHandler(handler)
+}
+
+// Handle creates or overwrites an existing service handler for an SID.
+// Example:
+// i.Handle(uds.TesterPresent, func(ctx *node.Context, req uds.Request) (uds.Response, error) {
+//	return uds.Response{SID: uds.PositiveResponseSID(req.SID), Data: []byte{0x00}}, nil
+// })
+func (i *Instance) Handle(sid uds.SID, handler Handler) {
 	i.sidRoutes[sid] = handler
 }
 
+// HandlerFunc is a service handler that reports negative responses as errors
+// instead of framing the 7F bytes itself. A uds.NegativeResponse keeps its
+// code, any other error is answered with generalReject.
+type HandlerFunc func([]byte) ([]byte, error)
+
+// AddHandlerFunc creates or overwrites an existing service handler for an SID.
+// Example:
+// i.AddHandlerFunc(uds.ReadDataByIdentifier, func(data []byte) ([]byte, error) {
+//	return nil, uds.ErrRequestOutOfRange
+// })
+func (i *Instance) AddHandlerFunc(sid uds.SID, handler HandlerFunc) {
+	i.sidRoutes[sid] = func(ctx *Context, req uds.Request) (uds.Response, error) {
+		resp, err := handler(req.Data)
+		return responseFromBytes(resp), err
+	}
+}
+
+// Logger returns the logger handed to handlers.
+func (i *Instance) Logger() *log.Logger {
+	return i.logger
+}
+
+// Session returns the session and security access state of the instance.
+// Positive DiagnosticSessionControl, ECUReset and SecurityAccess sendKey
+// responses update it, whichever handler sent them.
+func (i *Instance) Session() *SessionManager {
+	return i.session
+}
+
+// DataIdentifiers returns the DID registry of the instance.
+func (i *Instance) DataIdentifiers() *DIDRegistry {
+	return i.dids
+}
+
+// Routines returns the routine registry of the instance.
+func (i *Instance) Routines() *RoutineRegistry {
+	return i.routines
+}
+
+// Authenticator returns the authenticator of the instance, or nil.
+func (i *Instance) Authenticator() *auth.Authenticator {
+	return i.auth
+}
+
+// SecuredData returns the security sub-layer of the instance, or nil.
+func (i *Instance) SecuredData() *sdt.Layer {
+	return i.sdt
+}
+
+// Transfers returns the transfer engine of the instance.
+func (i *Instance) Transfers() *TransferEngine {
+	return i.transfers
+}
+
+// Events returns the ResponseOnEvent engine of the instance.
+func (i *Instance) Events() *EventEngine {
+	return i.events
+}
+
+// Link returns the simulated network connection of the instance.
+func (i *Instance) Link() *Link {
+	return i.link
+}
+
+// DTCs returns the DTC memory of the instance.
+func (i *Instance) DTCs() *dtc.Store {
+	return i.dtcs
+}
+
+// Memory returns the memory map of the instance, or nil.
+func (i *Instance) Memory() *memory.Map {
+	return i.memory
+}
+
+// Timing returns the P2 and P2* server timing of the instance.
+func (i *Instance) Timing() (p2 time.Duration, p2Star time.Duration) {
+	return i.p2, i.p2Star
+}
+
+// Use appends middleware wrapping the handling of every request. The first
+// middleware added is the outermost.
+// Example:
+// i.Use(node.Logging(), node.RateLimit(10, time.Second))
+func (i *Instance) Use(mws ...Middleware) {
+	i.middleware = append(i.middleware, mws...)
+}
+
+// AddAccessRules appends rules to the access policy of the instance.
+// Example:
+// i.AddAccessRules(node.AccessRule{
+//	SID:      uds.WriteMemoryByAddress,
+//	Sessions: []byte{uds.ProgrammingSession},
+// })
+func (i *Instance) AddAccessRules(rules ...AccessRule) {
+	i.policy = append(i.policy, rules...)
+}
+
 func buildListener(c *ListenerConfig) (net.Listener, error) {
 	switch c.Network {
 	case "unix":
@@ -160,6 +448,13 @@ func registerWithGateway(gwURL string, i *Instance) error {
 // Start launches an HTTP service for the instance bound an a unix socket.
 // The routes include:
 // POST /uds
+// GET /events
+//
+// A request whose handler is busy for longer than P2ServerMax is answered
+// with a stream of newline delimited JSON messages, the responsePending
+// negative responses followed by the final response. GET /events streams the
+// messages sent for ResponseOnEvent events the same way, for as long as the
+// client stays connected.
 func (i *Instance) Start() error {
 	s := http.Server{}
 	l, err := buildListener(&i.listener)
@@ -171,19 +466,45 @@ func (i *Instance) Start() error {
 	}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/uds", i.handleUDS)
+	mux.HandleFunc("/events", i.handleEvents)
 	s.Handler = mux
 	return s.Serve(l)
 }
 
-func buildSIDRouting(s Service) map[byte]func([]byte) []byte {
-	return map[byte]func([]byte) []byte{
-		uds.ReadMemoryByAddress:      s.ReadMemoryByAddress,
-		uds.DiagnosticSessionControl: s.DiagnosticSessionControl,
-		uds.ReadDataByIdentifier:     s.ReadDataByIdentifier,
+func buildSIDRouting(s Service) map[uds.SID]Handler {
+	return map[uds.SID]Handler{
+		uds.DiagnosticSessionControl:        LegacyHandler(s.DiagnosticSessionControl),
+		uds.ECUReset:                        LegacyHandler(s.ECUReset),
+		uds.SecurityAccess:                  LegacyHandler(s.SecurityAccess),
+		uds.CommunicationControl:            LegacyHandler(s.CommunicationControl),
+		uds.Authentication:                  LegacyHandler(s.Authentication),
+		uds.TesterPresent:                   LegacyHandler(s.TesterPresent),
+		uds.AccessTimingParameter:           LegacyHandler(s.AccessTimingParameter),
+		uds.SecuredDataTransmission:         LegacyHandler(s.SecuredDataTransmission),
+		uds.ControlDTCSetting:               LegacyHandler(s.ControlDTCSetting),
+		uds.ResponseOnEvent:                 LegacyHandler(s.ResponseOnEvent),
+		uds.LinkControl:                     LegacyHandler(s.LinkControl),
+		uds.ReadDataByIdentifier:            LegacyHandler(s.ReadDataByIdentifier),
+		uds.ReadMemoryByAddress:             LegacyHandler(s.ReadMemoryByAddress),
+		uds.ReadScalingDataByIdentifier:     LegacyHandler(s.ReadScalingDataByIdentifier),
+		uds.ReadDataByPeriodicIdentifier:    LegacyHandler(s.ReadDataByPeriodicIdentifier),
+		uds.DynamicallyDefineDataIdentifier: LegacyHandler(s.DynamicallyDefineDataIdentifier),
+		uds.WriteDataByIdentifier:           LegacyHandler(s.WriteDataByIdentifier),
+		uds.WriteMemoryByAddress:            LegacyHandler(s.WriteMemoryByAddress),
+		uds.ClearDiagnosticInformation:      LegacyHandler(s.ClearDiagnosticInformation),
+		uds.ReadDTCInformation:              LegacyHandler(s.ReadDTCInformation),
+		uds.InputOutputControlByIdentifier:  LegacyHandler(s.InputOutputControlByIdentifier),
+		uds.RoutineControl:                  LegacyHandler(s.RoutineControl),
+		uds.RequestDownload:                 LegacyHandler(s.RequestDownload),
+		uds.RequestUpload:                   LegacyHandler(s.RequestUpload),
+		uds.TransferData:                    LegacyHandler(s.TransferData),
+		uds.RequestTransferExit:             LegacyHandler(s.RequestTransferExit),
+		uds.RequestFileTransfer:             LegacyHandler(s.RequestFileTransfer),
 	}
 }
 
 func (i *Instance) handleUDS(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
 	req, err := udsReqFromHTTPRequest(r)
 	// TODO: We need to handle errors in a UDS sort of way.
 	// And allow the user to overwrite the handler.
@@ -191,32 +512,184 @@ func (i *Instance) handleUDS(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	f, ok := i.sidRoutes[req.SID]
-	if !ok {
-		// The provided SID was not in our sidRoutes, return Negative Response ServiceNotSupported 0x7F, req.SID , 0x11
-		resp := UDSHTTPRequestResponse{
-			SID:  hex.EncodeToString([]byte{uds.NR}),
-			Data: hex.EncodeToString(i.service.NotImplemented(req.SID)),
+	ctx := &Context{
+		Client:   clientFromHTTPRequest(r),
+		Session:  i.session,
+		Received: received,
+		Logger:   i.logger,
+		Instance: i,
+	}
+	streaming := false
+	udsResponse := i.respond(ctx, req, func(pending uds.Response) {
+		time.Sleep(i.link.TransmissionTime(len(pending.Data) + 1))
+		if !streaming {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			streaming = true
+		}
+		writeUDSHTTPResponse(w, pending)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	})
+	time.Sleep(i.link.TransmissionTime(len(udsResponse.Data) + 1))
+	if streaming {
+		// after a responsePending the final response is always sent
+		if len(udsResponse.Data) == 0 && udsResponse.SID == 0 {
+			udsResponse = negativeResponse(req.SID, uds.ErrGeneralReject)
 		}
-		json.NewEncoder(w).Encode(resp)
+		writeUDSHTTPResponse(w, udsResponse)
 		return
 	}
-	udsResponse := f(req.Data)
-	if len(udsResponse) < 1 {
+	if ctx.suppressed(udsResponse) {
+		// the positive response is suppressed, there is nothing to send
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if len(udsResponse.Data) == 0 && udsResponse.SID == 0 {
 		// TODO: This means we have a bad handler that's not returning data.
 		// Allow user to overwrite
 		http.Error(w, "UDS response was 0 length", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	writeUDSHTTPResponse(w, udsResponse)
+}
+
+func (i *Instance) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	events, unsubscribe := i.events.Subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case resp := <-events:
+			time.Sleep(i.link.TransmissionTime(len(resp.Data) + 1))
+			if err := writeUDSHTTPResponse(w, resp); err != nil {
+				return
+			}
+			flush()
+		}
+	}
+}
+
+func writeUDSHTTPResponse(w io.Writer, udsResponse uds.Response) error {
 	resp := UDSHTTPRequestResponse{
-		SID: hex.EncodeToString([]byte{udsResponse[0]}),
+		SID:  hex.EncodeToString([]byte{byte(udsResponse.SID)}),
+		Data: hex.EncodeToString(udsResponse.Data),
+	}
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// respond serves a request and returns the final response. While the handler
+// is busy pending receives a responsePending negative response after
+// P2ServerMax, and again each time P2StarServerMax is about to expire.
+func (i *Instance) respond(ctx *Context, req uds.Request, pending func(uds.Response)) uds.Response {
+	done := make(chan uds.Response, 1)
+	go func() {
+		done <- i.serve(ctx, req)
+	}()
+	// leave the tester P2ServerMax to receive the next responsePending
+	interval := i.p2Star - i.p2
+	if interval <= 0 {
+		interval = i.p2Star
 	}
-	if len(udsResponse) > 1 {
-		resp.Data = hex.EncodeToString(udsResponse[1:])
+	timer := time.NewTimer(i.p2)
+	defer timer.Stop()
+	for {
+		select {
+		case resp := <-done:
+			return resp
+		case <-timer.C:
+			pending(negativeResponse(req.SID, uds.ErrResponsePending))
+			timer.Reset(interval)
+		}
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+// serve passes a request through the middleware to its handler and turns
+// errors into negative responses.
+func (i *Instance) serve(ctx *Context, req uds.Request) uds.Response {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	// S3 is stopped while a request is handled and starts over once it is answered
+	i.session.stopS3()
+	defer i.session.startS3()
+	resp, err := i.handle(ctx, req)
+	if err != nil {
+		return negativeResponse(req.SID, err)
+	}
+	return resp
+}
+
+// handle passes a request through the middleware to its handler, with the
+// instance lock held.
+func (i *Instance) handle(ctx *Context, req uds.Request) (uds.Response, error) {
+	serving := i.serving
+	i.serving = ctx
+	defer func() { i.serving = serving }()
+	return chain(i.dispatch, i.middleware)(ctx, req)
+}
+
+// locked runs f holding the instance lock, so it does not interleave with a
+// request being served.
+func (i *Instance) locked(f func()) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f()
+}
+
+// dispatch enforces the access policy and routes a request to its handler.
+func (i *Instance) dispatch(ctx *Context, req uds.Request) (uds.Response, error) {
+	f, ok := i.sidRoutes[req.SID]
+	if !ok {
+		// The provided SID was not in our sidRoutes, return Negative Response ServiceNotSupported 0x7F, req.SID , 0x11
+		return responseFromBytes(i.service.NotImplemented(req.SID)), nil
+	}
+	if err := i.policy.Check(i.session, req.SID, req.Data); err != nil {
+		return uds.Response{}, err
+	}
+	if uds.Services[req.SID].HasSubFunction && len(req.Data) > 0 && req.Data[0]&0x80 != 0 {
+		// strip the suppressPosRspMsgIndicationBit, handlers get the bare sub-function
+		ctx.SuppressPositiveResponse = true
+		req.Data = append([]byte{req.Data[0] & 0x7F}, req.Data[1:]...)
+	}
+	resp, err := f(ctx, req)
+	if err != nil {
+		return uds.Response{}, err
+	}
+	i.session.observe(req.SID, resp.Bytes())
+	if req.SID == uds.ECUReset && resp.SID == uds.PositiveResponseSID(uds.ECUReset) {
+		// only what is kept in non-volatile memory survives a reset
+		i.dids.Reset()
+		i.routines.Reset()
+	}
+	return resp, nil
+}
+
+func negativeResponse(sid uds.SID, err error) uds.Response {
+	nr := uds.ToNegativeResponse(sid, err)
+	return uds.Response{SID: uds.NR, Data: []byte{byte(nr.SID), byte(nr.Code)}}
+}
+
+// clientFromHTTPRequest identifies the client that sent r, as forwarded by
+// the controller or else by its remote address.
+func clientFromHTTPRequest(r *http.Request) string {
+	if client := r.Header.Get(ClientHeader); client != "" {
+		return client
+	}
+	return r.RemoteAddr
 }
 
 func udsReqFromHTTPRequest(r *http.Request) (uds.Request, error) {
@@ -239,7 +712,7 @@ func udsReqFromHTTPRequest(r *http.Request) (uds.Request, error) {
 		return udsReq, errors.New("invalid Data hex value")
 	}
 
-	udsReq.SID = sid[0]
+	udsReq.SID = uds.SID(sid[0])
 	udsReq.Data = data
 
 	return udsReq, nil
@@ -0,0 +1,267 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/node/sdt"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// newTestInstance returns an instance serving DefaultService as configured
+// by c.
+func newTestInstance(t *testing.T, c InstanceConfig) *Instance {
+	t.Helper()
+	c.ControllerURL = "http://localhost:8888"
+	c.Info = InstanceInfo{ID: "0x01", Name: "Test"}
+	i, err := NewInstanceWithDefaultService(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+// exchange sends the request msg, in hex, to i as the controller does and
+// returns the status and the messages received as "sid data".
+func exchange(i *Instance, msg string) (int, []string) {
+	msg = strings.ReplaceAll(msg, " ", "")
+	body := fmt.Sprintf(`{"sid":%q,"data":%q}`, msg[:2], msg[2:])
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/uds", strings.NewReader(body))
+	r.Header.Set(ClientHeader, "tester")
+	i.handleUDS(w, r)
+	var received []string
+	dec := json.NewDecoder(w.Body)
+	for {
+		var m UDSHTTPRequestResponse
+		if dec.Decode(&m) != nil {
+			break
+		}
+		received = append(received, m.SID+" "+m.Data)
+	}
+	return w.Code, received
+}
+
+func TestSuppressPositiveResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		status  int
+		want    string
+		session byte
+	}{
+		{"tester present", "3e 00", http.StatusOK, "7e 00", uds.DefaultSession},
+		{"suppressed tester present", "3e 80", http.StatusNoContent, "", uds.DefaultSession},
+		{"suppressed session change", "10 83", http.StatusNoContent, "", uds.ExtendedDiagnosticSession},
+		{"suppressed negative response", "3e 80 00", http.StatusOK, "7f 3e13", uds.DefaultSession},
+		{"suppressed unsupported sub-function", "10 85", http.StatusOK, "7f 1012", uds.DefaultSession},
+		{"service without sub-function", "22 f1 90", http.StatusOK, "62 f190315544535a303030303030303030303031", uds.DefaultSession},
+	}
+	for _, tt := range tests {
+		i := newTestInstance(t, InstanceConfig{})
+		status, received := exchange(i, tt.request)
+		if status != tt.status || strings.Join(received, ", ") != tt.want {
+			t.Errorf("%s: %d %v, want %d %s", tt.name, status, received, tt.status, tt.want)
+		}
+		if got := i.Session().Session(); got != tt.session {
+			t.Errorf("%s: session 0x%02X, want 0x%02X", tt.name, got, tt.session)
+		}
+	}
+}
+
+func TestS3Timeout(t *testing.T) {
+	tests := []struct {
+		name string
+		s3   time.Duration
+		// requests are sent 30ms apart, starting right away
+		requests []string
+		// session is checked 60ms after the last request
+		session byte
+	}{
+		{"expired", 50 * time.Millisecond, []string{"10 03"}, uds.DefaultSession},
+		{"tester present", 50 * time.Millisecond, []string{"10 03", "3e 00", "3e 80"}, uds.DefaultSession},
+		{"disabled", -1, []string{"10 03"}, uds.ExtendedDiagnosticSession},
+		{"longer timeout", time.Second, []string{"10 03"}, uds.ExtendedDiagnosticSession},
+	}
+	for _, tt := range tests {
+		i := newTestInstance(t, InstanceConfig{S3ServerTimeout: tt.s3})
+		for n, request := range tt.requests {
+			if n > 0 {
+				time.Sleep(30 * time.Millisecond)
+				if got := i.Session().Session(); got != uds.ExtendedDiagnosticSession {
+					t.Errorf("%s: session 0x%02X before request %d", tt.name, got, n)
+				}
+			}
+			exchange(i, request)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if got := i.Session().Session(); got != tt.session {
+			t.Errorf("%s: session 0x%02X, want 0x%02X", tt.name, got, tt.session)
+		}
+	}
+}
+
+func TestS3ExpiryWaitsForRequest(t *testing.T) {
+	i := newTestInstance(t, InstanceConfig{S3ServerTimeout: 20 * time.Millisecond})
+	exchange(i, "10 03")
+	// the timer expires while a request is served, as serve does
+	i.mu.Lock()
+	time.Sleep(40 * time.Millisecond)
+	i.session.stopS3()
+	i.session.ChangeSession(uds.ProgrammingSession)
+	i.session.startS3()
+	i.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	if got := i.Session().Session(); got != uds.ProgrammingSession {
+		t.Errorf("session 0x%02X after the request, want 0x%02X", got, uds.ProgrammingSession)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if got := i.Session().Session(); got != uds.DefaultSession {
+		t.Errorf("session 0x%02X after S3, want 0x%02X", got, uds.DefaultSession)
+	}
+}
+
+func TestResponsePending(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		request string
+		want    string
+	}{
+		{"within P2", 0, "31 01 ff00", "71 01ff00"},
+		{"past P2", 30 * time.Millisecond, "31 01 ff00", "7f 3178, 71 01ff00"},
+		{"past P2*", 75 * time.Millisecond, "31 01 ff00", "7f 3178, 7f 3178, 71 01ff00"},
+		{"suppressed past P2", 30 * time.Millisecond, "31 81 ff00", "7f 3178, 71 01ff00"},
+		{"empty response past P2", 30 * time.Millisecond, "31 03 ff00", "7f 3178, 7f 3110"},
+	}
+	for _, tt := range tests {
+		// responsePending is sent after 20ms, then every 40ms
+		i := newTestInstance(t, InstanceConfig{P2ServerMax: 20 * time.Millisecond, P2StarServerMax: 60 * time.Millisecond})
+		delay := tt.delay
+		i.AddHandlerFunc(uds.RoutineControl, func(data []byte) ([]byte, error) {
+			time.Sleep(delay)
+			if data[0] == uds.RequestRoutineResults {
+				return nil, nil
+			}
+			return append([]byte{0x71}, data...), nil
+		})
+		_, received := exchange(i, tt.request)
+		if got := strings.Join(received, ", "); got != tt.want {
+			t.Errorf("%s: received %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionTiming(t *testing.T) {
+	i := newTestInstance(t, InstanceConfig{P2ServerMax: 20 * time.Millisecond, P2StarServerMax: 600 * time.Millisecond})
+	// P2ServerMax in ms and P2StarServerMax in 10ms
+	if _, received := exchange(i, "10 03"); strings.Join(received, ", ") != "50 030014003c" {
+		t.Errorf("received %v, want 50 030014003c", received)
+	}
+}
+
+func TestSecuredDataTransmission(t *testing.T) {
+	cipher := sdt.HMAC{Secret: []byte("secret")}
+	tests := []struct {
+		name    string
+		counter uint16
+		inner   string
+		// want is the internal response, or the negative response to the
+		// outer request
+		want string
+		// transcript is part of the internal request and response recorded
+		transcript string
+	}{
+		{"tester present", 1, "3e00", "7e 00", "tester TX: 3e 00\n"},
+		{"read", 2, "22f186", "62 f18601", "tester TX: 22 f186\n"},
+		{"negative", 3, "224242", "7f 2231", "tester RX: 7f 2231\n"},
+		{"nested", 4, "840000", "7f 8431", ""},
+		{"replayed", 3, "3e00", "7f 8433", ""},
+	}
+	out := new(bytes.Buffer)
+	i := newTestInstance(t, InstanceConfig{SecuredData: sdt.NewLayer(map[byte]sdt.Cipher{0x01: cipher})})
+	i.Use(Transcript(out))
+	for _, tt := range tests {
+		inner, _ := hex.DecodeString(tt.inner)
+		req := &uds.SecuredData{
+			AdministrativeParameter:        uds.SecuredRequestMessage | uds.SecuredMessageSigned | uds.SecuredResponseSignatureRequested,
+			SignatureEncryptionCalculation: 0x01,
+			AntiReplayCounter:              tt.counter,
+		}
+		cipher.Seal(req, inner)
+		record, _ := req.MarshalRecord()
+		out.Reset()
+		_, received := exchange(i, "84"+hex.EncodeToString(record))
+		if len(received) != 1 {
+			t.Errorf("%s: received %v", tt.name, received)
+			continue
+		}
+		if strings.HasPrefix(tt.want, "7f 84") {
+			// the outer request is refused
+			if received[0] != tt.want {
+				t.Errorf("%s: received %s, want %s", tt.name, received[0], tt.want)
+			}
+			continue
+		}
+		var resp uds.SecuredData
+		data, _ := hex.DecodeString(strings.TrimPrefix(received[0], "c4 "))
+		if err := resp.UnmarshalRecord(data); err != nil {
+			t.Errorf("%s: received %s: %v", tt.name, received[0], err)
+			continue
+		}
+		message, err := cipher.Open(&resp)
+		if err != nil || transcriptHex(message) != tt.want {
+			t.Errorf("%s: internal response %s, %v, want %s", tt.name, transcriptHex(message), err, tt.want)
+		}
+		if !strings.Contains(out.String(), tt.transcript) {
+			t.Errorf("%s: transcript\n%s\nmissing %s", tt.name, out, tt.transcript)
+		}
+	}
+}
+
+// levelService overrides ReadDataByIdentifier of the Service it embeds, like
+// the levels do.
+type levelService struct {
+	Service
+}
+
+func (l *levelService) ReadDataByIdentifier(payload []byte) []byte {
+	return []byte{0x62, 0x13, 0x37, 0x42}
+}
+
+func TestEmbeddedDefaultService(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"overridden", "22 f190", "62 133742"},
+		{"session", "10 03", "50 03003201f4"},
+		{"seed", "27 01", "67 01"},
+		{"routine", "31 01 ff00", "7f 3131"},
+	}
+	i, err := NewInstance(&InstanceConfig{
+		ControllerURL: "http://localhost:8888",
+		Info:          InstanceInfo{ID: "0x01", Name: "Test"},
+		Service:       &levelService{Service: &DefaultService{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		// seeds are random, only their presence is compared
+		if _, received := exchange(i, tt.request); len(received) != 1 || !strings.HasPrefix(received[0], tt.want) {
+			t.Errorf("%s: received %v, want %s", tt.name, received, tt.want)
+		}
+	}
+	if i.Session().Session() != uds.ExtendedDiagnosticSession {
+		t.Errorf("session 0x%02X, want the extended session", i.Session().Session())
+	}
+}
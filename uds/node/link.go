@@ -0,0 +1,197 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// Communication types, the low bits of a CommunicationControl
+// communicationType.
+const (
+	NormalMessages            byte = 0x01
+	NetworkManagementMessages byte = 0x02
+)
+
+// DefaultBaudRate is the baud rate of the CAN link of a new Link.
+const DefaultBaudRate = 500000
+
+// DefaultBaudRates lists the CAN baud rates a Link without BaudRates
+// transitions to.
+var DefaultBaudRates = []uint32{125000, 250000, 500000, 1000000}
+
+// FixedBaudRates maps the linkControlModeIdentifiers of
+// verifyModeTransitionWithFixedParameter to their baud rates.
+var FixedBaudRates = map[byte]uint32{
+	0x01: 9600,
+	0x02: 19200,
+	0x03: 38400,
+	0x04: 57600,
+	0x05: 115200,
+	0x10: 125000,
+	0x11: 250000,
+	0x12: 500000,
+	0x13: 1000000,
+}
+
+// canFrameBits is the length of a CAN frame with an 11 bit identifier and 8
+// data bytes, interframe space included and bit stuffing left out.
+const canFrameBits = 111
+
+// Link is the simulated network connection of an instance: which messages
+// it receives and transmits, switched with CommunicationControl, and the baud
+// rate of its CAN transport, switched with LinkControl. Outputs the tester did
+// not ask for, like periodic data and ResponseOnEvent, are only sent while
+// TxEnabled. Diagnostic requests are received whatever CommunicationControl
+// switched off. Entering the default session enables every message and
+// restores the initial baud rate.
+//
+// Example, a node starting at 250 kBit/s that may be switched to 500 kBit/s
+// for flashing and takes as long to answer as it would on the bus:
+//
+//	l := node.NewLink(250000)
+//	l.BaudRates = []uint32{250000, 500000}
+//	l.SimulateTiming = true
+type Link struct {
+	// BaudRates lists the baud rates LinkControl may transition to,
+	// DefaultBaudRates when nil.
+	BaudRates []uint32
+	// SimulateTiming delays every response by the time its ISO-TP frames
+	// take on the bus at the current baud rate. It is off by default,
+	// responses are sent right away whatever the baud rate.
+	SimulateTiming bool
+
+	mu       sync.Mutex
+	initial  uint32
+	baudRate uint32
+	// verified is the baud rate the next transitionMode switches to, zero
+	// when none was verified.
+	verified uint32
+	// rxDisabled and txDisabled hold the communication types switched off.
+	rxDisabled byte
+	txDisabled byte
+}
+
+// NewLink returns a link at baudRate, receiving and transmitting every
+// message.
+func NewLink(baudRate uint32) *Link {
+	return &Link{initial: baudRate, baudRate: baudRate}
+}
+
+// Control applies a CommunicationControl controlType to the communication
+// types set in communicationType, enhanced address information is not
+// supported.
+func (l *Link) Control(controlType byte, communicationType byte) error {
+	types := communicationType & (NormalMessages | NetworkManagementMessages)
+	if types == 0 {
+		return uds.ErrRequestOutOfRange
+	}
+	var rx, tx bool
+	switch controlType {
+	case 0x00:
+		rx, tx = true, true
+	case 0x01:
+		rx, tx = true, false
+	case 0x02:
+		rx, tx = false, true
+	case 0x03:
+		rx, tx = false, false
+	default:
+		return uds.ErrSubFunctionNotSupported
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rxDisabled = switchOff(l.rxDisabled, types, !rx)
+	l.txDisabled = switchOff(l.txDisabled, types, !tx)
+	return nil
+}
+
+func switchOff(disabled byte, types byte, off bool) byte {
+	if off {
+		return disabled | types
+	}
+	return disabled &^ types
+}
+
+// RxEnabled reports whether messages of communicationType are received.
+// Diagnostic requests always are.
+func (l *Link) RxEnabled(communicationType byte) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rxDisabled&communicationType == 0
+}
+
+// TxEnabled reports whether messages of communicationType are transmitted.
+// Responses to received requests always are.
+func (l *Link) TxEnabled(communicationType byte) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.txDisabled&communicationType == 0
+}
+
+// BaudRate returns the current baud rate.
+func (l *Link) BaudRate() uint32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.baudRate
+}
+
+// Verify checks that the link can transition to baudRate, which the next
+// Transition switches to.
+func (l *Link) Verify(baudRate uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rates := l.BaudRates
+	if rates == nil {
+		rates = DefaultBaudRates
+	}
+	for _, r := range rates {
+		if r == baudRate {
+			l.verified = baudRate
+			return nil
+		}
+	}
+	l.verified = 0
+	return uds.ErrRequestOutOfRange
+}
+
+// Transition switches to the verified baud rate, a verification is needed
+// before each transition.
+func (l *Link) Transition() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.verified == 0 {
+		return uds.ErrRequestSequenceError
+	}
+	l.baudRate, l.verified = l.verified, 0
+	return nil
+}
+
+// Reset enables every message and restores the initial baud rate.
+func (l *Link) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.baudRate = l.initial
+	l.verified = 0
+	l.rxDisabled = 0
+	l.txDisabled = 0
+}
+
+// TransmissionTime returns how long a message of n bytes, SID included, takes
+// on the bus as ISO-TP frames at the current baud rate, or zero without
+// SimulateTiming.
+func (l *Link) TransmissionTime(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.SimulateTiming || l.baudRate == 0 || n <= 0 {
+		return 0
+	}
+	frames := 1
+	if n > 7 {
+		// a first frame with 6 data bytes, a flow control frame and
+		// consecutive frames with 7 data bytes each
+		frames = 2 + (n-6+6)/7
+	}
+	return time.Duration(frames*canFrameBits) * time.Second / time.Duration(l.baudRate)
+}
@@ -0,0 +1,165 @@
+package node
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+func TestLinkControl(t *testing.T) {
+	tests := []struct {
+		name              string
+		controlType       byte
+		communicationType byte
+		// enabled holds whether normal and network management messages are
+		// received and transmitted: normal rx, normal tx, NM rx, NM tx
+		enabled [4]bool
+		nrc     uds.NRC
+	}{
+		{"enableRxAndTx", 0x00, NormalMessages, [4]bool{true, true, true, true}, 0},
+		{"enableRxAndDisableTx", 0x01, NormalMessages, [4]bool{true, false, true, true}, 0},
+		{"disableRxAndEnableTx", 0x02, NormalMessages, [4]bool{false, true, true, true}, 0},
+		{"disableRxAndTx", 0x03, NormalMessages, [4]bool{false, false, true, true}, 0},
+		{"network management", 0x03, NetworkManagementMessages, [4]bool{true, true, false, false}, 0},
+		{"both", 0x01, NormalMessages | NetworkManagementMessages, [4]bool{true, false, true, false}, 0},
+		{"no communication type", 0x03, 0x00, [4]bool{true, true, true, true}, uds.ROOR},
+		{"enhanced address information", 0x04, NormalMessages, [4]bool{true, true, true, true}, uds.SFNS},
+	}
+	for _, tt := range tests {
+		l := NewLink(DefaultBaudRate)
+		if err := l.Control(tt.controlType, tt.communicationType); nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+		}
+		got := [4]bool{l.RxEnabled(NormalMessages), l.TxEnabled(NormalMessages), l.RxEnabled(NetworkManagementMessages), l.TxEnabled(NetworkManagementMessages)}
+		if got != tt.enabled {
+			t.Errorf("%s: enabled %v, want %v", tt.name, got, tt.enabled)
+		}
+		l.Reset()
+		if !l.RxEnabled(NormalMessages|NetworkManagementMessages) || !l.TxEnabled(NormalMessages|NetworkManagementMessages) {
+			t.Errorf("%s: messages disabled after Reset", tt.name)
+		}
+	}
+}
+
+func TestRxDisabled(t *testing.T) {
+	// a flashing sequence, normal messages are switched off first
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"extended session", "10 03", "50 03003201f4"},
+		{"disableRxAndTx", "28 03 01", "68 03"},
+		{"read", "22 f186", "62 f18603"},
+		{"download", "34 00 44 00001000 00000002", "74 200402"},
+		{"block", "36 01 aabb", "76 01"},
+		{"exit", "37", "77 "},
+		{"routine", "31 01 ff00", "7f 3131"},
+		{"tester present", "3e 00", "7e 00"},
+	}
+	i := newTestInstance(t, InstanceConfig{Memory: testTransferMemory(t)})
+	for _, tt := range tests {
+		status, received := exchange(i, tt.request)
+		if status != http.StatusOK || strings.Join(received, ", ") != tt.want {
+			t.Errorf("%s: %d %v, want %s", tt.name, status, received, tt.want)
+		}
+	}
+	if i.Link().RxEnabled(NormalMessages) || i.Link().TxEnabled(NormalMessages) {
+		t.Errorf("normal messages enabled again")
+	}
+}
+
+func TestLinkTransition(t *testing.T) {
+	l := NewLink(250000)
+	l.BaudRates = []uint32{250000, 500000}
+	if err := l.Transition(); nrcOf(err) != uds.RSE {
+		t.Errorf("Transition without Verify = %v, want %v", err, uds.RSE)
+	}
+	if err := l.Verify(1000000); nrcOf(err) != uds.ROOR {
+		t.Errorf("Verify(1000000) = %v, want %v", err, uds.ROOR)
+	}
+	if err := l.Verify(500000); err != nil || l.BaudRate() != 250000 {
+		t.Errorf("Verify(500000) = %v, baud rate %d", err, l.BaudRate())
+	}
+	if err := l.Transition(); err != nil || l.BaudRate() != 500000 {
+		t.Errorf("Transition = %v, baud rate %d", err, l.BaudRate())
+	}
+	// a verification is needed before each transition
+	if err := l.Transition(); nrcOf(err) != uds.RSE {
+		t.Errorf("second Transition = %v, want %v", err, uds.RSE)
+	}
+	l.Verify(250000)
+	// a failed verification forgets the verified baud rate
+	l.Verify(9600)
+	if err := l.Transition(); nrcOf(err) != uds.RSE || l.BaudRate() != 500000 {
+		t.Errorf("Transition after failed Verify = %v, baud rate %d", err, l.BaudRate())
+	}
+	l.Reset()
+	if l.BaudRate() != 250000 {
+		t.Errorf("baud rate %d after Reset, want 250000", l.BaudRate())
+	}
+}
+
+func TestLinkTransmissionTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		simulate bool
+		baudRate uint32
+		n        int
+		want     time.Duration
+	}{
+		{"not simulated", false, 500000, 100, 0},
+		{"single frame", true, 500000, 7, 222 * time.Microsecond},
+		{"two consecutive frames", true, 500000, 14, 888 * time.Microsecond},
+		{"one consecutive frame", true, 500000, 13, 666 * time.Microsecond},
+		{"slower", true, 125000, 7, 888 * time.Microsecond},
+		{"empty", true, 500000, 0, 0},
+	}
+	for _, tt := range tests {
+		l := NewLink(tt.baudRate)
+		l.SimulateTiming = tt.simulate
+		if got := l.TransmissionTime(tt.n); got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommunicationControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		status  int
+		want    string
+	}{
+		{"default session", "28 03 01", http.StatusOK, "7f 287f"},
+		{"link control in default session", "87 01 12", http.StatusOK, "7f 877f"},
+		{"extended session", "10 03", http.StatusOK, "50 03003201f4"},
+		{"disableRxAndTx", "28 03 01", http.StatusOK, "68 03"},
+		{"received while rx disabled", "22 f186", http.StatusOK, "62 f18603"},
+		{"tester present", "3e 00", http.StatusOK, "7e 00"},
+		{"enableRxAndTx", "28 00 01", http.StatusOK, "68 00"},
+		{"received", "22 f186", http.StatusOK, "62 f18603"},
+		{"unsupported fixed baud rate", "87 01 42", http.StatusOK, "7f 8731"},
+		{"transition without verification", "87 03", http.StatusOK, "7f 8724"},
+		{"verify fixed", "87 01 13", http.StatusOK, "c7 01"},
+		{"transition", "87 03", http.StatusOK, "c7 03"},
+		{"verify specific", "87 02 03d090", http.StatusOK, "c7 02"},
+		{"unsupported specific", "87 02 000001", http.StatusOK, "7f 8731"},
+		{"disable rx again", "28 02 01", http.StatusOK, "68 02"},
+		{"default session again", "10 01", http.StatusOK, "50 01003201f4"},
+		{"received in default session", "22 f186", http.StatusOK, "62 f18601"},
+	}
+	i := newTestInstance(t, InstanceConfig{})
+	for _, tt := range tests {
+		status, received := exchange(i, tt.request)
+		if status != tt.status || strings.Join(received, ", ") != tt.want {
+			t.Errorf("%s: %d %v, want %d %s", tt.name, status, received, tt.status, tt.want)
+		}
+	}
+	if got := i.Link().BaudRate(); got != DefaultBaudRate {
+		t.Errorf("baud rate %d after the default session, want %d", got, DefaultBaudRate)
+	}
+}
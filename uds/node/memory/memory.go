@@ -0,0 +1,272 @@
+// Package memory models the address space of a node as a map of named
+// regions, so levels declare which memory is reachable, and when, instead of
+// range checking offsets into a flat byte slice by hand.
+//
+// Example, RAM readable by anyone and flash only writable in the programming
+// session after unlocking security level 0x01:
+//
+//	m, err := memory.NewMap(
+//		&memory.Region{Name: "ram", Kind: memory.RAM, Base: 0x1000, Data: make([]byte, 0x100)},
+//		&memory.Region{Name: "flash", Kind: memory.Flash, Base: 0x8000, Data: firmware,
+//			Write: memory.Access{Sessions: []byte{uds.ProgrammingSession}, SecurityLevel: 0x01}},
+//	)
+package memory
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// Kind is the type of memory backing a region.
+type Kind int
+
+const (
+	RAM Kind = iota
+	Flash
+	EEPROM
+	MMIO
+)
+
+func (k Kind) String() string {
+	switch k {
+	case RAM:
+		return "RAM"
+	case Flash:
+		return "Flash"
+	case EEPROM:
+		return "EEPROM"
+	case MMIO:
+		return "MMIO"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// State is the session, security access and authentication state accesses
+// are checked against, node.SessionManager implements it.
+type State interface {
+	Session() byte
+	IsUnlocked(level byte) bool
+	HasRole(role string) bool
+}
+
+// Access restricts reading or writing a region. The zero Access allows
+// anyone in any session.
+type Access struct {
+	// Denied forbids the access in every session.
+	Denied bool
+	// Sessions lists the sessions the access is allowed in, any session when empty.
+	Sessions []byte
+	// SecurityLevel is the requestSeed sub-function of the level that has to
+	// be unlocked, no security access is required when zero.
+	SecurityLevel byte
+	// Role has to be granted by Authentication, no authentication is
+	// required when empty.
+	Role string
+}
+
+// NoAccess forbids an access in every session.
+var NoAccess = Access{Denied: true}
+
+// Check returns the negative response for an access that is not allowed in
+// state s, ROOR for a denied access or the wrong session and SAD without the
+// security level or role. A nil state only passes unrestricted accesses.
+func (a Access) Check(s State) error {
+	if a.Denied {
+		return uds.ErrRequestOutOfRange
+	}
+	if len(a.Sessions) > 0 {
+		if s == nil || !containsByte(a.Sessions, s.Session()) {
+			return uds.ErrRequestOutOfRange
+		}
+	}
+	if a.SecurityLevel != 0 && (s == nil || !s.IsUnlocked(a.SecurityLevel)) {
+		return uds.ErrSecurityAccessDenied
+	}
+	if a.Role != "" && (s == nil || !s.HasRole(a.Role)) {
+		return uds.ErrSecurityAccessDenied
+	}
+	return nil
+}
+
+// Region is a contiguous block of memory starting at Base, Data holds its
+// content and sets its size.
+type Region struct {
+	Name  string
+	Kind  Kind
+	Base  uint64
+	Data  []byte
+	Read  Access
+	Write Access
+	// OnRead runs before data read from the region is returned and may change
+	// it, e.g. to simulate registers. offset is relative to Base.
+	OnRead func(r *Region, offset uint64, data []byte)
+	// OnWrite runs after data was written to the region at offset.
+	OnWrite func(r *Region, offset uint64, data []byte)
+}
+
+// Size returns the number of bytes in the region.
+func (r *Region) Size() uint64 {
+	return uint64(len(r.Data))
+}
+
+// End returns the address following the last byte of the region.
+func (r *Region) End() uint64 {
+	return r.Base + r.Size()
+}
+
+// contains reports whether size bytes at address are all inside the region.
+func (r *Region) contains(address uint64, size uint64) bool {
+	return address >= r.Base && size <= r.Size() && address-r.Base <= r.Size()-size
+}
+
+// Map is the address space of a node. Regions don't overlap and an access
+// has to stay within a single region.
+type Map struct {
+	mu      sync.Mutex
+	regions []*Region
+}
+
+// NewMap returns a map of regions, which must have unique names and must
+// not overlap.
+func NewMap(regions ...*Region) (*Map, error) {
+	m := &Map{}
+	for _, r := range regions {
+		if err := m.Add(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Add adds a region to the map.
+func (m *Map) Add(r *Region) error {
+	if r.End() < r.Base {
+		return fmt.Errorf("region %s wraps around the address space", r.Name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, x := range m.regions {
+		if x.Name == r.Name {
+			return fmt.Errorf("region %s already exists", r.Name)
+		}
+		if r.Base < x.End() && x.Base < r.End() {
+			return fmt.Errorf("region %s overlaps region %s", r.Name, x.Name)
+		}
+	}
+	m.regions = append(m.regions, r)
+	return nil
+}
+
+// Region returns the region called name, or nil.
+func (m *Map) Region(name string) *Region {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.regions {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Regions returns every region in the order they were added.
+func (m *Map) Regions() []*Region {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Region(nil), m.regions...)
+}
+
+// Find returns the region holding size bytes at address, or nil when they
+// are not mapped or span several regions.
+func (m *Map) Find(address uint64, size uint64) *Region {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.regions {
+		if r.contains(address, size) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Read returns a copy of size bytes at address if the region allows reading
+// them in state s. Unmapped memory and empty reads are out of range.
+func (m *Map) Read(s State, address uint64, size uint64) ([]byte, error) {
+	r := m.Find(address, size)
+	if r == nil || size == 0 {
+		return nil, uds.ErrRequestOutOfRange
+	}
+	if err := r.Read.Check(s); err != nil {
+		return nil, err
+	}
+	return m.read(r, address, size), nil
+}
+
+// Write stores data at address if the region allows writing it in state s.
+// Unmapped memory and empty writes are out of range.
+func (m *Map) Write(s State, address uint64, data []byte) error {
+	r := m.Find(address, uint64(len(data)))
+	if r == nil || len(data) == 0 {
+		return uds.ErrRequestOutOfRange
+	}
+	if err := r.Write.Check(s); err != nil {
+		return err
+	}
+	m.write(r, address, data)
+	return nil
+}
+
+// Peek reads memory like Read without checking any permission, for levels
+// reading their own state.
+func (m *Map) Peek(address uint64, size uint64) ([]byte, error) {
+	r := m.Find(address, size)
+	if r == nil {
+		return nil, uds.ErrRequestOutOfRange
+	}
+	return m.read(r, address, size), nil
+}
+
+// Poke writes memory like Write without checking any permission, for levels
+// updating their own state.
+func (m *Map) Poke(address uint64, data []byte) error {
+	r := m.Find(address, uint64(len(data)))
+	if r == nil {
+		return uds.ErrRequestOutOfRange
+	}
+	m.write(r, address, data)
+	return nil
+}
+
+// read copies memory under the lock, the hook runs without it so it may
+// access the map.
+func (m *Map) read(r *Region, address uint64, size uint64) []byte {
+	offset := address - r.Base
+	m.mu.Lock()
+	data := append([]byte(nil), r.Data[offset:offset+size]...)
+	m.mu.Unlock()
+	if r.OnRead != nil {
+		r.OnRead(r, offset, data)
+	}
+	return data
+}
+
+func (m *Map) write(r *Region, address uint64, data []byte) {
+	offset := address - r.Base
+	m.mu.Lock()
+	copy(r.Data[offset:], data)
+	m.mu.Unlock()
+	if r.OnWrite != nil {
+		r.OnWrite(r, offset, data)
+	}
+}
+
+func containsByte(list []byte, b byte) bool {
+	for _, x := range list {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+type state struct {
+	session  byte
+	unlocked byte
+	role     string
+}
+
+func (s state) Session() byte              { return s.session }
+func (s state) IsUnlocked(level byte) bool { return level == s.unlocked }
+func (s state) HasRole(role string) bool   { return role == s.role }
+
+func nrcOf(err error) uds.NRC {
+	if err == nil {
+		return 0
+	}
+	return uds.ToNegativeResponse(uds.ReadMemoryByAddress, err).Code
+}
+
+func testMap(t *testing.T) *Map {
+	m, err := NewMap(
+		&Region{Name: "ram", Kind: RAM, Base: 0x1000, Data: []byte{0x00, 0x11, 0x22, 0x33}},
+		&Region{Name: "flash", Kind: Flash, Base: 0x1004, Data: []byte{0xAA, 0xBB, 0xCC, 0xDD},
+			Read:  Access{Sessions: []byte{uds.ProgrammingSession}},
+			Write: Access{Sessions: []byte{uds.ProgrammingSession}, SecurityLevel: 0x01}},
+		&Region{Name: "secret", Kind: EEPROM, Base: 0x2000, Data: []byte{0x13, 0x37}, Read: NoAccess, Write: NoAccess},
+		&Region{Name: "calibration", Kind: EEPROM, Base: 0x3000, Data: []byte{0xC0, 0xDE}, Read: Access{Role: "engineer"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNewMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		regions []*Region
+		ok      bool
+	}{
+		{"adjacent", []*Region{{Name: "a", Base: 0x00, Data: make([]byte, 0x10)}, {Name: "b", Base: 0x10, Data: make([]byte, 0x10)}}, true},
+		{"overlapping", []*Region{{Name: "a", Base: 0x00, Data: make([]byte, 0x10)}, {Name: "b", Base: 0x0F, Data: make([]byte, 0x10)}}, false},
+		{"enclosing", []*Region{{Name: "a", Base: 0x04, Data: make([]byte, 0x04)}, {Name: "b", Base: 0x00, Data: make([]byte, 0x10)}}, false},
+		{"duplicate name", []*Region{{Name: "a", Base: 0x00, Data: make([]byte, 0x10)}, {Name: "a", Base: 0x10, Data: make([]byte, 0x10)}}, false},
+		{"wrapping around", []*Region{{Name: "a", Base: 0xFFFFFFFFFFFFFFF0, Data: make([]byte, 0x20)}}, false},
+	}
+	for _, tt := range tests {
+		_, err := NewMap(tt.regions...)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+	}
+}
+
+func TestMapRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   State
+		address uint64
+		size    uint64
+		want    []byte
+		nrc     uds.NRC
+	}{
+		{"ram", nil, 0x1001, 2, []byte{0x11, 0x22}, 0},
+		{"whole ram", state{}, 0x1000, 4, []byte{0x00, 0x11, 0x22, 0x33}, 0},
+		{"past ram", nil, 0x1003, 2, nil, uds.ROOR},
+		{"unmapped", nil, 0x0FFF, 1, nil, uds.ROOR},
+		{"empty", nil, 0x1000, 0, nil, uds.ROOR},
+		{"huge", nil, 0x1000, 0xFFFFFFFFFFFFFFFF, nil, uds.ROOR},
+		{"flash without state", nil, 0x1004, 1, nil, uds.ROOR},
+		{"flash in wrong session", state{session: uds.DefaultSession}, 0x1004, 1, nil, uds.ROOR},
+		{"flash in session", state{session: uds.ProgrammingSession}, 0x1004, 4, []byte{0xAA, 0xBB, 0xCC, 0xDD}, 0},
+		{"denied", state{session: uds.ProgrammingSession, unlocked: 0x01}, 0x2000, 2, nil, uds.ROOR},
+		{"role without state", nil, 0x3000, 2, nil, uds.SAD},
+		{"other role", state{role: "tester"}, 0x3000, 2, nil, uds.SAD},
+		{"role", state{role: "engineer"}, 0x3000, 2, []byte{0xC0, 0xDE}, 0},
+	}
+	m := testMap(t)
+	for _, tt := range tests {
+		got, err := m.Read(tt.state, tt.address, tt.size)
+		if nrcOf(err) != tt.nrc || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got % X, %v, want % X, %v", tt.name, got, err, tt.want, tt.nrc)
+		}
+	}
+}
+
+func TestMapWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   State
+		address uint64
+		data    []byte
+		nrc     uds.NRC
+	}{
+		{"ram", nil, 0x1002, []byte{0x01, 0x02}, 0},
+		{"spanning regions", nil, 0x1003, []byte{0x01, 0x02}, uds.ROOR},
+		{"empty", nil, 0x1000, nil, uds.ROOR},
+		{"flash in wrong session", state{session: uds.DefaultSession, unlocked: 0x01}, 0x1004, []byte{0x01}, uds.ROOR},
+		{"flash locked", state{session: uds.ProgrammingSession}, 0x1004, []byte{0x01}, uds.SAD},
+		{"flash unlocked", state{session: uds.ProgrammingSession, unlocked: 0x01}, 0x1006, []byte{0x01, 0x02}, 0},
+		{"denied", state{session: uds.ProgrammingSession, unlocked: 0x01}, 0x2000, []byte{0x01}, uds.ROOR},
+	}
+	for _, tt := range tests {
+		m := testMap(t)
+		err := m.Write(tt.state, tt.address, tt.data)
+		if nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, _ := m.Peek(tt.address, uint64(len(tt.data))); !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: wrote % X, want % X", tt.name, got, tt.data)
+		}
+	}
+}
+
+func TestMapPeekPokeHooks(t *testing.T) {
+	var written []byte
+	m, _ := NewMap(&Region{
+		Name: "mmio", Kind: MMIO, Base: 0x40, Data: make([]byte, 4), Read: NoAccess,
+		OnRead: func(r *Region, offset uint64, data []byte) {
+			// a counter register incrementing on every read
+			r.Data[3]++
+			data[len(data)-1] = r.Data[3]
+		},
+		OnWrite: func(r *Region, offset uint64, data []byte) {
+			written = append(written, byte(offset))
+		},
+	})
+	if err := m.Poke(0x42, []byte{0x55}); err != nil || !bytes.Equal(written, []byte{0x02}) {
+		t.Errorf("Poke = %v, OnWrite offsets % X", err, written)
+	}
+	for _, want := range []byte{0x01, 0x02} {
+		if got, err := m.Peek(0x40, 4); err != nil || !bytes.Equal(got, []byte{0x00, 0x00, 0x55, want}) {
+			t.Errorf("Peek = % X, %v", got, err)
+		}
+	}
+	if _, err := m.Peek(0x44, 1); nrcOf(err) != uds.ROOR {
+		t.Errorf("Peek past the region = %v", err)
+	}
+	if r := m.Find(0x41, 3); r == nil || r.Name != "mmio" || m.Region("mmio") != r {
+		t.Errorf("Find = %v", r)
+	}
+	if r := m.Find(0x41, 4); r != nil {
+		t.Errorf("Find past the region = %v", r.Name)
+	}
+}
@@ -0,0 +1,193 @@
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// Middleware wraps the handling of every request of an instance, including
+// requests for services without a handler. Returned errors are answered with
+// a negative response like errors of a Handler.
+type Middleware func(next Handler) Handler
+
+// chain wraps h with mws, the first middleware being the outermost.
+func chain(h Handler, mws []Middleware) Handler {
+	for n := len(mws) - 1; n >= 0; n-- {
+		h = mws[n](h)
+	}
+	return h
+}
+
+// Recover answers a request whose handler panicked with generalReject instead
+// of dropping the response. Instances install it by default.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx *Context, req uds.Request) (resp uds.Response, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					ctx.Logger.Printf("panic handling %s request %X: %v\n%s", req.SID, req.Bytes(), r, debug.Stack())
+					resp, err = uds.Response{}, uds.ErrGeneralReject
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
+
+// Logging logs every request and response with the client that sent it and
+// the time it took to answer.
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx *Context, req uds.Request) (uds.Response, error) {
+			resp, err := next(ctx, req)
+			if err != nil {
+				nr := uds.ToNegativeResponse(req.SID, err)
+				ctx.Logger.Printf("%s TX: %X RX: %X (%s) in %s", ctx.Client, req.Bytes(), nr.Bytes(), nr.Code, time.Since(ctx.Received))
+			} else if ctx.suppressed(resp) {
+				ctx.Logger.Printf("%s TX: %X RX: suppressed %X in %s", ctx.Client, req.Bytes(), resp.Bytes(), time.Since(ctx.Received))
+			} else {
+				ctx.Logger.Printf("%s TX: %X RX: %X in %s", ctx.Client, req.Bytes(), resp.Bytes(), time.Since(ctx.Received))
+			}
+			return resp, err
+		}
+	}
+}
+
+// RateLimit allows each client burst requests per interval, further requests
+// within the interval are answered with busyRepeatRequest.
+func RateLimit(burst int, interval time.Duration) Middleware {
+	l := &rateLimiter{burst: burst, interval: interval, windows: map[string]*rateWindow{}}
+	return func(next Handler) Handler {
+		return func(ctx *Context, req uds.Request) (uds.Response, error) {
+			if !l.allow(ctx.Client, ctx.Received) {
+				return uds.Response{}, uds.ErrBusyRepeatRequest
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// rateWindow counts the requests of a client since start.
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter tracks the window of every client that sent a request within
+// the last interval.
+type rateLimiter struct {
+	burst    int
+	interval time.Duration
+	mu       sync.Mutex
+	windows  map[string]*rateWindow
+	// pruned is when expired windows were last removed.
+	pruned time.Time
+}
+
+// allow counts a request of client received at now and reports whether it
+// is within the burst of its window.
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.pruned) >= l.interval {
+		for c, w := range l.windows {
+			if now.Sub(w.start) >= l.interval {
+				delete(l.windows, c)
+			}
+		}
+		l.pruned = now
+	}
+	w, ok := l.windows[client]
+	if !ok || now.Sub(w.start) >= l.interval {
+		w = &rateWindow{start: now}
+		l.windows[client] = w
+	}
+	w.count++
+	return w.count <= l.burst
+}
+
+// Fault describes an error injected by InjectFaults. SIDs limits the fault
+// to requests for these services, any request may fail when empty.
+type Fault struct {
+	SIDs []uds.SID
+	// Rate is the probability of a request failing, between 0 and 1.
+	Rate float64
+	// Delay is added before answering a failing request.
+	Delay time.Duration
+	// Err is returned for a failing request, generalReject when nil.
+	Err error
+}
+
+// InjectFaults fails requests at random as described by faults, the first
+// fault that triggers wins. Meant for levels that simulate a flaky ECU.
+func InjectFaults(faults ...Fault) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx *Context, req uds.Request) (uds.Response, error) {
+			for _, f := range faults {
+				if len(f.SIDs) > 0 && !containsSID(f.SIDs, req.SID) {
+					continue
+				}
+				if rand.Float64() >= f.Rate {
+					continue
+				}
+				time.Sleep(f.Delay)
+				if f.Err == nil {
+					return uds.Response{}, uds.ErrGeneralReject
+				}
+				return uds.Response{}, f.Err
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+func containsSID(list []uds.SID, sid uds.SID) bool {
+	for _, x := range list {
+		if x == sid {
+			return true
+		}
+	}
+	return false
+}
+
+// Transcript writes every exchange to w in the format used by the level
+// Readmes, prefixed with the time and client. Suppressed positive responses
+// have no RX line:
+//
+//	2021-10-12T10:00:00Z 127.0.0.1 TX: 22 1337
+//	2021-10-12T10:00:00Z 127.0.0.1 RX: 7f 2231
+func Transcript(w io.Writer) Middleware {
+	var mu sync.Mutex
+	return func(next Handler) Handler {
+		return func(ctx *Context, req uds.Request) (uds.Response, error) {
+			resp, err := next(ctx, req)
+			rx := resp.Bytes()
+			if err != nil {
+				rx = uds.ToNegativeResponse(req.SID, err).Bytes()
+			}
+			stamp := ctx.Received.UTC().Format(time.RFC3339)
+			mu.Lock()
+			fmt.Fprintf(w, "%s %s TX: %s\n", stamp, ctx.Client, transcriptHex(req.Bytes()))
+			if err != nil || !ctx.suppressed(resp) {
+				fmt.Fprintf(w, "%s %s RX: %s\n", stamp, ctx.Client, transcriptHex(rx))
+			}
+			mu.Unlock()
+			return resp, err
+		}
+	}
+}
+
+// transcriptHex formats a message as "sid data".
+func transcriptHex(b []byte) string {
+	if len(b) < 2 {
+		return hex.EncodeToString(b)
+	}
+	return hex.EncodeToString(b[:1]) + " " + hex.EncodeToString(b[1:])
+}
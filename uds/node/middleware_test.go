@@ -0,0 +1,156 @@
+package node
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+func testContext(client string, logs *bytes.Buffer) *Context {
+	return &Context{
+		Client:   client,
+		Session:  NewSessionManager(),
+		Received: time.Date(2021, 10, 12, 10, 0, 0, 0, time.UTC),
+		Logger:   log.New(logs, "", 0),
+	}
+}
+
+func echo(ctx *Context, req uds.Request) (uds.Response, error) {
+	return uds.Response{SID: uds.PositiveResponseSID(req.SID), Data: req.Data}, nil
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx *Context, req uds.Request) (uds.Response, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		}
+	}
+	h := chain(func(ctx *Context, req uds.Request) (uds.Response, error) {
+		order = append(order, "handler")
+		return echo(ctx, req)
+	}, []Middleware{mark("first"), mark("second")})
+	h(testContext("", new(bytes.Buffer)), uds.Request{SID: uds.TesterPresent, Data: []byte{0x00}})
+	if got := strings.Join(order, " "); got != "first second handler" {
+		t.Errorf("order = %q, want %q", got, "first second handler")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	panics := func(ctx *Context, req uds.Request) (uds.Response, error) {
+		panic("boom")
+	}
+	tests := []struct {
+		name    string
+		mw      Middleware
+		handler Handler
+		want    []byte
+		nrc     uds.NRC
+		logged  string
+	}{
+		{"recover passes responses", Recover(), echo, []byte{0x7E, 0x00}, 0, ""},
+		{"recover", Recover(), panics, nil, uds.GR, "panic handling TesterPresent request 3E00: boom"},
+		{"logging", Logging(), echo, []byte{0x7E, 0x00}, 0, "tester TX: 3E00 RX: 7E00 in "},
+		{"logging negative response", Logging(), func(ctx *Context, req uds.Request) (uds.Response, error) {
+			return uds.Response{}, uds.ErrConditionsNotCorrect
+		}, nil, uds.CNC, "tester TX: 3E00 RX: 7F3E22 (Conditions not correct) in "},
+		{"fault", InjectFaults(Fault{Rate: 1}), echo, nil, uds.GR, ""},
+		{"fault with error", InjectFaults(Fault{Rate: 1, Err: uds.ErrBusyRepeatRequest}), echo, nil, uds.BRR, ""},
+		{"fault for other service", InjectFaults(Fault{SIDs: []uds.SID{uds.ECUReset}, Rate: 1}), echo, []byte{0x7E, 0x00}, 0, ""},
+		{"fault never triggering", InjectFaults(Fault{Rate: 0}), echo, []byte{0x7E, 0x00}, 0, ""},
+	}
+	for _, tt := range tests {
+		logs := new(bytes.Buffer)
+		resp, err := chain(tt.handler, []Middleware{tt.mw})(testContext("tester", logs), uds.Request{SID: uds.TesterPresent, Data: []byte{0x00}})
+		if tt.nrc != 0 {
+			if nr := uds.ToNegativeResponse(uds.TesterPresent, err); err == nil || nr.Code != tt.nrc {
+				t.Errorf("%s: got %v, want %s", tt.name, err, tt.nrc)
+			}
+		} else if err != nil || !bytes.Equal(resp.Bytes(), tt.want) {
+			t.Errorf("%s: got % X, %v, want % X", tt.name, resp.Bytes(), err, tt.want)
+		}
+		if !strings.Contains(logs.String(), tt.logged) {
+			t.Errorf("%s: logged %q, want %q", tt.name, logs.String(), tt.logged)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := chain(echo, []Middleware{RateLimit(2, time.Second)})
+	tests := []struct {
+		client string
+		after  time.Duration
+		nrc    uds.NRC
+	}{
+		{"a", 0, 0},
+		{"a", 100 * time.Millisecond, 0},
+		{"a", 200 * time.Millisecond, uds.BRR},
+		{"b", 300 * time.Millisecond, 0},
+		{"a", 900 * time.Millisecond, uds.BRR},
+		{"a", time.Second, 0},
+	}
+	start := time.Now()
+	for n, tt := range tests {
+		ctx := testContext(tt.client, new(bytes.Buffer))
+		ctx.Received = start.Add(tt.after)
+		_, err := h(ctx, uds.Request{SID: uds.TesterPresent, Data: []byte{0x00}})
+		if got := nrcOf(err); got != tt.nrc {
+			t.Errorf("request %d of %s after %s: got %v, want %v", n, tt.client, tt.after, err, tt.nrc)
+		}
+	}
+}
+
+func TestRateLimitPrune(t *testing.T) {
+	l := &rateLimiter{burst: 1, interval: time.Second, windows: map[string]*rateWindow{}}
+	start := time.Now()
+	for _, client := range []string{"a", "b", "c"} {
+		l.allow(client, start)
+	}
+	l.allow("b", start.Add(500*time.Millisecond))
+	if len(l.windows) != 3 {
+		t.Errorf("%d windows within the interval, want 3", len(l.windows))
+	}
+	// the windows of clients without requests since are removed once expired
+	l.allow("d", start.Add(1500*time.Millisecond))
+	if len(l.windows) != 1 || l.windows["d"] == nil {
+		t.Errorf("windows %v after the interval, want d only", l.windows)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	out := new(bytes.Buffer)
+	h := chain(func(ctx *Context, req uds.Request) (uds.Response, error) {
+		if req.SID == uds.ReadDataByIdentifier {
+			return uds.Response{}, uds.ErrRequestOutOfRange
+		}
+		return echo(ctx, req)
+	}, []Middleware{Transcript(out)})
+	ctx := testContext("127.0.0.1", new(bytes.Buffer))
+	h(ctx, uds.Request{SID: uds.TesterPresent, Data: []byte{0x00}})
+	h(ctx, uds.Request{SID: uds.ReadDataByIdentifier, Data: []byte{0x13, 0x37}})
+	want := "2021-10-12T10:00:00Z 127.0.0.1 TX: 3e 00\n" +
+		"2021-10-12T10:00:00Z 127.0.0.1 RX: 7e 00\n" +
+		"2021-10-12T10:00:00Z 127.0.0.1 TX: 22 1337\n" +
+		"2021-10-12T10:00:00Z 127.0.0.1 RX: 7f 2231\n"
+	if out.String() != want {
+		t.Errorf("transcript\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestTranscriptSuppressed(t *testing.T) {
+	out := new(bytes.Buffer)
+	h := chain(echo, []Middleware{Transcript(out)})
+	ctx := testContext("127.0.0.1", new(bytes.Buffer))
+	ctx.SuppressPositiveResponse = true
+	h(ctx, uds.Request{SID: uds.TesterPresent, Data: []byte{0x00}})
+	if want := "2021-10-12T10:00:00Z 127.0.0.1 TX: 3e 00\n"; out.String() != want {
+		t.Errorf("transcript\n%s\nwant\n%s", out, want)
+	}
+}
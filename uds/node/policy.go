@@ -0,0 +1,132 @@
+package node
+
+import (
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// AccessRule restricts a service to a set of diagnostic sessions and a
+// security level. SubFunctions and DataIdentifiers narrow the rule down to
+// requests using one of them, when both are empty the whole service is
+// restricted.
+//
+// A request in the wrong session is answered with SNSIAS for a service rule,
+// SFNSIAS for a sub-function rule and ROOR for a data identifier rule. A
+// request without the security level or role is answered with SAD. NRC
+// replaces the code used for either failure.
+//
+// Example, the flag DID 0x1337 is only readable in the programming session
+// after unlocking security level 0x01:
+//
+//	node.AccessRule{
+//		SID:             uds.ReadDataByIdentifier,
+//		DataIdentifiers: []uint16{0x1337},
+//		Sessions:        []byte{uds.ProgrammingSession},
+//		SecurityLevel:   0x01,
+//	}
+type AccessRule struct {
+	SID             uds.SID
+	SubFunctions    []byte
+	DataIdentifiers []uint16
+	// Sessions lists the sessions the request is allowed in, any session when empty.
+	Sessions []byte
+	// SecurityLevel is the requestSeed sub-function of the level that has to
+	// be unlocked, no security access is required when zero.
+	SecurityLevel byte
+	// Role has to be granted by Authentication, no authentication is
+	// required when empty.
+	Role string
+	NRC  uds.NRC
+}
+
+// AccessPolicy is the list of rules enforced by an instance before a request
+// reaches its handler. Every matching rule has to be met.
+type AccessPolicy []AccessRule
+
+// Check returns the negative response for a request that is not allowed in
+// the current state of s, or nil.
+func (p AccessPolicy) Check(s *SessionManager, sid uds.SID, payload []byte) error {
+	for _, rule := range p {
+		if err := rule.check(s, sid, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AccessRule) check(s *SessionManager, sid uds.SID, payload []byte) error {
+	if r.SID != sid {
+		return nil
+	}
+	sessionCode := uds.SNSIAS
+	if len(r.SubFunctions) > 0 {
+		if !uds.Services[sid].HasSubFunction || len(payload) == 0 || !containsByte(r.SubFunctions, payload[0]&0x7F) {
+			return nil
+		}
+		sessionCode = uds.SFNSIAS
+	}
+	if len(r.DataIdentifiers) > 0 {
+		if !containsAnyUint16(r.DataIdentifiers, requestIdentifiers(sid, payload)) {
+			return nil
+		}
+		sessionCode = uds.ROOR
+	}
+	if len(r.Sessions) > 0 && !containsByte(r.Sessions, s.Session()) {
+		return uds.NewNegativeResponse(sid, r.code(sessionCode))
+	}
+	if r.SecurityLevel != 0 && !s.IsUnlocked(r.SecurityLevel) {
+		return uds.NewNegativeResponse(sid, r.code(uds.SAD))
+	}
+	if r.Role != "" && !s.HasRole(r.Role) {
+		return uds.NewNegativeResponse(sid, r.code(uds.SAD))
+	}
+	return nil
+}
+
+func (r *AccessRule) code(fallback uds.NRC) uds.NRC {
+	if r.NRC != 0 {
+		return r.NRC
+	}
+	return fallback
+}
+
+// requestIdentifiers returns the data or routine identifiers named in a
+// request payload.
+func requestIdentifiers(sid uds.SID, payload []byte) []uint16 {
+	switch sid {
+	case uds.ReadDataByIdentifier:
+		var ids []uint16
+		for i := 0; i+1 < len(payload); i += 2 {
+			ids = append(ids, uint16(payload[i])<<8|uint16(payload[i+1]))
+		}
+		return ids
+	case uds.WriteDataByIdentifier, uds.ReadScalingDataByIdentifier, uds.InputOutputControlByIdentifier:
+		if len(payload) >= 2 {
+			return []uint16{uint16(payload[0])<<8 | uint16(payload[1])}
+		}
+	case uds.RoutineControl:
+		if len(payload) >= 3 {
+			return []uint16{uint16(payload[1])<<8 | uint16(payload[2])}
+		}
+	}
+	return nil
+}
+
+func containsByte(list []byte, b byte) bool {
+	for _, x := range list {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyUint16(list []uint16, values []uint16) bool {
+	for _, v := range values {
+		for _, x := range list {
+			if x == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	policy := AccessPolicy{
+		{SID: uds.ReadDataByIdentifier, DataIdentifiers: []uint16{0x1337}, Sessions: []byte{uds.ProgrammingSession}, SecurityLevel: 0x01},
+		{SID: uds.ECUReset, SubFunctions: []byte{uds.HardReset}, Sessions: []byte{uds.ExtendedDiagnosticSession}},
+		{SID: uds.WriteMemoryByAddress, Sessions: []byte{uds.ProgrammingSession}},
+		{SID: uds.RoutineControl, DataIdentifiers: []uint16{0xFF00}, SecurityLevel: 0x03, NRC: uds.CNC},
+	}
+	tests := []struct {
+		name     string
+		session  byte
+		unlocked byte
+		sid      uds.SID
+		payload  []byte
+		nrc      uds.NRC
+	}{
+		{"other DID", uds.DefaultSession, 0, uds.ReadDataByIdentifier, []byte{0xF1, 0x90}, 0},
+		{"DID in wrong session", uds.DefaultSession, 0, uds.ReadDataByIdentifier, []byte{0x13, 0x37}, uds.ROOR},
+		{"DID among others", uds.DefaultSession, 0, uds.ReadDataByIdentifier, []byte{0xF1, 0x90, 0x13, 0x37}, uds.ROOR},
+		{"DID locked", uds.ProgrammingSession, 0, uds.ReadDataByIdentifier, []byte{0x13, 0x37}, uds.SAD},
+		{"DID unlocked", uds.ProgrammingSession, 0x01, uds.ReadDataByIdentifier, []byte{0x13, 0x37}, 0},
+		{"sub-function in wrong session", uds.DefaultSession, 0, uds.ECUReset, []byte{0x01}, uds.SFNSIAS},
+		{"suppressed sub-function in wrong session", uds.DefaultSession, 0, uds.ECUReset, []byte{0x81}, uds.SFNSIAS},
+		{"sub-function in session", uds.ExtendedDiagnosticSession, 0, uds.ECUReset, []byte{0x01}, 0},
+		{"other sub-function", uds.DefaultSession, 0, uds.ECUReset, []byte{0x03}, 0},
+		{"service in wrong session", uds.ExtendedDiagnosticSession, 0, uds.WriteMemoryByAddress, []byte{0x11, 0x50, 0x01, 0x00}, uds.SNSIAS},
+		{"service in session", uds.ProgrammingSession, 0, uds.WriteMemoryByAddress, []byte{0x11, 0x50, 0x01, 0x00}, 0},
+		{"routine with NRC", uds.DefaultSession, 0, uds.RoutineControl, []byte{0x01, 0xFF, 0x00}, uds.CNC},
+		{"routine unlocked", uds.DefaultSession, 0x03, uds.RoutineControl, []byte{0x01, 0xFF, 0x00}, 0},
+		{"other routine", uds.DefaultSession, 0, uds.RoutineControl, []byte{0x01, 0xFF, 0x01}, 0},
+		{"unrestricted service", uds.DefaultSession, 0, uds.TesterPresent, []byte{0x00}, 0},
+	}
+	for _, tt := range tests {
+		s := NewSessionManager()
+		s.ChangeSession(tt.session)
+		if tt.unlocked != 0 {
+			s.Unlock(tt.unlocked)
+		}
+		err := policy.Check(s, tt.sid, tt.payload)
+		if tt.nrc == 0 {
+			if err != nil {
+				t.Errorf("%s: got %v, want allowed", tt.name, err)
+			}
+			continue
+		}
+		if nr := uds.ToNegativeResponse(tt.sid, err); err == nil || nr.Code != tt.nrc || nr.SID != tt.sid {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.nrc)
+		}
+	}
+}
+
+func TestAccessPolicyRole(t *testing.T) {
+	policy := AccessPolicy{
+		{SID: uds.WriteDataByIdentifier, Role: "engineer"},
+		{SID: uds.ReadDataByIdentifier, DataIdentifiers: []uint16{0x1337}, Role: "engineer", SecurityLevel: 0x01},
+	}
+	tests := []struct {
+		name     string
+		roles    []string
+		unlocked byte
+		sid      uds.SID
+		payload  []byte
+		nrc      uds.NRC
+	}{
+		{"unauthenticated", nil, 0, uds.WriteDataByIdentifier, []byte{0xF1, 0x90, 0x00}, uds.SAD},
+		{"other role", []string{"tester"}, 0, uds.WriteDataByIdentifier, []byte{0xF1, 0x90, 0x00}, uds.SAD},
+		{"role", []string{"tester", "engineer"}, 0, uds.WriteDataByIdentifier, []byte{0xF1, 0x90, 0x00}, 0},
+		{"role and level locked", []string{"engineer"}, 0, uds.ReadDataByIdentifier, []byte{0x13, 0x37}, uds.SAD},
+		{"level without role", nil, 0x01, uds.ReadDataByIdentifier, []byte{0x13, 0x37}, uds.SAD},
+		{"role and level", []string{"engineer"}, 0x01, uds.ReadDataByIdentifier, []byte{0x13, 0x37}, 0},
+	}
+	for _, tt := range tests {
+		s := NewSessionManager()
+		s.Authenticate(tt.roles...)
+		if tt.unlocked != 0 {
+			s.Unlock(tt.unlocked)
+		}
+		if err := policy.Check(s, tt.sid, tt.payload); nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+		}
+	}
+}
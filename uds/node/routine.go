@@ -0,0 +1,225 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// Routine describes a routine served by a RoutineRegistry.
+type Routine struct {
+	ID   uint16
+	Name string
+	// Start runs the routine with the routineControlOptionRecord of the
+	// startRoutine request and returns its results. The routine is running
+	// until Start returns, ctx is cancelled by stopRoutine and ECUReset. A
+	// panic in Start is answered with generalReject.
+	Start func(ctx context.Context, s *SessionManager, options []byte) ([]byte, error)
+	// Async answers startRoutine with StartStatus right away while Start
+	// keeps running. Otherwise startRoutine waits for Start, the instance
+	// sends responsePending and serves no other request meanwhile, and
+	// answers with its results.
+	Async bool
+	// StartStatus is the routineStatusRecord of an Async startRoutine
+	// response.
+	StartStatus []byte
+	// Stop returns the routineStatusRecord of a stopRoutine response after
+	// the running routine was cancelled and returned. An empty record is sent
+	// when nil.
+	Stop func(s *SessionManager, options []byte) ([]byte, error)
+	// Results returns the routineStatusRecord of a requestRoutineResults
+	// response from the results of Start, which are sent as is when nil.
+	Results func(s *SessionManager, results []byte, options []byte) ([]byte, error)
+	// Access restricts every sub-function of the routine.
+	Access memory.Access
+}
+
+// routineRun is the state of the last start of a routine.
+type routineRun struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	results []byte
+	err     error
+}
+
+func (run *routineRun) running() bool {
+	select {
+	case <-run.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// RoutineRegistry holds the routines served by the DefaultService
+// RoutineControl handler and tracks whether they are running.
+//
+// Example, an erase routine that takes 3 seconds and reports success with
+// routineInfo 0x00, the tester receives responsePending while it runs:
+//
+//	i.Routines().Register(node.Routine{
+//		ID:   0xFF00,
+//		Name: "EraseMemory",
+//		Start: func(ctx context.Context, s *node.SessionManager, options []byte) ([]byte, error) {
+//			select {
+//			case <-time.After(3 * time.Second):
+//				return []byte{0x00}, nil
+//			case <-ctx.Done():
+//				return nil, uds.ErrGeneralProgrammingFailure
+//			}
+//		},
+//		Access: memory.Access{Sessions: []byte{uds.ProgrammingSession}, SecurityLevel: 0x01},
+//	})
+type RoutineRegistry struct {
+	mu       sync.Mutex
+	routines map[uint16]*Routine
+	runs     map[uint16]*routineRun
+}
+
+// NewRoutineRegistry returns an empty registry.
+func NewRoutineRegistry() *RoutineRegistry {
+	return &RoutineRegistry{
+		routines: map[uint16]*Routine{},
+		runs:     map[uint16]*routineRun{},
+	}
+}
+
+// Register adds routines to the registry, replacing any routine with the
+// same ID.
+func (r *RoutineRegistry) Register(routines ...Routine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n := range routines {
+		routine := routines[n]
+		r.routines[routine.ID] = &routine
+	}
+}
+
+// Unregister removes the routines with the given IDs, cancelling them when
+// running.
+func (r *RoutineRegistry) Unregister(ids ...uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		if run, ok := r.runs[id]; ok {
+			run.cancel()
+		}
+		delete(r.routines, id)
+		delete(r.runs, id)
+	}
+}
+
+// IDs returns the ID of every registered routine in ascending order.
+func (r *RoutineRegistry) IDs() []uint16 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]uint16, 0, len(r.routines))
+	for id := range r.routines {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	return ids
+}
+
+// Running reports whether the routine with the given ID is running.
+func (r *RoutineRegistry) Running(id uint16) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[id]
+	return ok && run.running()
+}
+
+// Control answers a RoutineControl request with the routineStatusRecord of
+// the positive response. Unknown routines and routines not available in the
+// active session are out of range. Starting a running routine is refused
+// with conditionsNotCorrect, stopping a routine that is not running and
+// requesting results of a routine that was never started or is still
+// running are a requestSequenceError.
+func (r *RoutineRegistry) Control(s *SessionManager, controlType byte, id uint16, options []byte) ([]byte, error) {
+	r.mu.Lock()
+	routine, ok := r.routines[id]
+	run := r.runs[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil, uds.ErrRequestOutOfRange
+	}
+	if err := routine.Access.Check(s); err != nil {
+		return nil, err
+	}
+	switch controlType {
+	case uds.StartRoutine:
+		return r.start(s, routine, options)
+	case uds.StopRoutine:
+		if run == nil || !run.running() {
+			return nil, uds.ErrRequestSequenceError
+		}
+		run.cancel()
+		<-run.done
+		if routine.Stop == nil {
+			return nil, nil
+		}
+		return routine.Stop(s, options)
+	case uds.RequestRoutineResults:
+		if run == nil || run.running() {
+			return nil, uds.ErrRequestSequenceError
+		}
+		if run.err != nil {
+			return nil, run.err
+		}
+		if routine.Results == nil {
+			return append([]byte(nil), run.results...), nil
+		}
+		return routine.Results(s, run.results, options)
+	}
+	return nil, uds.ErrSubFunctionNotSupported
+}
+
+func (r *RoutineRegistry) start(s *SessionManager, routine *Routine, options []byte) ([]byte, error) {
+	if routine.Start == nil {
+		return nil, uds.ErrSubFunctionNotSupported
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &routineRun{done: make(chan struct{}), cancel: cancel}
+	r.mu.Lock()
+	if last, ok := r.runs[routine.ID]; ok && last.running() {
+		r.mu.Unlock()
+		cancel()
+		return nil, uds.ErrConditionsNotCorrect
+	}
+	r.runs[routine.ID] = run
+	r.mu.Unlock()
+	options = append([]byte(nil), options...)
+	go func() {
+		defer close(run.done)
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				run.results, run.err = nil, fmt.Errorf("routine 0x%04X panicked: %v", routine.ID, r)
+			}
+		}()
+		run.results, run.err = routine.Start(ctx, s, options)
+	}()
+	if routine.Async {
+		return append([]byte(nil), routine.StartStatus...), nil
+	}
+	<-run.done
+	if run.err != nil {
+		return nil, run.err
+	}
+	return append([]byte(nil), run.results...), nil
+}
+
+// Reset cancels every running routine and forgets all results, as done
+// after a positive ECUReset response.
+func (r *RoutineRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, run := range r.runs {
+		run.cancel()
+		delete(r.runs, id)
+	}
+}
@@ -0,0 +1,134 @@
+package node
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// exchangeWithin is exchange failing the test when i takes longer than a
+// second to answer, instead of hanging on a deadlock.
+func exchangeWithin(t *testing.T, i *Instance, msg string) string {
+	t.Helper()
+	done := make(chan []string, 1)
+	go func() {
+		_, received := exchange(i, msg)
+		done <- received
+	}()
+	select {
+	case received := <-done:
+		return strings.Join(received, ", ")
+	case <-time.After(time.Second):
+		t.Fatalf("%s: no response", msg)
+		return ""
+	}
+}
+
+// untilCancelled is a routine running until it is stopped.
+func untilCancelled(ctx context.Context, s *SessionManager, options []byte) ([]byte, error) {
+	<-ctx.Done()
+	return nil, uds.ErrGeneralProgrammingFailure
+}
+
+func testRoutines() *RoutineRegistry {
+	r := NewRoutineRegistry()
+	r.Register(
+		Routine{
+			ID:          0x0001,
+			Start:       untilCancelled,
+			Async:       true,
+			StartStatus: []byte{0x00},
+			Stop: func(s *SessionManager, options []byte) ([]byte, error) {
+				return []byte{0x01}, nil
+			},
+		},
+		Routine{
+			ID: 0x0002,
+			Start: func(ctx context.Context, s *SessionManager, options []byte) ([]byte, error) {
+				return options, nil
+			},
+			Results: func(s *SessionManager, results []byte, options []byte) ([]byte, error) {
+				return append(results, options...), nil
+			},
+		},
+		Routine{ID: 0x0003, Start: untilCancelled, Access: memory.Access{SecurityLevel: 0x01}},
+		Routine{
+			ID: 0x0004,
+			Start: func(ctx context.Context, s *SessionManager, options []byte) ([]byte, error) {
+				return nil, uds.ErrConditionsNotCorrect
+			},
+		},
+		Routine{
+			ID: 0x0005,
+			Start: func(ctx context.Context, s *SessionManager, options []byte) ([]byte, error) {
+				time.Sleep(40 * time.Millisecond)
+				return []byte{0x01}, nil
+			},
+		},
+		Routine{ID: 0x0006},
+		Routine{
+			ID: 0x0007,
+			Start: func(ctx context.Context, s *SessionManager, options []byte) ([]byte, error) {
+				panic("broken routine")
+			},
+		},
+	)
+	return r
+}
+
+func TestRoutineControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"start async", "31 01 0001", "71 01000100"},
+		{"start running", "31 01 0001", "7f 3122"},
+		{"results while running", "31 03 0001", "7f 3124"},
+		{"served while running", "3e 00", "7e 00"},
+		{"session change while running", "10 03", "50 03003201f4"},
+		{"stop", "31 02 0001", "71 02000101"},
+		{"stop stopped", "31 02 0001", "7f 3124"},
+		{"results of stopped", "31 03 0001", "7f 3172"},
+		{"results never started", "31 03 0002", "7f 3124"},
+		{"start", "31 01 0002 aa", "71 010002aa"},
+		{"results", "31 03 0002 bb", "71 030002aabb"},
+		{"failing", "31 01 0004", "7f 3122"},
+		{"panicking", "31 01 0007", "7f 3110"},
+		{"results of panicked", "31 03 0007", "7f 3110"},
+		{"locked", "31 01 0003", "7f 3133"},
+		{"unknown", "31 01 4242", "7f 3131"},
+		{"without start", "31 01 0006", "7f 3112"},
+		{"unknown sub-function", "31 04 0002", "7f 3112"},
+		{"start before reset", "31 01 0001", "71 01000100"},
+		{"reset", "11 01", "51 01"},
+		{"results after reset", "31 03 0001", "7f 3124"},
+		{"start after reset", "31 01 0001", "71 01000100"},
+	}
+	i := newTestInstance(t, InstanceConfig{Routines: testRoutines()})
+	for _, tt := range tests {
+		if got := exchangeWithin(t, i, tt.request); got != tt.want {
+			t.Errorf("%s: received %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoutineStartPending(t *testing.T) {
+	i := newTestInstance(t, InstanceConfig{Routines: testRoutines(), P2ServerMax: 10 * time.Millisecond})
+	started := make(chan string, 1)
+	go func() {
+		started <- exchangeWithin(t, i, "31 01 0005")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// requests are served one at a time, the tester waits for the start
+	if got := exchangeWithin(t, i, "3e 00"); got != "7f 3e78, 7e 00" {
+		t.Errorf("tester present received %s, want 7f 3e78, 7e 00", got)
+	}
+	if got := <-started; got != "7f 3178, 71 01000501" {
+		t.Errorf("start received %s, want 7f 3178, 71 01000501", got)
+	}
+}
@@ -0,0 +1,119 @@
+package sdt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// HMAC signs internal messages with HMAC-SHA256 under Secret, truncated to
+// Length bytes when Length is between 1 and 32. It does not encrypt, and
+// requires requests to be signed.
+type HMAC struct {
+	Secret []byte
+	Length int
+}
+
+// Open verifies the signature of the header and internal message of s.
+func (c HMAC) Open(s *uds.SecuredData) ([]byte, error) {
+	if s.AdministrativeParameter&uds.SecuredMessageEncrypted != 0 {
+		return nil, uds.ErrRequestOutOfRange
+	}
+	if s.AdministrativeParameter&uds.SecuredMessageSigned == 0 || !hmac.Equal(c.sign(s), s.Signature) {
+		return nil, uds.ErrSecurityAccessDenied
+	}
+	return s.Message, nil
+}
+
+// Seal signs message in the clear.
+func (c HMAC) Seal(s *uds.SecuredData, message []byte) error {
+	if s.AdministrativeParameter&uds.SecuredMessageEncrypted != 0 {
+		return uds.ErrRequestOutOfRange
+	}
+	s.Message = message
+	s.Signature = c.sign(s)
+	return nil
+}
+
+func (c HMAC) sign(s *uds.SecuredData) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write(s.Header())
+	mac.Write(s.Message)
+	sum := mac.Sum(nil)
+	if c.Length > 0 && c.Length < len(sum) {
+		sum = sum[:c.Length]
+	}
+	return sum
+}
+
+// GCM encrypts internal messages with AES-GCM under the 16, 24 or 32 byte
+// Key, the 16 byte tag being the signature. Messages that are signed but not
+// encrypted are authenticated only, with GMAC. The nonce is the header padded
+// with zeros, so it repeats once the anti-replay counter wraps around.
+type GCM struct {
+	Key []byte
+}
+
+// Open decrypts and verifies the internal message of s.
+func (c GCM) Open(s *uds.SecuredData) ([]byte, error) {
+	if s.AdministrativeParameter&(uds.SecuredMessageEncrypted|uds.SecuredMessageSigned) == 0 {
+		return nil, uds.ErrSecurityAccessDenied
+	}
+	aead, err := c.aead()
+	if err != nil {
+		return nil, err
+	}
+	header := s.Header()
+	if s.AdministrativeParameter&uds.SecuredMessageEncrypted == 0 {
+		// GMAC, the tag covers the message in the clear
+		if _, err := aead.Open(nil, nonce(aead, header), s.Signature, append(header, s.Message...)); err != nil {
+			return nil, uds.ErrSecurityAccessDenied
+		}
+		return s.Message, nil
+	}
+	sealed := append(append([]byte(nil), s.Message...), s.Signature...)
+	message, err := aead.Open(nil, nonce(aead, header), sealed, header)
+	if err != nil {
+		return nil, uds.ErrSecurityAccessDenied
+	}
+	return message, nil
+}
+
+// Seal encrypts message, or only authenticates it when s is not encrypted.
+func (c GCM) Seal(s *uds.SecuredData, message []byte) error {
+	aead, err := c.aead()
+	if err != nil {
+		return err
+	}
+	header := s.Header()
+	if s.AdministrativeParameter&uds.SecuredMessageEncrypted == 0 {
+		s.Message = message
+		s.Signature = aead.Seal(nil, nonce(aead, header), nil, append(header, message...))
+		return nil
+	}
+	sealed := aead.Seal(nil, nonce(aead, header), message, header)
+	tag := len(sealed) - aead.Overhead()
+	s.Message, s.Signature = sealed[:tag], sealed[tag:]
+	return nil
+}
+
+func (c GCM) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.Key)
+	if err != nil {
+		return nil, uds.ErrConditionsNotCorrect
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, uds.ErrConditionsNotCorrect
+	}
+	return aead, nil
+}
+
+func nonce(aead cipher.AEAD, header []byte) []byte {
+	n := make([]byte, aead.NonceSize())
+	copy(n, header)
+	return n
+}
@@ -0,0 +1,132 @@
+// Package sdt implements the security sub-layer of SecuredDataTransmission
+// (0x84). A Layer unwraps the internal request of a securityDataRequestRecord,
+// which the node dispatches like any other request, and wraps the internal
+// response into the securityDataResponseRecord.
+//
+// The signatureEncryptionCalculation byte of a record picks the Cipher that
+// verifies and decrypts it, the response is protected with the same Cipher:
+// encrypted when the request was, signed when the request asked for a signed
+// response.
+//
+// Example, HMAC-SHA256 signatures with calculation 0x01 and AES-128-GCM with
+// calculation 0x02:
+//
+//	x, err := node.NewInstance(&node.InstanceConfig{
+//		...
+//		SecuredData: sdt.NewLayer(map[byte]sdt.Cipher{
+//			0x01: sdt.HMAC{Secret: secret},
+//			0x02: sdt.GCM{Key: aesKey},
+//		}),
+//	})
+//
+// CheckCounter is meant to be replaced by deliberately broken variants, like
+// AcceptAnyCounter.
+package sdt
+
+import (
+	"sync"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// Cipher protects internal messages.
+type Cipher interface {
+	// Open verifies the signature of s and returns its internal message in
+	// plaintext.
+	Open(s *uds.SecuredData) ([]byte, error)
+	// Seal sets the Message and Signature of s, whose other fields are
+	// already set, for the plaintext internal message.
+	Seal(s *uds.SecuredData, message []byte) error
+}
+
+// Layer answers the security sub-layer of SecuredDataTransmission requests,
+// see package doc.
+type Layer struct {
+	// Ciphers maps signatureEncryptionCalculation values to their Cipher,
+	// requests for others are out of range.
+	Ciphers map[byte]Cipher
+	// CheckCounter reports whether the antiReplayCounter of a request may
+	// follow the counter of the last accepted request, Newer when nil.
+	CheckCounter func(last uint16, counter uint16) bool
+
+	mu   sync.Mutex
+	last uint16
+	seen bool
+}
+
+// NewLayer returns a layer protecting messages with ciphers.
+func NewLayer(ciphers map[byte]Cipher) *Layer {
+	return &Layer{Ciphers: ciphers}
+}
+
+// Unwrap verifies a securityDataRequestRecord and returns it along with its
+// internal request, service identifier first. Records failing verification or
+// replaying an anti-replay counter are answered with securityAccessDenied.
+func (l *Layer) Unwrap(record []byte) (*uds.SecuredData, []byte, error) {
+	var s uds.SecuredData
+	if err := s.UnmarshalRecord(record); err != nil {
+		return nil, nil, err
+	}
+	if s.AdministrativeParameter&uds.SecuredRequestMessage == 0 {
+		return nil, nil, uds.ErrRequestOutOfRange
+	}
+	c, ok := l.Ciphers[s.SignatureEncryptionCalculation]
+	if !ok {
+		return nil, nil, uds.ErrRequestOutOfRange
+	}
+	message, err := c.Open(&s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(message) == 0 {
+		return nil, nil, uds.ErrIncorrectMessageLength
+	}
+	// only authentic requests advance the counter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	check := l.CheckCounter
+	if check == nil {
+		check = Newer
+	}
+	if l.seen && !check(l.last, s.AntiReplayCounter) {
+		return nil, nil, uds.ErrSecurityAccessDenied
+	}
+	l.last, l.seen = s.AntiReplayCounter, true
+	return &s, message, nil
+}
+
+// Wrap returns the securityDataResponseRecord carrying the internal response
+// to req, service identifier first.
+func (l *Layer) Wrap(req *uds.SecuredData, response []byte) ([]byte, error) {
+	s := &uds.SecuredData{
+		AdministrativeParameter:        req.AdministrativeParameter & (uds.SecuredPreEstablishedKey | uds.SecuredMessageEncrypted),
+		SignatureEncryptionCalculation: req.SignatureEncryptionCalculation,
+		AntiReplayCounter:              req.AntiReplayCounter,
+		Message:                        response,
+	}
+	if req.AdministrativeParameter&uds.SecuredResponseSignatureRequested != 0 {
+		s.AdministrativeParameter |= uds.SecuredMessageSigned
+	}
+	if s.AdministrativeParameter&(uds.SecuredMessageEncrypted|uds.SecuredMessageSigned) != 0 {
+		c, ok := l.Ciphers[s.SignatureEncryptionCalculation]
+		if !ok {
+			return nil, uds.ErrRequestOutOfRange
+		}
+		if err := c.Seal(s, response); err != nil {
+			return nil, err
+		}
+	}
+	return s.MarshalRecord()
+}
+
+// Newer reports whether counter is ahead of last by less than half the
+// counter range, so the counter may wrap around.
+func Newer(last uint16, counter uint16) bool {
+	return int16(counter-last) > 0
+}
+
+// AcceptAnyCounter is a deliberately broken CheckCounter that accepts
+// replayed requests.
+func AcceptAnyCounter(last uint16, counter uint16) bool {
+	return true
+}
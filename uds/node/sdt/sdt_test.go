@@ -0,0 +1,151 @@
+package sdt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+const (
+	signed    = uds.SecuredRequestMessage | uds.SecuredMessageSigned
+	encrypted = uds.SecuredRequestMessage | uds.SecuredMessageEncrypted
+	requested = uds.SecuredResponseSignatureRequested
+)
+
+func nrcOf(err error) uds.NRC {
+	if err == nil {
+		return 0
+	}
+	return uds.ToNegativeResponse(uds.SecuredDataTransmission, err).Code
+}
+
+func testCiphers() map[byte]Cipher {
+	return map[byte]Cipher{
+		0x01: HMAC{Secret: []byte("secret"), Length: 16},
+		0x02: GCM{Key: []byte("0123456789abcdef")},
+	}
+}
+
+// seal returns the securityDataRequestRecord a tester sends for message,
+// with a flipped message byte when tampered.
+func seal(t *testing.T, admin uint16, calculation byte, counter uint16, message []byte, tampered bool) []byte {
+	t.Helper()
+	s := &uds.SecuredData{AdministrativeParameter: admin, SignatureEncryptionCalculation: calculation, AntiReplayCounter: counter}
+	// records the cipher cannot seal are sent in the clear
+	s.Message = message
+	if c, ok := testCiphers()[calculation]; ok {
+		c.Seal(s, message)
+	}
+	if tampered {
+		s.Message = append([]byte(nil), s.Message...)
+		s.Message[0] ^= 0x01
+	}
+	record, err := s.MarshalRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestLayer(t *testing.T) {
+	request := []byte{0x22, 0xF1, 0x90}
+	tests := []struct {
+		name        string
+		admin       uint16
+		calculation byte
+		counter     uint16
+		message     []byte
+		tampered    bool
+		nrc         uds.NRC
+		// response is the administrativeParameter of the response
+		response uint16
+	}{
+		{"signed", signed, 0x01, 1, request, false, 0, 0},
+		{"replayed", signed, 0x01, 1, request, false, uds.SAD, 0},
+		{"older", signed, 0x01, 0, request, false, uds.SAD, 0},
+		{"tampered", signed, 0x01, 2, request, true, uds.SAD, 0},
+		{"unsigned", uds.SecuredRequestMessage, 0x01, 2, request, false, uds.SAD, 0},
+		{"encrypted with HMAC", encrypted | uds.SecuredMessageSigned, 0x01, 2, request, false, uds.ROOR, 0},
+		// rejected requests do not advance the counter
+		{"signed response", signed | requested, 0x01, 2, request, false, 0, uds.SecuredMessageSigned},
+		{"encrypted", encrypted, 0x02, 3, request, false, 0, uds.SecuredMessageEncrypted},
+		{"encrypted and signed response", encrypted | requested, 0x02, 4, request, false, 0, uds.SecuredMessageEncrypted | uds.SecuredMessageSigned},
+		{"tampered encrypted", encrypted, 0x02, 5, request, true, uds.SAD, 0},
+		{"GMAC", signed | requested, 0x02, 5, request, false, 0, uds.SecuredMessageSigned},
+		{"unprotected GCM", uds.SecuredRequestMessage, 0x02, 6, request, false, uds.SAD, 0},
+		{"unknown calculation", signed, 0x03, 6, request, false, uds.ROOR, 0},
+		{"response message", uds.SecuredMessageSigned, 0x01, 6, request, false, uds.ROOR, 0},
+		{"empty internal request", encrypted, 0x02, 6, nil, false, uds.IMLOIF, 0},
+		{"counter far ahead", signed, 0x01, 0x8004, request, false, 0, 0},
+		{"wrapped counter", signed, 0x01, 0x0003, request, false, 0, 0},
+	}
+	l := NewLayer(testCiphers())
+	for _, tt := range tests {
+		req, message, err := l.Unwrap(seal(t, tt.admin, tt.calculation, tt.counter, tt.message, tt.tampered))
+		if nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !bytes.Equal(message, tt.message) {
+			t.Errorf("%s: internal request % X, want % X", tt.name, message, tt.message)
+		}
+		record, err := l.Wrap(req, []byte{0x7E, 0x00})
+		if err != nil {
+			t.Errorf("%s: Wrap: %v", tt.name, err)
+			continue
+		}
+		var resp uds.SecuredData
+		if err := resp.UnmarshalRecord(record); err != nil {
+			t.Errorf("%s: response record % X: %v", tt.name, record, err)
+			continue
+		}
+		if resp.AdministrativeParameter != tt.response || resp.AntiReplayCounter != tt.counter {
+			t.Errorf("%s: response administrativeParameter 0x%04X, counter %d", tt.name, resp.AdministrativeParameter, resp.AntiReplayCounter)
+		}
+		got := resp.Message
+		if tt.response != 0 {
+			if got, err = testCiphers()[tt.calculation].Open(&resp); err != nil {
+				t.Errorf("%s: response does not verify: %v", tt.name, err)
+			}
+		}
+		if !bytes.Equal(got, []byte{0x7E, 0x00}) {
+			t.Errorf("%s: internal response % X", tt.name, got)
+		}
+	}
+}
+
+func TestAcceptAnyCounter(t *testing.T) {
+	l := NewLayer(testCiphers())
+	l.CheckCounter = AcceptAnyCounter
+	for n := 0; n < 2; n++ {
+		if _, _, err := l.Unwrap(seal(t, signed, 0x01, 7, []byte{0x3E, 0x00}, false)); err != nil {
+			t.Errorf("request %d: %v", n, err)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		last    uint16
+		counter uint16
+		want    bool
+	}{
+		{1, 2, true},
+		{2, 2, false},
+		{2, 1, false},
+		{0xFFFF, 0x0000, true},
+		{0xFFF0, 0x0005, true},
+		{0x0005, 0xFFF0, false},
+		{0x0000, 0x7FFF, true},
+		{0x0000, 0x8000, false},
+	}
+	for _, tt := range tests {
+		if got := Newer(tt.last, tt.counter); got != tt.want {
+			t.Errorf("Newer(0x%04X, 0x%04X) = %v, want %v", tt.last, tt.counter, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"sync"
+)
+
+// Static expects Secret as the key for every seed, like a hardcoded
+// password.
+type Static struct {
+	Secret []byte
+}
+
+// Key returns the static key.
+func (a Static) Key(seed []byte) []byte {
+	return append([]byte(nil), a.Secret...)
+}
+
+// XOR expects the seed XORed with a repeating constant.
+type XOR struct {
+	Constant []byte
+}
+
+// Key returns the seed XORed with the constant.
+func (a XOR) Key(seed []byte) []byte {
+	if len(a.Constant) == 0 {
+		return nil
+	}
+	key := make([]byte, len(seed))
+	for n := range seed {
+		key[n] = seed[n] ^ a.Constant[n%len(a.Constant)]
+	}
+	return key
+}
+
+// AddRotate expects each 4 byte big endian word of the seed with Add added
+// and rotated left by Rotate bits. A shorter last word is rotated within its
+// own width.
+type AddRotate struct {
+	Add    uint32
+	Rotate uint
+}
+
+// Key returns the seed with Add added to and Rotate applied to each word.
+func (a AddRotate) Key(seed []byte) []byte {
+	key := make([]byte, 0, len(seed))
+	for n := 0; n < len(seed); n += 4 {
+		end := n + 4
+		if end > len(seed) {
+			end = len(seed)
+		}
+		width := uint(end-n) * 8
+		mask := uint64(1)<<width - 1
+		var word uint64
+		for _, b := range seed[n:end] {
+			word = word<<8 | uint64(b)
+		}
+		word = (word + uint64(a.Add)) & mask
+		r := a.Rotate % width
+		word = (word<<r | word>>(width-r)) & mask
+		for shift := int(width) - 8; shift >= 0; shift -= 8 {
+			key = append(key, byte(word>>uint(shift)))
+		}
+	}
+	return key
+}
+
+// CMAC expects the AES-128-CMAC of the seed, RFC 4493, under the 16 byte
+// Secret.
+type CMAC struct {
+	Secret []byte
+}
+
+// Key returns the 16 byte CMAC of the seed, or nil for an invalid AES key.
+func (a CMAC) Key(seed []byte) []byte {
+	block, err := aes.NewCipher(a.Secret)
+	if err != nil {
+		return nil
+	}
+	// derive the subkeys from the encrypted zero block
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	k1 = doubleBlock(k1)
+	k2 := doubleBlock(k1)
+
+	n := (len(seed) + aes.BlockSize - 1) / aes.BlockSize
+	last := make([]byte, aes.BlockSize)
+	if n > 0 && len(seed)%aes.BlockSize == 0 {
+		copy(last, seed[(n-1)*aes.BlockSize:])
+		xorInto(last, k1)
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		rest := seed[(n-1)*aes.BlockSize:]
+		copy(last, rest)
+		last[len(rest)] = 0x80
+		xorInto(last, k2)
+	}
+	mac := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		xorInto(mac, seed[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(mac, mac)
+	}
+	xorInto(mac, last)
+	block.Encrypt(mac, mac)
+	return mac
+}
+
+// doubleBlock multiplies a block by x in GF(2^128).
+func doubleBlock(b []byte) []byte {
+	out := make([]byte, len(b))
+	carry := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		out[i] = b[i]<<1 | b[i+1]>>7
+	}
+	out[len(b)-1] = b[len(b)-1] << 1
+	if carry != 0 {
+		out[len(b)-1] ^= 0x87
+	}
+	return out
+}
+
+func xorInto(dst []byte, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
+
+// HMAC expects the HMAC-SHA256 of the seed under Secret, truncated to Length
+// bytes when Length is between 1 and 32.
+type HMAC struct {
+	Secret []byte
+	Length int
+}
+
+// Key returns the HMAC of the seed.
+func (a HMAC) Key(seed []byte) []byte {
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	if a.Length > 0 && a.Length < len(sum) {
+		sum = sum[:a.Length]
+	}
+	return sum
+}
+
+// LFSR is a deliberately weak algorithm built on a 32 bit Galois LFSR. Seeds
+// are taken from the register, so every seed reveals the next one, and the
+// key is the seed clocked Steps more times, so one seed and key pair
+// reveals the algorithm.
+type LFSR struct {
+	// Taps is the feedback polynomial, 0xB4BCD35C when zero.
+	Taps uint32
+	// Steps is how often the seed is clocked to compute the key, 32 when
+	// zero.
+	Steps int
+
+	mu    sync.Mutex
+	state uint32
+}
+
+// NewLFSR returns an LFSR seeded with state, which is 1 when zero.
+func NewLFSR(taps uint32, steps int, state uint32) *LFSR {
+	return &LFSR{Taps: taps, Steps: steps, state: state}
+}
+
+// Seed returns the next length bytes of the register.
+func (a *LFSR) Seed(length int) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == 0 {
+		a.state = 1
+	}
+	seed := make([]byte, length)
+	for n := range seed {
+		for i := 0; i < 8; i++ {
+			a.state = a.clock(a.state)
+		}
+		seed[n] = byte(a.state)
+	}
+	return seed
+}
+
+// Key clocks each 4 byte big endian word of the seed Steps times.
+func (a *LFSR) Key(seed []byte) []byte {
+	steps := a.Steps
+	if steps <= 0 {
+		steps = 32
+	}
+	key := make([]byte, 0, len(seed))
+	for n := 0; n < len(seed); n += 4 {
+		end := n + 4
+		if end > len(seed) {
+			end = len(seed)
+		}
+		var word uint32
+		for _, b := range seed[n:end] {
+			word = word<<8 | uint32(b)
+		}
+		for i := 0; i < steps; i++ {
+			word = a.clock(word)
+		}
+		for shift := (end - n - 1) * 8; shift >= 0; shift -= 8 {
+			key = append(key, byte(word>>uint(shift)))
+		}
+	}
+	return key
+}
+
+func (a *LFSR) clock(state uint32) uint32 {
+	taps := a.Taps
+	if taps == 0 {
+		taps = 0xB4BCD35C
+	}
+	if state&1 != 0 {
+		return state>>1 ^ taps
+	}
+	return state >> 1
+}
@@ -0,0 +1,92 @@
+// Package security provides the seed and key algorithms levels unlock
+// SecurityAccess with, so a level picks an algorithm instead of implementing
+// the requestSeed and sendKey handshake itself.
+//
+// Levels plugs into the hooks of a node.SessionManager, which keeps track of
+// the odd and even level pairs and of failed attempts, answering with
+// exceededNumberOfAttempts (0x36) and requiredTimeDelayNotExpired (0x37).
+//
+// Levels 3, 5, 6 and 9 keep their own handshakes, the flaws of those, like
+// seeds and keys readable from memory, are what the levels teach.
+//
+// Example, level 0x01 unlocked with a key XORed from the seed, level 0x11
+// with an AES-128-CMAC of an 8 byte seed:
+//
+//	x, err := node.NewInstance(&node.InstanceConfig{
+//		...
+//		Security: security.Levels{
+//			0x01: {Algorithm: security.XOR{Constant: []byte{0xCA, 0xFE, 0xBA, 0xBE}}},
+//			0x11: {Algorithm: security.CMAC{Secret: aesKey}, SeedLength: 8},
+//		},
+//	})
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+)
+
+// DefaultSeedLength is the length of the seeds of a Level without a
+// SeedLength.
+const DefaultSeedLength = 4
+
+// SeedKeyAlgorithm computes the key a tester has to send for a seed.
+type SeedKeyAlgorithm interface {
+	Key(seed []byte) []byte
+}
+
+// SeedGenerator is implemented by algorithms that generate their own seeds,
+// seeds are random otherwise.
+type SeedGenerator interface {
+	Seed(length int) []byte
+}
+
+// Level configures a security level pair, unlocked by sending the key for
+// the seed of its requestSeed sub-function with the following sendKey
+// sub-function.
+type Level struct {
+	Algorithm SeedKeyAlgorithm
+	// SeedLength is the length of the seeds sent, DefaultSeedLength when
+	// zero.
+	SeedLength int
+}
+
+// Levels maps the odd requestSeed sub-function of each level pair, like
+// 0x01, 0x03 or 0x11, to its configuration. Its Seed, SeedLength and
+// ValidKey methods are node.SessionHooks.
+type Levels map[byte]Level
+
+// Seed returns a new seed for level, or nil when level is not configured.
+func (l Levels) Seed(level byte) []byte {
+	cfg, ok := l[level]
+	if !ok || cfg.Algorithm == nil {
+		return nil
+	}
+	length := l.SeedLength(level)
+	if g, ok := cfg.Algorithm.(SeedGenerator); ok {
+		return g.Seed(length)
+	}
+	seed := make([]byte, length)
+	rand.Read(seed)
+	return seed
+}
+
+// SeedLength returns the length of the seeds of level, DefaultSeedLength for
+// levels without a SeedLength.
+func (l Levels) SeedLength(level byte) int {
+	if length := l[level].SeedLength; length > 0 {
+		return length
+	}
+	return DefaultSeedLength
+}
+
+// ValidKey reports whether key is the key for the seed sent for level, keys
+// for unknown levels are never valid.
+func (l Levels) ValidKey(level byte, seed []byte, key []byte) bool {
+	cfg, ok := l[level]
+	if !ok || cfg.Algorithm == nil {
+		return false
+	}
+	expected := cfg.Algorithm.Key(seed)
+	return len(expected) > 0 && subtle.ConstantTimeCompare(expected, key) == 1
+}
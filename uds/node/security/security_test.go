@@ -0,0 +1,109 @@
+package security
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestAlgorithms(t *testing.T) {
+	// the CMAC examples of RFC 4493 and an HMAC-SHA256 example of RFC 4231
+	aesKey := unhex("2b7e151628aed2a6abf7158809cf4f3c")
+	message := "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710"
+	tests := []struct {
+		name      string
+		algorithm SeedKeyAlgorithm
+		seed      string
+		key       string
+	}{
+		{"static", Static{Secret: []byte{0x13, 0x37}}, "01020304", "1337"},
+		{"XOR", XOR{Constant: []byte{0xCA, 0xFE}}, "0102030405", "cbfcc9facf"},
+		{"XOR without constant", XOR{}, "01020304", ""},
+		{"add rotate", AddRotate{Add: 0x11111111, Rotate: 8}, "12345678abcd", "45678923debc"},
+		{"add rotate overflow", AddRotate{Add: 1, Rotate: 3}, "ffffffff", "00000000"},
+		{"CMAC empty", CMAC{Secret: aesKey}, "", "bb1d6929e95937287fa37d129b756746"},
+		{"CMAC 16 bytes", CMAC{Secret: aesKey}, message[:32], "070a16b46b4d4144f79bdd9dd04a287c"},
+		{"CMAC 40 bytes", CMAC{Secret: aesKey}, message[:80], "dfa66747de9ae63030ca32611497c827"},
+		{"CMAC 64 bytes", CMAC{Secret: aesKey}, message, "51f0bebf7e3b9d92fc49741779363cfe"},
+		{"CMAC invalid key", CMAC{Secret: []byte{0x01}}, "01020304", ""},
+		{"HMAC", HMAC{Secret: []byte("Jefe")}, hex.EncodeToString([]byte("what do ya want for nothing?")), "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"HMAC truncated", HMAC{Secret: []byte("Jefe"), Length: 4}, hex.EncodeToString([]byte("what do ya want for nothing?")), "5bdcc146"},
+		{"LFSR", &LFSR{}, "deadbeef", "38781a87"},
+	}
+	for _, tt := range tests {
+		if got := tt.algorithm.Key(unhex(tt.seed)); !bytes.Equal(got, unhex(tt.key)) {
+			t.Errorf("%s: key %x, want %s", tt.name, got, tt.key)
+		}
+	}
+}
+
+func TestLFSRSeed(t *testing.T) {
+	a := NewLFSR(0, 0, 0)
+	seed := a.Seed(4)
+	if !bytes.Equal(seed, unhex("ddc0c65b")) {
+		t.Errorf("seed %x, want ddc0c65b", seed)
+	}
+	if next := a.Seed(4); bytes.Equal(next, seed) {
+		t.Errorf("next seed %x repeats the first", next)
+	}
+	// seeds are predictable, the same state gives the same seeds
+	if again := NewLFSR(0, 0, 1).Seed(4); !bytes.Equal(again, seed) {
+		t.Errorf("seed %x from the same state, want %x", again, seed)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	levels := Levels{
+		0x01: {Algorithm: XOR{Constant: []byte{0xFF}}},
+		0x03: {Algorithm: CMAC{Secret: unhex("2b7e151628aed2a6abf7158809cf4f3c")}, SeedLength: 8},
+		0x05: {},
+	}
+	tests := []struct {
+		name   string
+		level  byte
+		length int
+		seed   bool
+	}{
+		{"default length", 0x01, DefaultSeedLength, true},
+		{"seed length", 0x03, 8, true},
+		{"without algorithm", 0x05, DefaultSeedLength, false},
+		{"unknown", 0x07, DefaultSeedLength, false},
+	}
+	for _, tt := range tests {
+		if got := levels.SeedLength(tt.level); got != tt.length {
+			t.Errorf("%s: SeedLength = %d, want %d", tt.name, got, tt.length)
+		}
+		seed := levels.Seed(tt.level)
+		if (seed != nil) != tt.seed || (seed != nil && len(seed) != tt.length) {
+			t.Errorf("%s: Seed = %x", tt.name, seed)
+		}
+		if !tt.seed {
+			if levels.ValidKey(tt.level, []byte{0x01}, nil) {
+				t.Errorf("%s: empty key valid", tt.name)
+			}
+			continue
+		}
+		key := levels[tt.level].Algorithm.Key(seed)
+		if !levels.ValidKey(tt.level, seed, key) {
+			t.Errorf("%s: key %x invalid for seed %x", tt.name, key, seed)
+		}
+		key[0] ^= 0x01
+		if levels.ValidKey(tt.level, seed, key) {
+			t.Errorf("%s: wrong key %x valid for seed %x", tt.name, key, seed)
+		}
+		if levels.ValidKey(tt.level, seed, key[:1]) {
+			t.Errorf("%s: short key valid", tt.name)
+		}
+	}
+	if levels.ValidKey(0x01, nil, nil) {
+		t.Errorf("empty key valid for an empty seed")
+	}
+}
@@ -1,19 +1,72 @@
 package node
 
 import (
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/node/dtc"
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
 	"github.com/atredispartners/uds-zoo/uds/uds"
-	"github.com/atredispartners/uds-zoo/uds/utils"
 )
 
 // Service is an interface for implementing all UDS services.
 // See https://en.wikipedia.org/wiki/Unified_Diagnostic_Services for details.
+// Every method is routed to its SID by an Instance, a Service is implemented
+// by embedding a Service such as DefaultService and overriding methods.
 type Service interface {
-	ReadMemoryByAddress([]byte) []byte      // 0x23
+	// Diagnostic and communication management
 	DiagnosticSessionControl([]byte) []byte // 0x10
-	ReadDataByIdentifier([]byte) []byte     // 0x22
-	NotImplemented(byte) []byte             // catch all
+	ECUReset([]byte) []byte                 // 0x11
+	SecurityAccess([]byte) []byte           // 0x27
+	CommunicationControl([]byte) []byte     // 0x28
+	Authentication([]byte) []byte           // 0x29
+	TesterPresent([]byte) []byte            // 0x3E
+	AccessTimingParameter([]byte) []byte    // 0x83
+	SecuredDataTransmission([]byte) []byte  // 0x84
+	ControlDTCSetting([]byte) []byte        // 0x85
+	ResponseOnEvent([]byte) []byte          // 0x86
+	LinkControl([]byte) []byte              // 0x87
+
+	// Data transmission
+	ReadDataByIdentifier([]byte) []byte            // 0x22
+	ReadMemoryByAddress([]byte) []byte             // 0x23
+	ReadScalingDataByIdentifier([]byte) []byte     // 0x24
+	ReadDataByPeriodicIdentifier([]byte) []byte    // 0x2A
+	DynamicallyDefineDataIdentifier([]byte) []byte // 0x2C
+	WriteDataByIdentifier([]byte) []byte           // 0x2E
+	WriteMemoryByAddress([]byte) []byte            // 0x3D
+
+	// Stored data transmission
+	ClearDiagnosticInformation([]byte) []byte // 0x14
+	ReadDTCInformation([]byte) []byte         // 0x19
+
+	// Input output control
+	InputOutputControlByIdentifier([]byte) []byte // 0x2F
+
+	// Remote activation of routine
+	RoutineControl([]byte) []byte // 0x31
+
+	// Upload download
+	RequestDownload([]byte) []byte     // 0x34
+	RequestUpload([]byte) []byte       // 0x35
+	TransferData([]byte) []byte        // 0x36
+	RequestTransferExit([]byte) []byte // 0x37
+	RequestFileTransfer([]byte) []byte // 0x38
+
+	NotImplemented(uds.SID) []byte // catch all
+
+	// Bind hands the instance serving the Service to it, NewInstance calls
+	// it before any request is routed. Services embedding DefaultService
+	// inherit its Bind.
+	Bind(*Instance)
 }
 
+// Server timing used by instances unless configured otherwise, see
+// InstanceConfig.
+const (
+	DefaultP2ServerMax     = 50 * time.Millisecond
+	DefaultP2StarServerMax = 5 * time.Second
+)
+
 // DefaultService includes an implementation of Services and is meant to be used
 // with composition for your Go struct.
 // Example defining a new struct that uses composition with the DefaultService
@@ -24,47 +77,503 @@ type Service interface {
 //
 // e := ExampleService{Service: &node.DefaultService{}}
 //
-//
+// Its handlers serve the session, DIDs, routines and other state of the
+// instance it is bound to, a DefaultService is only usable once an instance
+// called Bind.
 type DefaultService struct {
+	instance *Instance
 }
 
-// TODO: Implement the remaining services
-func (d *DefaultService) ReadMemoryByAddress([]byte) []byte {
-	return []byte{0x23, 0x00}
+// Bind makes d serve the state of i.
+func (d *DefaultService) Bind(i *Instance) {
+	d.instance = i
 }
 
-func (d *DefaultService) DiagnosticSessionControl([]byte) []byte {
-	return []byte{0x10, 0x00}
+// session returns the session state of the instance serving d.
+func (d *DefaultService) session() *SessionManager {
+	return d.instance.session
 }
 
-func (d *DefaultService) ReadDataByIdentifier(payload []byte) []byte {
-	//check that the total payload len fits the dataIdentifier size
-	if len(payload)%2 != 0 {
-		//invalid data identifier size
-		return []byte{uds.NR, uds.ReadDataByIdentifier, uds.IMLOIF}
+// dataIdentifiers returns the DID registry of the instance serving d.
+func (d *DefaultService) dataIdentifiers() *DIDRegistry {
+	return d.instance.dids
+}
+
+// routineRegistry returns the routine registry of the instance serving d.
+func (d *DefaultService) routineRegistry() *RoutineRegistry {
+	return d.instance.routines
+}
+
+// transferEngine returns the transfer engine of the instance serving d.
+func (d *DefaultService) transferEngine() *TransferEngine {
+	return d.instance.transfers
+}
+
+// eventEngine returns the ResponseOnEvent engine of the instance serving d.
+func (d *DefaultService) eventEngine() *EventEngine {
+	return d.instance.events
+}
+
+// networkLink returns the simulated network connection of the instance
+// serving d.
+func (d *DefaultService) networkLink() *Link {
+	return d.instance.link
+}
+
+// dtcStore returns the DTC memory of the instance serving d.
+func (d *DefaultService) dtcStore() *dtc.Store {
+	return d.instance.dtcs
+}
+
+// memoryMap returns the memory map of the instance serving d, or nil.
+func (d *DefaultService) memoryMap() *memory.Map {
+	return d.instance.memory
+}
+
+// positive encodes a positive response message.
+func positive(m uds.Message) []byte {
+	resp, err := uds.Marshal(m)
+	if err != nil {
+		return negative(m.ServiceID()-0x40, err)
 	}
-	// set positive response sid
-	var response = []byte{uds.ReadDataByIdentifier + 0x40}
-	var dataIdentifier []byte
-	for len(payload) != 0 {
-		// grab the first identifier from the payload
-		dataIdentifier, payload, _ = utils.PopBytes(payload, 2)
-		//add the dataIdentifier to the response
-		response = append(response, dataIdentifier...)
+	return resp
+}
 
-		//TODO: Implement dataIdentifier dataRecord code, hardcoded value as an example
-		//dataRecord := getDataRecord(dataIdentifier)
-		dataRecord := []byte{0xff, 0xff, 0xff}
+// negative encodes the negative response to sid for err.
+func negative(sid uds.SID, err error) []byte {
+	return uds.ToNegativeResponse(sid, err).Bytes()
+}
+
+// ReadMemoryByAddress reads the memory map of the instance, without one no
+// memory is readable.
+func (d *DefaultService) ReadMemoryByAddress(payload []byte) []byte {
+	var req uds.ReadMemoryByAddressRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ReadMemoryByAddress, err)
+	}
+	m := d.memoryMap()
+	if m == nil {
+		return negative(uds.ReadMemoryByAddress, uds.ErrRequestOutOfRange)
+	}
+	data, err := m.Read(d.session(), req.MemoryAddress, req.MemorySize)
+	if err != nil {
+		return negative(uds.ReadMemoryByAddress, err)
+	}
+	return positive(&uds.ReadMemoryByAddressResponse{DataRecord: data})
+}
 
-		//add the dataRecord to the response
-		response = append(response, dataRecord...)
+// DiagnosticSessionControl switches to the default, programming and extended
+// diagnostic sessions and reports the server timing of the instance.
+func (d *DefaultService) DiagnosticSessionControl(payload []byte) []byte {
+	var req uds.DiagnosticSessionControlRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.DiagnosticSessionControl, err)
 	}
+	switch req.SessionType & 0x7F {
+	case uds.DefaultSession, uds.ProgrammingSession, uds.ExtendedDiagnosticSession:
+		p2, p2Star := DefaultP2ServerMax, DefaultP2StarServerMax
+		if d.instance.p2 > 0 {
+			p2, p2Star = d.instance.Timing()
+		}
+		return positive(&uds.DiagnosticSessionControlResponse{
+			SessionType:     req.SessionType,
+			P2ServerMax:     uint16(p2 / time.Millisecond),
+			P2StarServerMax: uint16(p2Star / (10 * time.Millisecond)),
+		})
+	}
+	return negative(uds.DiagnosticSessionControl, uds.ErrSubFunctionNotSupported)
+}
 
-	return response
+// ReadDataByIdentifier reads the DIDs registered with the instance, see
+// DIDRegistry.Read.
+func (d *DefaultService) ReadDataByIdentifier(payload []byte) []byte {
+	var req uds.ReadDataByIdentifierRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ReadDataByIdentifier, err)
+	}
+	records, err := d.dataIdentifiers().Read(d.session(), req.DataIdentifiers)
+	if err != nil {
+		return negative(uds.ReadDataByIdentifier, err)
+	}
+	return positive(&uds.ReadDataByIdentifierResponse{Records: records})
 }
 
 // NotImplemented: Service not implemented handler to catch all unknown services
 // that have not been implemented. Returns standard UDS error Service Not Supported (SNS).
-func (d *DefaultService) NotImplemented(sid byte) []byte {
-	return []byte{sid, uds.SNS}
+func (d *DefaultService) NotImplemented(sid uds.SID) []byte {
+	return uds.NewNegativeResponse(sid, uds.SNS).Bytes()
+}
+
+// ECUReset answers every reset type but enableRapidPowerShutDown, the
+// instance then returns to the default session.
+func (d *DefaultService) ECUReset(payload []byte) []byte {
+	var req uds.ECUResetRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ECUReset, err)
+	}
+	switch req.ResetType & 0x7F {
+	case uds.HardReset, uds.KeyOffOnReset, uds.SoftReset, uds.DisableRapidPowerShutDown:
+		return positive(&uds.ECUResetResponse{ResetType: req.ResetType})
+	}
+	return negative(uds.ECUReset, uds.ErrSubFunctionNotSupported)
+}
+
+// SecurityAccess runs the seed and key exchange of the instance
+// SessionManager, see SessionHooks for choosing seeds and keys.
+func (d *DefaultService) SecurityAccess(payload []byte) []byte {
+	var req uds.SecurityAccessRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.SecurityAccess, err)
+	}
+	level := req.SecurityAccessType & 0x7F
+	if req.RequestSeed() {
+		seed, err := d.session().RequestSeed(level)
+		if err != nil {
+			return negative(uds.SecurityAccess, err)
+		}
+		return positive(&uds.SecurityAccessResponse{SecurityAccessType: req.SecurityAccessType, SecuritySeed: seed})
+	}
+	if err := d.session().SendKey(level, req.Data); err != nil {
+		return negative(uds.SecurityAccess, err)
+	}
+	return positive(&uds.SecurityAccessResponse{SecurityAccessType: req.SecurityAccessType})
+}
+
+// CommunicationControl switches receiving and transmitting normal and
+// network management messages on and off outside the default session, see
+// Link. Entering the default session switches them on again.
+func (d *DefaultService) CommunicationControl(payload []byte) []byte {
+	var req uds.CommunicationControlRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.CommunicationControl, err)
+	}
+	if d.session().Session() == uds.DefaultSession {
+		return negative(uds.CommunicationControl, uds.ErrServiceNotSupportedInActiveSession)
+	}
+	if err := d.networkLink().Control(req.ControlType&0x7F, req.CommunicationType); err != nil {
+		return negative(uds.CommunicationControl, err)
+	}
+	return positive(&uds.CommunicationControlResponse{ControlType: req.ControlType})
+}
+
+// Authentication authenticates the tester with the authenticator of the
+// instance, see auth.Authenticator. Without one the service is not
+// supported.
+func (d *DefaultService) Authentication(payload []byte) []byte {
+	if d.instance.auth == nil {
+		return uds.NewNegativeResponse(uds.Authentication, uds.SNS).Bytes()
+	}
+	var req uds.AuthenticationRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.Authentication, err)
+	}
+	resp, err := d.instance.auth.Authenticate(d.session(), &req)
+	if err != nil {
+		return negative(uds.Authentication, err)
+	}
+	return positive(resp)
+}
+
+func (d *DefaultService) TesterPresent(payload []byte) []byte {
+	var req uds.TesterPresentRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.TesterPresent, err)
+	}
+	return positive(&uds.TesterPresentResponse{ZeroSubFunction: req.ZeroSubFunction})
+}
+
+func (d *DefaultService) AccessTimingParameter([]byte) []byte {
+	return uds.NewNegativeResponse(uds.AccessTimingParameter, uds.SNS).Bytes()
+}
+
+// SecuredDataTransmission unwraps the internal request with the security
+// sub-layer of the instance, see sdt.Layer, and dispatches it like any other
+// request, access policy included. The internal response is always sent, even
+// when it is a suppressed positive response. Without a layer the service is
+// not supported.
+func (d *DefaultService) SecuredDataTransmission(payload []byte) []byte {
+	if d.instance.sdt == nil {
+		return uds.NewNegativeResponse(uds.SecuredDataTransmission, uds.SNS).Bytes()
+	}
+	var req uds.SecuredDataTransmissionRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.SecuredDataTransmission, err)
+	}
+	record, message, err := d.instance.sdt.Unwrap(req.SecurityDataRequestRecord)
+	if err != nil {
+		return negative(uds.SecuredDataTransmission, err)
+	}
+	inner := uds.Request{SID: uds.SID(message[0]), Data: message[1:]}
+	if inner.SID == uds.SecuredDataTransmission {
+		return negative(uds.SecuredDataTransmission, uds.ErrRequestOutOfRange)
+	}
+	ctx := &Context{
+		Session:  d.instance.session,
+		Received: time.Now(),
+		Logger:   d.instance.logger,
+		Instance: d.instance,
+	}
+	if d.instance.serving != nil {
+		// the internal message comes from the client of the outer request
+		ctx.Client = d.instance.serving.Client
+	}
+	// the internal message is rate limited, logged and recorded like any other
+	resp, err := d.instance.handle(ctx, inner)
+	if err != nil {
+		resp = negativeResponse(inner.SID, err)
+	}
+	wrapped, err := d.instance.sdt.Wrap(record, resp.Bytes())
+	if err != nil {
+		return negative(uds.SecuredDataTransmission, err)
+	}
+	return positive(&uds.SecuredDataTransmissionResponse{SecurityDataResponseRecord: wrapped})
+}
+
+// ControlDTCSetting switches updating DTC status bits on and off outside the
+// default session, entering the default session switches it on again.
+func (d *DefaultService) ControlDTCSetting(payload []byte) []byte {
+	var req uds.ControlDTCSettingRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ControlDTCSetting, err)
+	}
+	switch req.DTCSettingType & 0x7F {
+	case 0x01, 0x02:
+		if d.session().Session() == uds.DefaultSession {
+			return negative(uds.ControlDTCSetting, uds.ErrServiceNotSupportedInActiveSession)
+		}
+		d.dtcStore().SetEnabled(req.DTCSettingType&0x7F == 0x01)
+		return positive(&uds.ControlDTCSettingResponse{DTCSettingType: req.DTCSettingType})
+	}
+	return negative(uds.ControlDTCSetting, uds.ErrSubFunctionNotSupported)
+}
+
+// ResponseOnEvent sets up, starts, stops and reports the events of the
+// instance, see EventEngine.
+func (d *DefaultService) ResponseOnEvent(payload []byte) []byte {
+	var req uds.ResponseOnEventRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ResponseOnEvent, err)
+	}
+	resp, err := d.eventEngine().Control(&req)
+	if err != nil {
+		return negative(uds.ResponseOnEvent, err)
+	}
+	return positive(resp)
+}
+
+// LinkControl verifies a fixed or specific baud rate and transitions the
+// CAN transport to it outside the default session, see Link. Entering the
+// default session restores the initial baud rate.
+func (d *DefaultService) LinkControl(payload []byte) []byte {
+	var req uds.LinkControlRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.LinkControl, err)
+	}
+	if d.session().Session() == uds.DefaultSession {
+		return negative(uds.LinkControl, uds.ErrServiceNotSupportedInActiveSession)
+	}
+	var err error
+	switch req.LinkControlType & 0x7F {
+	case 0x01:
+		rate, ok := FixedBaudRates[req.Record[0]]
+		if !ok {
+			return negative(uds.LinkControl, uds.ErrRequestOutOfRange)
+		}
+		err = d.networkLink().Verify(rate)
+	case 0x02:
+		err = d.networkLink().Verify(uint32(req.Record[0])<<16 | uint32(req.Record[1])<<8 | uint32(req.Record[2]))
+	case 0x03:
+		err = d.networkLink().Transition()
+	default:
+		err = uds.ErrSubFunctionNotSupported
+	}
+	if err != nil {
+		return negative(uds.LinkControl, err)
+	}
+	return positive(&uds.LinkControlResponse{LinkControlType: req.LinkControlType})
+}
+
+// ReadScalingDataByIdentifier returns the scaling information of a registered
+// DID.
+func (d *DefaultService) ReadScalingDataByIdentifier(payload []byte) []byte {
+	var req uds.ReadScalingDataByIdentifierRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ReadScalingDataByIdentifier, err)
+	}
+	scaling, err := d.dataIdentifiers().Scaling(d.session(), req.DataIdentifier)
+	if err != nil {
+		return negative(uds.ReadScalingDataByIdentifier, err)
+	}
+	return positive(&uds.ReadScalingDataByIdentifierResponse{DataIdentifier: req.DataIdentifier, ScalingData: scaling})
+}
+
+// ReadDataByPeriodicIdentifier has no periodic DIDs.
+func (d *DefaultService) ReadDataByPeriodicIdentifier(payload []byte) []byte {
+	var req uds.ReadDataByPeriodicIdentifierRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ReadDataByPeriodicIdentifier, err)
+	}
+	return negative(uds.ReadDataByPeriodicIdentifier, uds.ErrRequestOutOfRange)
+}
+
+// DynamicallyDefineDataIdentifier has no dynamically definable DIDs.
+func (d *DefaultService) DynamicallyDefineDataIdentifier(payload []byte) []byte {
+	var req uds.DynamicallyDefineDataIdentifierRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.DynamicallyDefineDataIdentifier, err)
+	}
+	return negative(uds.DynamicallyDefineDataIdentifier, uds.ErrRequestOutOfRange)
+}
+
+// WriteDataByIdentifier writes a DID registered with the instance, see
+// DIDRegistry.Write.
+func (d *DefaultService) WriteDataByIdentifier(payload []byte) []byte {
+	var req uds.WriteDataByIdentifierRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.WriteDataByIdentifier, err)
+	}
+	if err := d.dataIdentifiers().Write(d.session(), req.DataIdentifier, req.DataRecord); err != nil {
+		return negative(uds.WriteDataByIdentifier, err)
+	}
+	return positive(&uds.WriteDataByIdentifierResponse{DataIdentifier: req.DataIdentifier})
+}
+
+// WriteMemoryByAddress writes the memory map of the instance, without one no
+// memory is writable.
+func (d *DefaultService) WriteMemoryByAddress(payload []byte) []byte {
+	var req uds.WriteMemoryByAddressRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.WriteMemoryByAddress, err)
+	}
+	m := d.memoryMap()
+	if m == nil {
+		return negative(uds.WriteMemoryByAddress, uds.ErrRequestOutOfRange)
+	}
+	if err := m.Write(d.session(), req.MemoryAddress, req.DataRecord); err != nil {
+		return negative(uds.WriteMemoryByAddress, err)
+	}
+	return positive(&uds.WriteMemoryByAddressResponse{
+		AddressAndLengthFormatIdentifier: req.AddressAndLengthFormatIdentifier,
+		MemoryAddress:                    req.MemoryAddress,
+		MemorySize:                       req.MemorySize,
+	})
+}
+
+// ClearDiagnosticInformation clears a group of DTCs in the DTC memory of the
+// instance, see dtc.Store.Clear. Memory selection is not supported.
+func (d *DefaultService) ClearDiagnosticInformation(payload []byte) []byte {
+	var req uds.ClearDiagnosticInformationRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ClearDiagnosticInformation, err)
+	}
+	if req.HasMemorySelection {
+		return negative(uds.ClearDiagnosticInformation, uds.ErrRequestOutOfRange)
+	}
+	if err := d.dtcStore().Clear(req.GroupOfDTC); err != nil {
+		return negative(uds.ClearDiagnosticInformation, err)
+	}
+	return positive(&uds.ClearDiagnosticInformationResponse{})
+}
+
+// ReadDTCInformation reports the DTC memory of the instance for the report
+// types supported by dtc.Store.
+func (d *DefaultService) ReadDTCInformation(payload []byte) []byte {
+	var req uds.ReadDTCInformationRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.ReadDTCInformation, err)
+	}
+	record, err := d.dtcStore().ReadDTCInformation(req.ReportType&0x7F, req.Record)
+	if err != nil {
+		return negative(uds.ReadDTCInformation, err)
+	}
+	return positive(&uds.ReadDTCInformationResponse{ReportType: req.ReportType, Record: record})
+}
+
+// InputOutputControlByIdentifier has no controllable DIDs.
+func (d *DefaultService) InputOutputControlByIdentifier(payload []byte) []byte {
+	var req uds.InputOutputControlByIdentifierRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.InputOutputControlByIdentifier, err)
+	}
+	return negative(uds.InputOutputControlByIdentifier, uds.ErrRequestOutOfRange)
+}
+
+// RoutineControl starts, stops and requests results of a routine registered
+// with the instance, see RoutineRegistry.Control.
+func (d *DefaultService) RoutineControl(payload []byte) []byte {
+	var req uds.RoutineControlRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.RoutineControl, err)
+	}
+	status, err := d.routineRegistry().Control(d.session(), req.RoutineControlType&0x7F, req.RoutineIdentifier, req.ControlOptionRecord)
+	if err != nil {
+		return negative(uds.RoutineControl, err)
+	}
+	return positive(&uds.RoutineControlResponse{
+		RoutineControlType: req.RoutineControlType,
+		RoutineIdentifier:  req.RoutineIdentifier,
+		StatusRecord:       status,
+	})
+}
+
+// RequestDownload starts downloading into the memory map of the instance,
+// see TransferEngine.RequestDownload.
+func (d *DefaultService) RequestDownload(payload []byte) []byte {
+	var req uds.RequestDownloadRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.RequestDownload, err)
+	}
+	loc := uds.AddressAndLength{Format: req.AddressAndLengthFormatIdentifier, Address: req.MemoryAddress, Size: req.MemorySize}
+	maxBlockLength, err := d.transferEngine().RequestDownload(d.session(), d.memoryMap(), req.DataFormatIdentifier, loc)
+	if err != nil {
+		return negative(uds.RequestDownload, err)
+	}
+	return positive(&uds.RequestDownloadResponse{MaxNumberOfBlockLength: maxBlockLength})
+}
+
+// RequestUpload starts uploading from the memory map of the instance, see
+// TransferEngine.RequestUpload.
+func (d *DefaultService) RequestUpload(payload []byte) []byte {
+	var req uds.RequestUploadRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.RequestUpload, err)
+	}
+	loc := uds.AddressAndLength{Format: req.AddressAndLengthFormatIdentifier, Address: req.MemoryAddress, Size: req.MemorySize}
+	maxBlockLength, err := d.transferEngine().RequestUpload(d.session(), d.memoryMap(), req.DataFormatIdentifier, loc)
+	if err != nil {
+		return negative(uds.RequestUpload, err)
+	}
+	return positive(&uds.RequestUploadResponse{MaxNumberOfBlockLength: maxBlockLength})
+}
+
+// TransferData transfers a block of the active transfer, see
+// TransferEngine.TransferData.
+func (d *DefaultService) TransferData(payload []byte) []byte {
+	var req uds.TransferDataRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.TransferData, err)
+	}
+	record, err := d.transferEngine().TransferData(d.session(), req.BlockSequenceCounter, req.ParameterRecord)
+	if err != nil {
+		return negative(uds.TransferData, err)
+	}
+	return positive(&uds.TransferDataResponse{BlockSequenceCounter: req.BlockSequenceCounter, ParameterRecord: record})
+}
+
+// RequestTransferExit ends the active transfer, see
+// TransferEngine.RequestTransferExit.
+func (d *DefaultService) RequestTransferExit(payload []byte) []byte {
+	var req uds.RequestTransferExitRequest
+	if err := req.UnmarshalPayload(payload); err != nil {
+		return negative(uds.RequestTransferExit, err)
+	}
+	record, err := d.transferEngine().RequestTransferExit(req.ParameterRecord)
+	if err != nil {
+		return negative(uds.RequestTransferExit, err)
+	}
+	return positive(&uds.RequestTransferExitResponse{ParameterRecord: record})
+}
+
+func (d *DefaultService) RequestFileTransfer([]byte) []byte {
+	return uds.NewNegativeResponse(uds.RequestFileTransfer, uds.SNS).Bytes()
 }
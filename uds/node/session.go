@@ -0,0 +1,382 @@
+package node
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// SessionHooks let a level change how a SessionManager behaves, including
+// deliberately breaking it. Every hook is optional and runs without the
+// manager lock held, so it may call back into the manager.
+type SessionHooks struct {
+	// Seed returns the seed sent for a security level, a nil seed refuses
+	// the level with subFunctionNotSupported. When nil a random 4 byte seed
+	// is used.
+	Seed func(level byte) []byte
+	// SeedLength returns the length of the seeds of level, the zero seed
+	// sent for an unlocked level is as long. When nil or zero the length is
+	// 4 bytes.
+	SeedLength func(level byte) int
+	// ValidKey reports whether key unlocks level for the seed that was sent.
+	// When nil every key is rejected.
+	ValidKey func(level byte, seed []byte, key []byte) bool
+	// OnSessionChange runs after the active session changed and security
+	// access was locked again.
+	OnSessionChange func(s *SessionManager, from byte, to byte)
+	// OnReset runs after an ECUReset restored the default session.
+	OnReset func(s *SessionManager, resetType byte)
+}
+
+// SessionManager tracks the active diagnostic session and security access
+// state of a node. Security levels are identified by their requestSeed
+// sub-function, 0x01 for the level unlocked with sendKey 0x02.
+//
+// Following ISO 14229-1 any session change and any ECUReset lock every
+// security level, while failed attempt counters survive both. Once
+// MaxAttempts keys were rejected, seeds are refused until LockoutDelay
+// expired. A zero LockoutDelay keeps the lockout until ClearAttempts.
+//
+// A non-default session falls back to the default session when no request
+// was received for S3Timeout, TesterPresent keeps it alive. A zero S3Timeout
+// keeps sessions forever.
+type SessionManager struct {
+	MaxAttempts  int
+	LockoutDelay time.Duration
+	S3Timeout    time.Duration
+	Hooks        SessionHooks
+
+	mu          sync.Mutex
+	session     byte
+	unlocked    map[byte]bool
+	seedLevel   byte
+	seed        []byte
+	attempts    int
+	lockedUntil time.Time
+	roles       map[string]bool
+	s3          *time.Timer
+	// s3Generation invalidates a timer that fired while being stopped.
+	s3Generation int
+	// expire runs the S3 expiry, instances set it to hold their lock like a
+	// request being served.
+	expire func(f func())
+	// onDefaultSession runs after a session change or reset entered the
+	// default session, instances use it to undo non-default session settings.
+	onDefaultSession []func()
+}
+
+// DefaultS3ServerTimeout is the S3Timeout of a new SessionManager.
+const DefaultS3ServerTimeout = 5 * time.Second
+
+// NoS3Timeout is an InstanceConfig.S3ServerTimeout keeping non-default
+// sessions until they are changed or reset, like the levels written before
+// the instance had an S3 timer.
+const NoS3Timeout time.Duration = -1
+
+// NewSessionManager returns a manager in the default session with every
+// security level locked, allowing 3 attempts and a 10 second lockout delay.
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		MaxAttempts:  3,
+		LockoutDelay: 10 * time.Second,
+		S3Timeout:    DefaultS3ServerTimeout,
+		session:      uds.DefaultSession,
+		unlocked:     map[byte]bool{},
+	}
+}
+
+// Session returns the active diagnostic session type.
+func (s *SessionManager) Session() byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session
+}
+
+// ChangeSession switches to session and locks every security level.
+func (s *SessionManager) ChangeSession(session byte) {
+	s.mu.Lock()
+	from := s.session
+	s.session = session
+	s.lockLocked()
+	s.mu.Unlock()
+	if session == uds.DefaultSession && from != uds.DefaultSession {
+		s.Deauthenticate()
+		s.enteredDefaultSession()
+	}
+	if s.Hooks.OnSessionChange != nil {
+		s.Hooks.OnSessionChange(s, from, session)
+	}
+}
+
+// Reset returns to the default session and locks every security level, as
+// done by a positive ECUReset response. A running lockout starts over.
+func (s *SessionManager) Reset(resetType byte) {
+	s.mu.Lock()
+	s.session = uds.DefaultSession
+	s.lockLocked()
+	if s.attempts >= s.MaxAttempts && s.LockoutDelay > 0 {
+		s.lockedUntil = time.Now().Add(s.LockoutDelay)
+	}
+	s.mu.Unlock()
+	s.Deauthenticate()
+	s.enteredDefaultSession()
+	if s.Hooks.OnReset != nil {
+		s.Hooks.OnReset(s, resetType)
+	}
+}
+
+// enteredDefaultSession runs the onDefaultSession funcs.
+func (s *SessionManager) enteredDefaultSession() {
+	s.mu.Lock()
+	funcs := s.onDefaultSession
+	s.mu.Unlock()
+	for _, f := range funcs {
+		f()
+	}
+}
+
+// whenDefaultSession registers f to run whenever the default session is
+// entered again.
+func (s *SessionManager) whenDefaultSession(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onDefaultSession = append(s.onDefaultSession, f)
+}
+
+// IsUnlocked reports whether security level was unlocked in this session.
+func (s *SessionManager) IsUnlocked(level byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unlocked[level]
+}
+
+// Unlock grants a security level without the seed and key exchange.
+func (s *SessionManager) Unlock(level byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unlocked[level] = true
+}
+
+// Lock locks every security level and forgets any seed that was sent.
+func (s *SessionManager) Lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockLocked()
+}
+
+func (s *SessionManager) lockLocked() {
+	s.unlocked = map[byte]bool{}
+	s.seedLevel = 0
+	s.seed = nil
+}
+
+// Authenticate grants roles, as done by a completed Authentication.
+func (s *SessionManager) Authenticate(roles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roles == nil {
+		s.roles = map[string]bool{}
+	}
+	for _, role := range roles {
+		s.roles[role] = true
+	}
+}
+
+// Deauthenticate revokes every role granted by Authenticate. Entering the
+// default session and an ECUReset deauthenticate as well.
+func (s *SessionManager) Deauthenticate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roles = nil
+}
+
+// HasRole reports whether role was granted by Authenticate.
+func (s *SessionManager) HasRole(role string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roles[role]
+}
+
+// Attempts returns the number of keys rejected since the last unlock.
+func (s *SessionManager) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+// ClearAttempts resets the failed attempt counter and ends a lockout.
+func (s *SessionManager) ClearAttempts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = 0
+	s.lockedUntil = time.Time{}
+}
+
+// RequestSeed handles securityAccess requestSeed for level, which must be odd.
+// An unlocked level is answered with a zero seed of the level's seed length.
+func (s *SessionManager) RequestSeed(level byte) ([]byte, error) {
+	if level%2 == 0 {
+		return nil, uds.ErrSubFunctionNotSupported
+	}
+	s.mu.Lock()
+	if err := s.lockoutLocked(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if s.unlocked[level] {
+		s.mu.Unlock()
+		length := 0
+		if s.Hooks.SeedLength != nil {
+			length = s.Hooks.SeedLength(level)
+		}
+		if length <= 0 {
+			length = 4
+		}
+		return make([]byte, length), nil
+	}
+	s.mu.Unlock()
+
+	var seed []byte
+	if s.Hooks.Seed != nil {
+		if seed = s.Hooks.Seed(level); seed == nil {
+			return nil, uds.ErrSubFunctionNotSupported
+		}
+	} else {
+		seed = make([]byte, 4)
+		rand.Read(seed)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seedLevel = level
+	s.seed = seed
+	return seed, nil
+}
+
+// SendKey handles securityAccess sendKey for level, which must be even and
+// follow a seed request for level-1.
+func (s *SessionManager) SendKey(level byte, key []byte) error {
+	if level == 0 || level%2 != 0 {
+		return uds.ErrSubFunctionNotSupported
+	}
+	s.mu.Lock()
+	if err := s.lockoutLocked(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if s.seedLevel != level-1 {
+		s.mu.Unlock()
+		return uds.ErrRequestSequenceError
+	}
+	seed := s.seed
+	s.mu.Unlock()
+
+	valid := s.Hooks.ValidKey != nil && s.Hooks.ValidKey(level-1, seed, key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seedLevel = 0
+	s.seed = nil
+	if !valid {
+		s.attempts++
+		if s.attempts >= s.MaxAttempts {
+			if s.LockoutDelay > 0 {
+				s.lockedUntil = time.Now().Add(s.LockoutDelay)
+			}
+			return uds.ErrExceededNumberOfAttempts
+		}
+		return uds.ErrInvalidKey
+	}
+	s.attempts = 0
+	s.unlocked[level-1] = true
+	return nil
+}
+
+// lockoutLocked returns the error for a seed or key sent while locked out.
+func (s *SessionManager) lockoutLocked() error {
+	if s.attempts < s.MaxAttempts {
+		return nil
+	}
+	if s.LockoutDelay == 0 {
+		return uds.ErrExceededNumberOfAttempts
+	}
+	if time.Now().Before(s.lockedUntil) {
+		return uds.ErrRequiredTimeDelayNotExpired
+	}
+	// the delay expired, allow one more attempt
+	s.attempts = s.MaxAttempts - 1
+	return nil
+}
+
+// stopS3 stops the S3 timer while a request is handled.
+func (s *SessionManager) stopS3() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s3Generation++
+	if s.s3 != nil {
+		s.s3.Stop()
+		s.s3 = nil
+	}
+}
+
+// startS3 starts the S3 timer after a request was handled, unless the
+// default session is active.
+func (s *SessionManager) startS3() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session == uds.DefaultSession || s.S3Timeout <= 0 {
+		return
+	}
+	generation := s.s3Generation
+	s.s3 = time.AfterFunc(s.S3Timeout, func() { s.expireS3(generation) })
+}
+
+// expireS3 returns to the default session unless a request was received
+// since the timer of generation was started.
+func (s *SessionManager) expireS3(generation int) {
+	s.mu.Lock()
+	run := s.expire
+	s.mu.Unlock()
+	if run == nil {
+		run = func(f func()) { f() }
+	}
+	run(func() {
+		s.mu.Lock()
+		expired := generation == s.s3Generation && s.session != uds.DefaultSession
+		if generation == s.s3Generation {
+			s.s3 = nil
+		}
+		s.mu.Unlock()
+		if expired {
+			s.ChangeSession(uds.DefaultSession)
+		}
+	})
+}
+
+// setExpire sets how the S3 expiry is run.
+func (s *SessionManager) setExpire(expire func(f func())) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire = expire
+}
+
+// observe updates the state from a positive response sent by a handler, so
+// handlers that build their own responses keep the manager in sync.
+func (s *SessionManager) observe(sid uds.SID, response []byte) {
+	if len(response) < 2 || uds.SID(response[0]) != uds.PositiveResponseSID(sid) {
+		return
+	}
+	subFunction := response[1] & 0x7F
+	switch sid {
+	case uds.DiagnosticSessionControl:
+		s.ChangeSession(subFunction)
+	case uds.ECUReset:
+		s.Reset(subFunction)
+	case uds.SecurityAccess:
+		if subFunction != 0 && subFunction%2 == 0 {
+			s.Unlock(subFunction - 1)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/atredispartners/uds-zoo/uds/node/security"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// nrcOf returns the response code of err, zero when err is nil.
+func nrcOf(err error) uds.NRC {
+	if err == nil {
+		return 0
+	}
+	return uds.ToNegativeResponse(uds.SecurityAccess, err).Code
+}
+
+// testSessionManager unlocks level 0x01 with the seed inverted, level 0x05
+// is not supported.
+func testSessionManager() *SessionManager {
+	s := NewSessionManager()
+	s.LockoutDelay = 50 * time.Millisecond
+	s.Hooks.Seed = func(level byte) []byte {
+		if level == 0x05 {
+			return nil
+		}
+		return []byte{level, 0x12, 0x34, 0x56}
+	}
+	s.Hooks.ValidKey = func(level byte, seed []byte, key []byte) bool {
+		return bytes.Equal(key, invert(seed))
+	}
+	return s
+}
+
+func invert(b []byte) []byte {
+	out := make([]byte, len(b))
+	for n := range b {
+		out[n] = ^b[n]
+	}
+	return out
+}
+
+func TestSessionManagerSecurityAccess(t *testing.T) {
+	good := invert([]byte{0x01, 0x12, 0x34, 0x56})
+	bad := []byte{0x00, 0x00, 0x00, 0x00}
+	tests := []struct {
+		name  string
+		seed  bool
+		level byte
+		key   []byte
+		nrc   uds.NRC
+	}{
+		{"even requestSeed", true, 0x02, nil, uds.SFNS},
+		{"odd sendKey", false, 0x01, good, uds.SFNS},
+		{"sendKey without seed", false, 0x02, good, uds.RSE},
+		{"level without seed", true, 0x05, nil, uds.SFNS},
+		{"seed", true, 0x01, nil, 0},
+		{"sendKey for another level", false, 0x04, good, uds.RSE},
+		{"seed again", true, 0x01, nil, 0},
+		{"first invalid key", false, 0x02, bad, uds.IK},
+		{"key after a rejected key", false, 0x02, good, uds.RSE},
+		{"seed after first invalid key", true, 0x01, nil, 0},
+		{"second invalid key", false, 0x02, bad, uds.IK},
+		{"seed after second invalid key", true, 0x01, nil, 0},
+		{"third invalid key", false, 0x02, bad, uds.ENOA},
+		{"seed during lockout", true, 0x01, nil, uds.RTDNE},
+		{"key during lockout", false, 0x02, good, uds.RTDNE},
+	}
+	s := testSessionManager()
+	for _, tt := range tests {
+		var err error
+		if tt.seed {
+			var seed []byte
+			seed, err = s.RequestSeed(tt.level)
+			if err == nil && !bytes.Equal(seed, []byte{tt.level, 0x12, 0x34, 0x56}) {
+				t.Errorf("%s: seed % X", tt.name, seed)
+			}
+		} else {
+			err = s.SendKey(tt.level, tt.key)
+		}
+		if got := nrcOf(err); got != tt.nrc {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.nrc)
+		}
+	}
+	if got := s.Attempts(); got != 3 {
+		t.Errorf("Attempts = %d, want 3", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := s.RequestSeed(0x01); err != nil {
+		t.Fatalf("seed after delay: %v", err)
+	}
+	if err := s.SendKey(0x02, bad); nrcOf(err) != uds.ENOA {
+		t.Errorf("invalid key after delay = %v, want %v", err, uds.ENOA)
+	}
+	time.Sleep(60 * time.Millisecond)
+	s.RequestSeed(0x01)
+	if err := s.SendKey(0x02, good); err != nil {
+		t.Fatalf("valid key after delay: %v", err)
+	}
+	if !s.IsUnlocked(0x01) || s.Attempts() != 0 {
+		t.Errorf("after valid key IsUnlocked = %v, Attempts = %d", s.IsUnlocked(0x01), s.Attempts())
+	}
+	if seed, err := s.RequestSeed(0x01); err != nil || !bytes.Equal(seed, make([]byte, 4)) {
+		t.Errorf("seed of unlocked level = % X, %v, want zero seed", seed, err)
+	}
+}
+
+func TestSessionManagerLockoutWithoutDelay(t *testing.T) {
+	s := testSessionManager()
+	s.LockoutDelay = 0
+	for n := 0; n < s.MaxAttempts; n++ {
+		s.RequestSeed(0x01)
+		s.SendKey(0x02, nil)
+	}
+	if _, err := s.RequestSeed(0x01); nrcOf(err) != uds.ENOA {
+		t.Errorf("seed during lockout = %v, want %v", err, uds.ENOA)
+	}
+	// a reset does not end a lockout without delay
+	s.Reset(uds.HardReset)
+	if _, err := s.RequestSeed(0x01); nrcOf(err) != uds.ENOA {
+		t.Errorf("seed after reset = %v, want %v", err, uds.ENOA)
+	}
+	s.ClearAttempts()
+	if _, err := s.RequestSeed(0x01); err != nil {
+		t.Errorf("seed after ClearAttempts = %v", err)
+	}
+}
+
+func TestSessionManagerResetRestartsLockout(t *testing.T) {
+	s := testSessionManager()
+	for n := 0; n < s.MaxAttempts; n++ {
+		s.RequestSeed(0x01)
+		s.SendKey(0x02, nil)
+	}
+	time.Sleep(60 * time.Millisecond)
+	s.Reset(uds.HardReset)
+	if _, err := s.RequestSeed(0x01); nrcOf(err) != uds.RTDNE {
+		t.Errorf("seed after reset = %v, want %v", err, uds.RTDNE)
+	}
+}
+
+func TestSessionManagerLocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(s *SessionManager)
+		session byte
+		entered int
+	}{
+		{"change session", func(s *SessionManager) { s.ChangeSession(uds.ProgrammingSession) }, uds.ProgrammingSession, 0},
+		{"same session", func(s *SessionManager) { s.ChangeSession(uds.ExtendedDiagnosticSession) }, uds.ExtendedDiagnosticSession, 0},
+		{"default session", func(s *SessionManager) { s.ChangeSession(uds.DefaultSession) }, uds.DefaultSession, 1},
+		{"reset", func(s *SessionManager) { s.Reset(uds.SoftReset) }, uds.DefaultSession, 1},
+		{"lock", func(s *SessionManager) { s.Lock() }, uds.ExtendedDiagnosticSession, 0},
+	}
+	for _, tt := range tests {
+		s := testSessionManager()
+		entered := 0
+		s.whenDefaultSession(func() { entered++ })
+		var changes [][2]byte
+		s.Hooks.OnSessionChange = func(s *SessionManager, from byte, to byte) {
+			changes = append(changes, [2]byte{from, to})
+		}
+		s.ChangeSession(uds.ExtendedDiagnosticSession)
+		s.Unlock(0x01)
+		s.Authenticate("tester")
+		s.RequestSeed(0x03)
+		tt.change(s)
+		if s.Session() != tt.session {
+			t.Errorf("%s: session 0x%02X, want 0x%02X", tt.name, s.Session(), tt.session)
+		}
+		if s.IsUnlocked(0x01) {
+			t.Errorf("%s: level 0x01 still unlocked", tt.name)
+		}
+		if err := s.SendKey(0x04, nil); nrcOf(err) != uds.RSE {
+			t.Errorf("%s: seed not forgotten, sendKey = %v", tt.name, err)
+		}
+		if s.HasRole("tester") != (tt.entered == 0) {
+			t.Errorf("%s: HasRole = %v", tt.name, s.HasRole("tester"))
+		}
+		if entered != tt.entered {
+			t.Errorf("%s: default session entered %d times, want %d", tt.name, entered, tt.entered)
+		}
+		if len(changes) == 0 || changes[0] != [2]byte{uds.DefaultSession, uds.ExtendedDiagnosticSession} {
+			t.Errorf("%s: OnSessionChange calls %v", tt.name, changes)
+		}
+	}
+}
+
+func TestSessionManagerObserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		sid      uds.SID
+		response []byte
+		session  byte
+		// unlocked holds whether levels 0x01 and 0x03 are unlocked
+		unlocked [2]bool
+	}{
+		{"session change", uds.DiagnosticSessionControl, []byte{0x50, 0x02, 0x00, 0x32, 0x01, 0xF4}, uds.ProgrammingSession, [2]bool{false, false}},
+		{"suppressed session change", uds.DiagnosticSessionControl, []byte{0x50, 0x82}, uds.ProgrammingSession, [2]bool{false, false}},
+		{"negative session change", uds.DiagnosticSessionControl, []byte{0x7F, 0x10, 0x22}, uds.ExtendedDiagnosticSession, [2]bool{true, false}},
+		{"reset", uds.ECUReset, []byte{0x51, 0x01}, uds.DefaultSession, [2]bool{false, false}},
+		{"sendKey", uds.SecurityAccess, []byte{0x67, 0x04}, uds.ExtendedDiagnosticSession, [2]bool{true, true}},
+		{"requestSeed", uds.SecurityAccess, []byte{0x67, 0x03, 0x00}, uds.ExtendedDiagnosticSession, [2]bool{true, false}},
+		{"short", uds.ECUReset, []byte{0x51}, uds.ExtendedDiagnosticSession, [2]bool{true, false}},
+		{"other service", uds.TesterPresent, []byte{0x7E, 0x00}, uds.ExtendedDiagnosticSession, [2]bool{true, false}},
+	}
+	for _, tt := range tests {
+		s := NewSessionManager()
+		s.ChangeSession(uds.ExtendedDiagnosticSession)
+		s.Unlock(0x01)
+		s.observe(tt.sid, tt.response)
+		if s.Session() != tt.session {
+			t.Errorf("%s: session 0x%02X, want 0x%02X", tt.name, s.Session(), tt.session)
+		}
+		if got := [2]bool{s.IsUnlocked(0x01), s.IsUnlocked(0x03)}; got != tt.unlocked {
+			t.Errorf("%s: unlocked %v, want %v", tt.name, got, tt.unlocked)
+		}
+	}
+}
+
+func TestSessionManagerSeedLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		seedLength func(level byte) int
+		level      byte
+		want       int
+	}{
+		{"without hook", nil, 0x11, 4},
+		{"hook", func(level byte) int { return int(level) + 1 }, 0x11, 0x12},
+		{"zero", func(level byte) int { return 0 }, 0x11, 4},
+	}
+	for _, tt := range tests {
+		s := NewSessionManager()
+		s.Hooks.SeedLength = tt.seedLength
+		s.Unlock(tt.level)
+		// an unlocked level answers with a zero seed as long as its seeds
+		seed, err := s.RequestSeed(tt.level)
+		if err != nil || !bytes.Equal(seed, make([]byte, tt.want)) {
+			t.Errorf("%s: seed % X, %v, want %d zero bytes", tt.name, seed, err, tt.want)
+		}
+	}
+}
+
+func TestSessionManagerLevels(t *testing.T) {
+	s := NewSessionManager()
+	levels := security.Levels{0x11: {Algorithm: security.XOR{Constant: []byte{0x5A}}, SeedLength: 8}}
+	s.Hooks.Seed = levels.Seed
+	s.Hooks.SeedLength = levels.SeedLength
+	s.Hooks.ValidKey = levels.ValidKey
+	seed, err := s.RequestSeed(0x11)
+	if err != nil || len(seed) != 8 {
+		t.Fatalf("seed % X, %v", seed, err)
+	}
+	if err := s.SendKey(0x12, levels[0x11].Algorithm.Key(seed)); err != nil || !s.IsUnlocked(0x11) {
+		t.Errorf("SendKey = %v, unlocked %v", err, s.IsUnlocked(0x11))
+	}
+	if seed, err := s.RequestSeed(0x11); err != nil || !bytes.Equal(seed, make([]byte, 8)) {
+		t.Errorf("seed of the unlocked level % X, %v", seed, err)
+	}
+}
+
+func TestSessionManagerRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(s *SessionManager)
+		kept   bool
+	}{
+		{"deauthenticate", func(s *SessionManager) { s.Deauthenticate() }, false},
+		{"default session", func(s *SessionManager) { s.ChangeSession(uds.DefaultSession) }, false},
+		{"reset", func(s *SessionManager) { s.Reset(uds.HardReset) }, false},
+		{"other session", func(s *SessionManager) { s.ChangeSession(uds.ProgrammingSession) }, true},
+		{"lock", func(s *SessionManager) { s.Lock() }, true},
+	}
+	for _, tt := range tests {
+		s := NewSessionManager()
+		s.ChangeSession(uds.ExtendedDiagnosticSession)
+		s.Authenticate("engineer")
+		if !s.HasRole("engineer") || s.HasRole("tester") {
+			t.Errorf("%s: roles not granted", tt.name)
+		}
+		tt.revoke(s)
+		if s.HasRole("engineer") != tt.kept {
+			t.Errorf("%s: role kept %v, want %v", tt.name, !tt.kept, tt.kept)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package node
+
+import (
+	"sync"
+
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+// DefaultMaxNumberOfBlockLength is the maxNumberOfBlockLength of a new
+// TransferEngine, 1024 data bytes per TransferData request.
+const DefaultMaxNumberOfBlockLength = 1024 + 2
+
+// Transfer describes the transfer accepted by a TransferEngine.
+type Transfer struct {
+	// Upload is set for a RequestUpload and clear for a RequestDownload.
+	Upload bool
+	// DataFormat is the dataFormatIdentifier of the request.
+	DataFormat byte
+	Address    uint64
+	Size       uint64
+	// Transferred counts the bytes written to or read from memory so far.
+	Transferred uint64
+	// Data holds the bytes written to or read from memory so far, after
+	// Decode and before Encode.
+	Data []byte
+}
+
+// TransferEngine implements the RequestDownload or RequestUpload,
+// TransferData and RequestTransferExit sequences used to flash and dump a
+// node, writing the downloaded data into its memory map and reading the
+// uploaded data from it.
+//
+// Only one transfer is active at a time. Blocks are numbered from 0x01 and
+// the blockSequenceCounter wraps from 0xFF to 0x00, repeating the last block
+// is answered without transferring it again. Entering the default session or
+// an ECUReset aborts an active transfer.
+//
+// Example, accepting a download only when the last byte of its
+// transferRequestParameterRecord is the sum of the downloaded bytes:
+//
+//	i.Transfers().Checksum = func(t node.Transfer, parameters []byte) ([]byte, error) {
+//		var sum byte
+//		for _, b := range t.Data {
+//			sum += b
+//		}
+//		if len(parameters) == 0 || parameters[len(parameters)-1] != sum {
+//			return nil, uds.ErrGeneralProgrammingFailure
+//		}
+//		return nil, nil
+//	}
+type TransferEngine struct {
+	// MaxNumberOfBlockLength is the length of the longest TransferData
+	// request accepted, including the SID and blockSequenceCounter.
+	MaxNumberOfBlockLength uint64
+	// DataFormats lists the accepted dataFormatIdentifiers, only 0x00,
+	// neither compressed nor encrypted, when empty.
+	DataFormats []byte
+	// Decode turns a block received in dataFormatIdentifier format into the
+	// bytes written to memory, blocks are written as is when nil.
+	Decode func(format byte, block []byte) ([]byte, error)
+	// Encode turns memory read by an upload into the block sent in
+	// dataFormatIdentifier format, memory is sent as is when nil.
+	Encode func(format byte, data []byte) ([]byte, error)
+	// Checksum verifies a completed transfer on RequestTransferExit with the
+	// transferRequestParameterRecord and returns the
+	// transferResponseParameterRecord. Every transfer is accepted when nil.
+	Checksum func(t Transfer, parameters []byte) ([]byte, error)
+
+	mu       sync.Mutex
+	active   bool
+	transfer Transfer
+	memory   *memory.Map
+	// counter is the blockSequenceCounter expected next.
+	counter byte
+	// lastBlock is the last block sent by an upload, sent again when the
+	// tester repeats its counter.
+	lastBlock []byte
+}
+
+// NewTransferEngine returns an engine accepting plain transfers in blocks
+// of up to DefaultMaxNumberOfBlockLength.
+func NewTransferEngine() *TransferEngine {
+	return &TransferEngine{MaxNumberOfBlockLength: DefaultMaxNumberOfBlockLength}
+}
+
+// Active returns a copy of the active transfer.
+func (e *TransferEngine) Active() (Transfer, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := e.transfer
+	t.Data = append([]byte(nil), t.Data...)
+	return t, e.active
+}
+
+// Abort ends the active transfer.
+func (e *TransferEngine) Abort() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active = false
+	e.transfer = Transfer{}
+	e.memory = nil
+	e.lastBlock = nil
+}
+
+// RequestDownload starts a download into m and returns the
+// maxNumberOfBlockLength. A request while a transfer is active is refused
+// with conditionsNotCorrect. Unsupported data formats and memory that is not
+// mapped are out of range, memory not writable in the active session is
+// refused as WriteMemoryByAddress would.
+func (e *TransferEngine) RequestDownload(s *SessionManager, m *memory.Map, format byte, loc uds.AddressAndLength) (uint64, error) {
+	return e.request(s, m, Transfer{DataFormat: format, Address: loc.Address, Size: loc.Size})
+}
+
+// RequestUpload starts an upload from m and returns the
+// maxNumberOfBlockLength, like RequestDownload does for memory readable in
+// the active session.
+func (e *TransferEngine) RequestUpload(s *SessionManager, m *memory.Map, format byte, loc uds.AddressAndLength) (uint64, error) {
+	return e.request(s, m, Transfer{Upload: true, DataFormat: format, Address: loc.Address, Size: loc.Size})
+}
+
+func (e *TransferEngine) request(s *SessionManager, m *memory.Map, t Transfer) (uint64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.active {
+		return 0, uds.ErrConditionsNotCorrect
+	}
+	if !e.supports(t.DataFormat) || m == nil || t.Size == 0 {
+		return 0, uds.ErrRequestOutOfRange
+	}
+	r := m.Find(t.Address, t.Size)
+	if r == nil {
+		return 0, uds.ErrRequestOutOfRange
+	}
+	access := r.Write
+	if t.Upload {
+		access = r.Read
+	}
+	if err := access.Check(s); err != nil {
+		return 0, err
+	}
+	e.active = true
+	e.transfer = t
+	e.memory = m
+	e.counter = 0x01
+	e.lastBlock = nil
+	return e.MaxNumberOfBlockLength, nil
+}
+
+// TransferData transfers a block of the active transfer. A download writes
+// block and returns the transferResponseParameterRecord, an upload takes an
+// empty block and returns the next up to MaxNumberOfBlockLength-2 bytes of
+// memory. Without an active transfer the request is a
+// requestSequenceError, an unexpected counter is a wrongBlockSequenceCounter
+// and data past the requested size suspends the transfer with
+// transferDataSuspended.
+func (e *TransferEngine) TransferData(s *SessionManager, counter byte, block []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.active {
+		return nil, uds.ErrRequestSequenceError
+	}
+	if e.transfer.Upload {
+		return e.upload(s, counter, block)
+	}
+	if len(block) == 0 || uint64(len(block))+2 > e.MaxNumberOfBlockLength {
+		return nil, uds.ErrIncorrectMessageLength
+	}
+	if counter == e.counter-1 && e.transfer.Transferred > 0 {
+		// the tester missed the response to the last block and sent it again
+		return nil, nil
+	}
+	if counter != e.counter {
+		return nil, uds.ErrWrongBlockSequenceCounter
+	}
+	data := block
+	if e.Decode != nil {
+		var err error
+		if data, err = e.Decode(e.transfer.DataFormat, block); err != nil {
+			return nil, err
+		}
+	}
+	if uint64(len(data)) > e.transfer.Size-e.transfer.Transferred {
+		return nil, uds.ErrTransferDataSuspended
+	}
+	if err := e.memory.Write(s, e.transfer.Address+e.transfer.Transferred, data); err != nil {
+		return nil, err
+	}
+	e.transfer.Transferred += uint64(len(data))
+	e.transfer.Data = append(e.transfer.Data, data...)
+	e.counter++
+	return nil, nil
+}
+
+// upload reads the next block of the active upload, which is suspended once
+// every byte was sent.
+func (e *TransferEngine) upload(s *SessionManager, counter byte, block []byte) ([]byte, error) {
+	if len(block) != 0 {
+		return nil, uds.ErrIncorrectMessageLength
+	}
+	if counter == e.counter-1 && e.lastBlock != nil {
+		return append([]byte(nil), e.lastBlock...), nil
+	}
+	if counter != e.counter {
+		return nil, uds.ErrWrongBlockSequenceCounter
+	}
+	size := e.transfer.Size - e.transfer.Transferred
+	if size == 0 {
+		return nil, uds.ErrTransferDataSuspended
+	}
+	if e.MaxNumberOfBlockLength > 2 && size > e.MaxNumberOfBlockLength-2 {
+		size = e.MaxNumberOfBlockLength - 2
+	}
+	data, err := e.memory.Read(s, e.transfer.Address+e.transfer.Transferred, size)
+	if err != nil {
+		return nil, err
+	}
+	block = data
+	if e.Encode != nil {
+		if block, err = e.Encode(e.transfer.DataFormat, data); err != nil {
+			return nil, err
+		}
+	}
+	e.transfer.Transferred += size
+	e.transfer.Data = append(e.transfer.Data, data...)
+	e.lastBlock = block
+	e.counter++
+	return append([]byte(nil), block...), nil
+}
+
+// RequestTransferExit ends the active transfer once every byte was
+// transferred and returns the transferResponseParameterRecord from
+// Checksum. A transfer that is not complete is a requestSequenceError, a
+// failing Checksum keeps the transfer active.
+func (e *TransferEngine) RequestTransferExit(parameters []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.active || e.transfer.Transferred != e.transfer.Size {
+		return nil, uds.ErrRequestSequenceError
+	}
+	var record []byte
+	if e.Checksum != nil {
+		var err error
+		if record, err = e.Checksum(e.transfer, parameters); err != nil {
+			return nil, err
+		}
+	}
+	e.active = false
+	e.transfer = Transfer{}
+	e.memory = nil
+	e.lastBlock = nil
+	return record, nil
+}
+
+func (e *TransferEngine) supports(format byte) bool {
+	if len(e.DataFormats) == 0 {
+		return format == 0x00
+	}
+	for _, f := range e.DataFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
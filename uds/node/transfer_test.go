@@ -0,0 +1,135 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/atredispartners/uds-zoo/uds/node/memory"
+	"github.com/atredispartners/uds-zoo/uds/uds"
+)
+
+func testTransferMemory(t *testing.T) *memory.Map {
+	t.Helper()
+	m, err := memory.NewMap(
+		&memory.Region{Name: "flash", Kind: memory.Flash, Base: 0x1000, Data: make([]byte, 8)},
+		&memory.Region{Name: "boot", Kind: memory.Flash, Base: 0x2000, Data: make([]byte, 8),
+			Read: memory.NoAccess, Write: memory.Access{SecurityLevel: 0x01}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestTransfer(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"data without transfer", "36 01 aa", "7f 3624"},
+		{"exit without transfer", "37", "7f 3724"},
+		{"compressed download", "34 10 44 00001000 00000004", "7f 3431"},
+		{"download unmapped", "34 00 44 00003000 00000004", "7f 3431"},
+		{"download past region", "34 00 44 00001006 00000004", "7f 3431"},
+		{"download locked", "34 00 44 00002000 00000004", "7f 3433"},
+		{"upload denied", "35 00 44 00002000 00000004", "7f 3531"},
+		{"download", "34 00 44 00001000 00000004", "74 200402"},
+		{"download while active", "34 00 44 00001000 00000004", "7f 3422"},
+		{"upload while active", "35 00 44 00001000 00000004", "7f 3522"},
+		{"wrong counter", "36 02 aabb", "7f 3673"},
+		{"empty block", "36 01", "7f 3613"},
+		{"block", "36 01 aabb", "76 01"},
+		{"repeated block", "36 01 aabb", "76 01"},
+		{"incomplete exit", "37", "7f 3724"},
+		{"past size", "36 02 ccddee", "7f 3671"},
+		{"last block", "36 02 ccdd", "76 02"},
+		{"exit", "37", "77 "},
+		{"data after exit", "36 03 00", "7f 3624"},
+		{"downloaded", "23 24 00001000 0004", "63 aabbccdd"},
+		{"upload", "35 00 44 00001001 00000002", "75 200402"},
+		{"upload with data", "36 01 00", "7f 3613"},
+		{"upload block", "36 01", "76 01bbcc"},
+		{"repeated upload block", "36 01", "76 01bbcc"},
+		{"upload past size", "36 02", "7f 3671"},
+		{"upload exit", "37", "77 "},
+		{"download before reset", "34 00 44 00001000 00000004", "74 200402"},
+		{"reset", "11 01", "51 01"},
+		{"data after reset", "36 01 aa", "7f 3624"},
+		{"download after reset", "34 00 44 00001000 00000004", "74 200402"},
+	}
+	i := newTestInstance(t, InstanceConfig{Memory: testTransferMemory(t)})
+	for _, tt := range tests {
+		if _, received := exchange(i, tt.request); len(received) != 1 || received[0] != tt.want {
+			t.Errorf("%s: received %v, want %s", tt.name, received, tt.want)
+		}
+	}
+}
+
+func TestTransferEngineHooks(t *testing.T) {
+	xor := func(format byte, block []byte) ([]byte, error) {
+		out := make([]byte, len(block))
+		for n, b := range block {
+			out[n] = b ^ format
+		}
+		return out, nil
+	}
+	e := NewTransferEngine()
+	e.MaxNumberOfBlockLength = 5
+	e.DataFormats = []byte{0x00, 0xFF}
+	e.Decode = xor
+	e.Encode = xor
+	e.Checksum = func(t Transfer, parameters []byte) ([]byte, error) {
+		var sum byte
+		for _, b := range t.Data {
+			sum += b
+		}
+		if len(parameters) != 1 || parameters[0] != sum {
+			return nil, uds.ErrGeneralProgrammingFailure
+		}
+		return []byte{sum}, nil
+	}
+	s := NewSessionManager()
+	m := testTransferMemory(t)
+	loc := uds.AddressAndLength{Address: 0x1000, Size: 4}
+
+	if _, err := e.RequestDownload(s, m, 0x11, loc); nrcOf(err) != uds.ROOR {
+		t.Errorf("unsupported format: %v", err)
+	}
+	if n, err := e.RequestDownload(s, m, 0xFF, loc); err != nil || n != 5 {
+		t.Errorf("RequestDownload = %d, %v", n, err)
+	}
+	if _, err := e.TransferData(s, 0x01, []byte{0xFE, 0xFD, 0xFC, 0xFB}); nrcOf(err) != uds.IMLOIF {
+		t.Errorf("block past MaxNumberOfBlockLength: %v", err)
+	}
+	for n, block := range [][]byte{{0xFE, 0xFD, 0xFC}, {0xFB}} {
+		if _, err := e.TransferData(s, byte(n+1), block); err != nil {
+			t.Errorf("block %d: %v", n+1, err)
+		}
+	}
+	if active, ok := e.Active(); !ok || !bytes.Equal(active.Data, []byte{0x01, 0x02, 0x03, 0x04}) || active.Transferred != 4 {
+		t.Errorf("Active = %+v, %v", active, ok)
+	}
+	if _, err := e.RequestTransferExit([]byte{0x42}); nrcOf(err) != uds.GPF {
+		t.Errorf("wrong checksum: %v", err)
+	}
+	if record, err := e.RequestTransferExit([]byte{0x0A}); err != nil || !bytes.Equal(record, []byte{0x0A}) {
+		t.Errorf("RequestTransferExit = % X, %v", record, err)
+	}
+	if got, _ := m.Peek(0x1000, 4); !bytes.Equal(got, []byte{0x01, 0x02, 0x03, 0x04}) {
+		t.Errorf("downloaded % X", got)
+	}
+
+	if _, err := e.RequestUpload(s, m, 0xFF, loc); err != nil {
+		t.Errorf("RequestUpload: %v", err)
+	}
+	for n, want := range [][]byte{{0xFE, 0xFD, 0xFC}, {0xFB}} {
+		if got, err := e.TransferData(s, byte(n+1), nil); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("block %d = % X, %v, want % X", n+1, got, err, want)
+		}
+	}
+	e.Abort()
+	if _, ok := e.Active(); ok {
+		t.Errorf("transfer active after Abort")
+	}
+}
@@ -0,0 +1,128 @@
+package uds
+
+import "fmt"
+
+// AddressAndLength is a memoryAddress and memorySize together with the
+// addressAndLengthFormatIdentifier describing their encoding, as sent by
+// ReadMemoryByAddress, WriteMemoryByAddress, DynamicallyDefineDataIdentifier,
+// RequestDownload and RequestUpload requests. The low nibble of Format is the
+// length of Address and the high nibble the length of Size, in bytes.
+type AddressAndLength struct {
+	Format  byte
+	Address uint64
+	Size    uint64
+}
+
+// NewAddressAndLength returns address and size with the shortest format
+// able to hold them.
+func NewAddressAndLength(address uint64, size uint64) AddressAndLength {
+	return AddressAndLength{
+		Format:  byte(minBytes(size))<<4 | byte(minBytes(address)),
+		Address: address,
+		Size:    size,
+	}
+}
+
+// Lengths returns the lengths of the memoryAddress and memorySize in bytes.
+func (a AddressAndLength) Lengths() (addressLength int, sizeLength int) {
+	return int(a.Format & 0x0F), int(a.Format >> 4)
+}
+
+// End returns the address following the last byte of the range.
+func (a AddressAndLength) End() uint64 {
+	return a.Address + a.Size
+}
+
+// Validate returns a DecodeError carrying ROOR when the format has a zero
+// or longer than 8 byte nibble, when Address or Size don't fit the format or
+// when the range runs past the last address the format is able to encode.
+func (a AddressAndLength) Validate(sid SID) error {
+	addrLen, sizeLen := a.Lengths()
+	if addrLen == 0 || sizeLen == 0 || addrLen > 8 || sizeLen > 8 {
+		return errOutOfRange(sid, fmt.Sprintf("invalid addressAndLengthFormatIdentifier 0x%02X", a.Format))
+	}
+	if !fits(a.Address, addrLen) || !fits(a.Size, sizeLen) {
+		return errOutOfRange(sid, "memoryAddress or memorySize does not fit addressAndLengthFormatIdentifier")
+	}
+	if a.Size > 0 {
+		last := a.Address + a.Size - 1
+		if last < a.Address || !fits(last, addrLen) {
+			return errOutOfRange(sid, "memoryAddress plus memorySize overflows the address space")
+		}
+	}
+	return nil
+}
+
+// Append validates a and appends its format, address and size to buf.
+func (a AddressAndLength) Append(buf []byte, sid SID) ([]byte, error) {
+	if err := a.Validate(sid); err != nil {
+		return nil, err
+	}
+	return a.appendLocation(append(buf, a.Format)), nil
+}
+
+// appendLocation appends the address and size without the format, as repeated
+// by defineByMemoryAddress.
+func (a AddressAndLength) appendLocation(buf []byte) []byte {
+	addrLen, sizeLen := a.Lengths()
+	buf = putUint(buf, a.Address, addrLen)
+	return putUint(buf, a.Size, sizeLen)
+}
+
+// DecodeAddressAndLength decodes the addressAndLengthFormatIdentifier,
+// memoryAddress and memorySize at the start of data and returns the bytes
+// following them. A short payload is a DecodeError carrying IMLOIF, an
+// invalid one carries ROOR, see Validate.
+func DecodeAddressAndLength(sid SID, data []byte) (AddressAndLength, []byte, error) {
+	r := newReader(sid, data)
+	a := r.addressAndLength()
+	if r.err != nil {
+		return AddressAndLength{}, data, r.err
+	}
+	return a, r.rest(), nil
+}
+
+// ParseAddressAndLength decodes a payload holding exactly one
+// addressAndLengthFormatIdentifier, memoryAddress and memorySize, like a
+// ReadMemoryByAddress request.
+func ParseAddressAndLength(sid SID, data []byte) (AddressAndLength, error) {
+	a, rest, err := DecodeAddressAndLength(sid, data)
+	if err != nil {
+		return AddressAndLength{}, err
+	}
+	if len(rest) != 0 {
+		return AddressAndLength{}, errLength(sid)
+	}
+	return a, nil
+}
+
+// addressAndLength reads an addressAndLengthFormatIdentifier followed by the
+// memoryAddress and memorySize it describes.
+func (r *reader) addressAndLength() AddressAndLength {
+	format := r.byte()
+	if r.err != nil {
+		return AddressAndLength{}
+	}
+	return r.location(format)
+}
+
+// location reads a memoryAddress and memorySize encoded as described by
+// format.
+func (r *reader) location(format byte) AddressAndLength {
+	a := AddressAndLength{Format: format}
+	addrLen, sizeLen := a.Lengths()
+	if addrLen == 0 || sizeLen == 0 || addrLen > 8 || sizeLen > 8 {
+		r.err = a.Validate(r.sid)
+		return AddressAndLength{}
+	}
+	a.Address = r.uint(addrLen)
+	a.Size = r.uint(sizeLen)
+	if r.err != nil {
+		return AddressAndLength{}
+	}
+	if err := a.Validate(r.sid); err != nil {
+		r.err = err
+		return AddressAndLength{}
+	}
+	return a
+}
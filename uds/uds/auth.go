@@ -0,0 +1,139 @@
+package uds
+
+// Authentication service, ISO 14229-1:2020. Certificates, challenges, proofs
+// of ownership, ephemeral public keys and session key information are each
+// sent with a 2 byte length.
+
+// AuthenticationRequest is 0x29 [authenticationTask][parameters].
+//
+//	deAuthenticate, authenticationConfiguration: no parameters
+//	verifyCertificateUnidirectional, verifyCertificateBidirectional:
+//		[communicationConfiguration][certificateClient][challengeClient]
+//	proofOfOwnership: [proofOfOwnershipClient][ephemeralPublicKeyClient]
+//
+// The parameters of the other tasks are kept as is in Record.
+type AuthenticationRequest struct {
+	AuthenticationTask         byte
+	CommunicationConfiguration byte
+	Certificate                []byte
+	Challenge                  []byte
+	ProofOfOwnership           []byte
+	EphemeralPublicKey         []byte
+	Record                     []byte
+}
+
+func (m *AuthenticationRequest) ServiceID() SID { return Authentication }
+
+func (m *AuthenticationRequest) MarshalPayload() ([]byte, error) {
+	buf := []byte{m.AuthenticationTask}
+	switch m.AuthenticationTask & 0x7F {
+	case DeAuthenticate, AuthenticationConfiguration:
+		return buf, nil
+	case VerifyCertificateUnidirectional, VerifyCertificateBidirectional:
+		return putLengthPrefixed(Authentication, append(buf, m.CommunicationConfiguration), m.Certificate, m.Challenge)
+	case ProofOfOwnership:
+		return putLengthPrefixed(Authentication, buf, m.ProofOfOwnership, m.EphemeralPublicKey)
+	}
+	return append(buf, m.Record...), nil
+}
+
+func (m *AuthenticationRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(Authentication, data)
+	m.AuthenticationTask = r.byte()
+	if r.err != nil {
+		return r.err
+	}
+	switch m.AuthenticationTask & 0x7F {
+	case DeAuthenticate, AuthenticationConfiguration:
+	case VerifyCertificateUnidirectional, VerifyCertificateBidirectional:
+		m.CommunicationConfiguration = r.byte()
+		m.Certificate = r.lengthPrefixed()
+		m.Challenge = r.lengthPrefixed()
+	case ProofOfOwnership:
+		m.ProofOfOwnership = r.lengthPrefixed()
+		m.EphemeralPublicKey = r.lengthPrefixed()
+	case TransmitCertificate, RequestChallengeForAuthentication, VerifyProofOfOwnershipUnidirectional, VerifyProofOfOwnershipBidirectional:
+		m.Record = r.rest()
+	default:
+		return errSubFunction(Authentication, m.AuthenticationTask)
+	}
+	return r.done()
+}
+
+// AuthenticationResponse is 0x69 [authenticationTask][authenticationReturnParameter][parameters].
+//
+//	deAuthenticate, authenticationConfiguration: no parameters
+//	verifyCertificateUnidirectional: [challengeServer][ephemeralPublicKeyServer]
+//	verifyCertificateBidirectional: [challengeServer][certificateServer]
+//		[proofOfOwnershipServer][ephemeralPublicKeyServer]
+//	proofOfOwnership: [sessionKeyInfo]
+//
+// The parameters of the other tasks are kept as is in Record.
+type AuthenticationResponse struct {
+	AuthenticationTask byte
+	ReturnParameter    byte
+	Challenge          []byte
+	Certificate        []byte
+	ProofOfOwnership   []byte
+	EphemeralPublicKey []byte
+	SessionKeyInfo     []byte
+	Record             []byte
+}
+
+func (m *AuthenticationResponse) ServiceID() SID { return Authentication + 0x40 }
+
+func (m *AuthenticationResponse) MarshalPayload() ([]byte, error) {
+	buf := []byte{m.AuthenticationTask, m.ReturnParameter}
+	switch m.AuthenticationTask & 0x7F {
+	case DeAuthenticate, AuthenticationConfiguration:
+		return buf, nil
+	case VerifyCertificateUnidirectional:
+		return putLengthPrefixed(Authentication, buf, m.Challenge, m.EphemeralPublicKey)
+	case VerifyCertificateBidirectional:
+		return putLengthPrefixed(Authentication, buf, m.Challenge, m.Certificate, m.ProofOfOwnership, m.EphemeralPublicKey)
+	case ProofOfOwnership:
+		return putLengthPrefixed(Authentication, buf, m.SessionKeyInfo)
+	}
+	return append(buf, m.Record...), nil
+}
+
+func (m *AuthenticationResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(Authentication, data)
+	m.AuthenticationTask = r.byte()
+	m.ReturnParameter = r.byte()
+	if r.err != nil {
+		return r.err
+	}
+	switch m.AuthenticationTask & 0x7F {
+	case DeAuthenticate, AuthenticationConfiguration:
+	case VerifyCertificateUnidirectional:
+		m.Challenge = r.lengthPrefixed()
+		m.EphemeralPublicKey = r.lengthPrefixed()
+	case VerifyCertificateBidirectional:
+		m.Challenge = r.lengthPrefixed()
+		m.Certificate = r.lengthPrefixed()
+		m.ProofOfOwnership = r.lengthPrefixed()
+		m.EphemeralPublicKey = r.lengthPrefixed()
+	case ProofOfOwnership:
+		m.SessionKeyInfo = r.lengthPrefixed()
+	default:
+		m.Record = r.rest()
+	}
+	return r.done()
+}
+
+// lengthPrefixed reads a field preceded by its 2 byte length.
+func (r *reader) lengthPrefixed() []byte {
+	return r.bytes(int(r.uint16()))
+}
+
+// putLengthPrefixed appends each field preceded by its 2 byte length.
+func putLengthPrefixed(sid SID, buf []byte, fields ...[]byte) ([]byte, error) {
+	for _, f := range fields {
+		if !fits(uint64(len(f)), 2) {
+			return nil, errOutOfRange(sid, "parameter longer than 0xFFFF bytes")
+		}
+		buf = append(putUint(buf, uint64(len(f)), 2), f...)
+	}
+	return buf, nil
+}
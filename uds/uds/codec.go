@@ -0,0 +1,224 @@
+package uds
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Message is implemented by every typed request and response in this package.
+// MarshalPayload and UnmarshalPayload operate on the bytes following the
+// service identifier, which is the same slice handlers receive from a node.
+type Message interface {
+	// ServiceID returns the identifier that starts the encoded message. For
+	// responses this is the positive response identifier (request SID + 0x40).
+	ServiceID() SID
+	MarshalPayload() ([]byte, error)
+	UnmarshalPayload([]byte) error
+}
+
+// DecodeError is returned when a message can not be decoded. NRC holds the
+// negative response code a server should reply with for the request.
+type DecodeError struct {
+	SID    SID
+	NRC    NRC
+	Reason string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("uds: decoding service 0x%02X: %s (NRC 0x%02X)", byte(e.SID), e.Reason, byte(e.NRC))
+}
+
+// ErrEmptyMessage is returned by Unmarshal and ParseRequest when no bytes are
+// provided, not even a service identifier.
+var ErrEmptyMessage = errors.New("uds: empty message")
+
+// Marshal encodes m into a complete UDS message, service identifier first.
+func Marshal(m Message) ([]byte, error) {
+	payload, err := m.MarshalPayload()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(m.ServiceID())}, payload...), nil
+}
+
+// NewResponse encodes m into a Response.
+func NewResponse(m Message) (Response, error) {
+	payload, err := m.MarshalPayload()
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{SID: m.ServiceID(), Data: payload}, nil
+}
+
+// Bytes returns the complete request message, service identifier first.
+func (r Request) Bytes() []byte {
+	return append([]byte{byte(r.SID)}, r.Data...)
+}
+
+// Bytes returns the complete response message, service identifier first.
+func (r Response) Bytes() []byte {
+	return append([]byte{byte(r.SID)}, r.Data...)
+}
+
+// Unmarshal decodes a complete UDS message into m. The first byte of data must
+// match the service identifier of m.
+func Unmarshal(data []byte, m Message) error {
+	if len(data) == 0 {
+		return ErrEmptyMessage
+	}
+	if SID(data[0]) != m.ServiceID() {
+		return fmt.Errorf("uds: message SID 0x%02X does not match 0x%02X", data[0], byte(m.ServiceID()))
+	}
+	return m.UnmarshalPayload(data[1:])
+}
+
+// requestMessages builds an empty request message for every service with a
+// typed codec in this package.
+var requestMessages = map[SID]func() Message{
+	DiagnosticSessionControl:        func() Message { return &DiagnosticSessionControlRequest{} },
+	ECUReset:                        func() Message { return &ECUResetRequest{} },
+	SecurityAccess:                  func() Message { return &SecurityAccessRequest{} },
+	CommunicationControl:            func() Message { return &CommunicationControlRequest{} },
+	Authentication:                  func() Message { return &AuthenticationRequest{} },
+	TesterPresent:                   func() Message { return &TesterPresentRequest{} },
+	AccessTimingParameter:           func() Message { return &AccessTimingParameterRequest{} },
+	SecuredDataTransmission:         func() Message { return &SecuredDataTransmissionRequest{} },
+	ControlDTCSetting:               func() Message { return &ControlDTCSettingRequest{} },
+	ResponseOnEvent:                 func() Message { return &ResponseOnEventRequest{} },
+	LinkControl:                     func() Message { return &LinkControlRequest{} },
+	ReadDataByIdentifier:            func() Message { return &ReadDataByIdentifierRequest{} },
+	ReadMemoryByAddress:             func() Message { return &ReadMemoryByAddressRequest{} },
+	ReadScalingDataByIdentifier:     func() Message { return &ReadScalingDataByIdentifierRequest{} },
+	ReadDataByPeriodicIdentifier:    func() Message { return &ReadDataByPeriodicIdentifierRequest{} },
+	DynamicallyDefineDataIdentifier: func() Message { return &DynamicallyDefineDataIdentifierRequest{} },
+	WriteDataByIdentifier:           func() Message { return &WriteDataByIdentifierRequest{} },
+	WriteMemoryByAddress:            func() Message { return &WriteMemoryByAddressRequest{} },
+	ClearDiagnosticInformation:      func() Message { return &ClearDiagnosticInformationRequest{} },
+	ReadDTCInformation:              func() Message { return &ReadDTCInformationRequest{} },
+	InputOutputControlByIdentifier:  func() Message { return &InputOutputControlByIdentifierRequest{} },
+	RoutineControl:                  func() Message { return &RoutineControlRequest{} },
+	RequestDownload:                 func() Message { return &RequestDownloadRequest{} },
+	RequestUpload:                   func() Message { return &RequestUploadRequest{} },
+	TransferData:                    func() Message { return &TransferDataRequest{} },
+	RequestTransferExit:             func() Message { return &RequestTransferExitRequest{} },
+}
+
+// ParseRequest decodes a complete request into its typed message. Requests for
+// services without a codec return a DecodeError carrying SNS.
+func ParseRequest(data []byte) (Message, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	newMessage, ok := requestMessages[SID(data[0])]
+	if !ok {
+		return nil, &DecodeError{SID: SID(data[0]), NRC: SNS, Reason: "service not supported"}
+	}
+	m := newMessage()
+	if err := m.UnmarshalPayload(data[1:]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func errLength(sid SID) error {
+	return &DecodeError{SID: sid, NRC: IMLOIF, Reason: "incorrect message length"}
+}
+
+func errSubFunction(sid SID, subFunction byte) error {
+	return &DecodeError{SID: sid, NRC: SFNS, Reason: fmt.Sprintf("sub-function 0x%02X not supported", subFunction)}
+}
+
+func errOutOfRange(sid SID, reason string) error {
+	return &DecodeError{SID: sid, NRC: ROOR, Reason: reason}
+}
+
+// reader walks a payload and records the first length error it hits, so the
+// message decoders can read fields without checking after each one.
+type reader struct {
+	sid  SID
+	data []byte
+	err  error
+}
+
+func newReader(sid SID, data []byte) *reader {
+	return &reader{sid: sid, data: data}
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data) < n {
+		r.err = errLength(r.sid)
+		return nil
+	}
+	out := r.data[:n:n]
+	r.data = r.data[n:]
+	return out
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint(n int) uint64 {
+	return bytesToUint64(r.bytes(n))
+}
+
+func (r *reader) uint16() uint16 {
+	return uint16(r.uint(2))
+}
+
+// rest returns every byte left in the payload.
+func (r *reader) rest() []byte {
+	return r.bytes(len(r.data))
+}
+
+func (r *reader) remaining() int {
+	return len(r.data)
+}
+
+// done reports the first decoding error, or IMLOIF when bytes are left over.
+func (r *reader) done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) != 0 {
+		return errLength(r.sid)
+	}
+	return nil
+}
+
+func bytesToUint64(b []byte) uint64 {
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v
+}
+
+// putUint appends the n least significant bytes of v in big endian order.
+func putUint(buf []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, byte(v>>(8*uint(i))))
+	}
+	return buf
+}
+
+// fits reports whether v can be encoded in n bytes.
+func fits(v uint64, n int) bool {
+	return n >= 8 || v>>(8*uint(n)) == 0
+}
+
+// minBytes returns the smallest number of bytes, at least one, that hold v.
+func minBytes(v uint64) int {
+	n := 1
+	for n < 8 && !fits(v, n) {
+		n++
+	}
+	return n
+}
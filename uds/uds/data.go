@@ -0,0 +1,416 @@
+package uds
+
+// Data transmission services.
+
+// DataRecord pairs a data identifier with its value.
+type DataRecord struct {
+	DataIdentifier uint16
+	Data           []byte
+}
+
+// ReadDataByIdentifierRequest is 0x22 [dataIdentifier]...
+type ReadDataByIdentifierRequest struct {
+	DataIdentifiers []uint16
+}
+
+func (m *ReadDataByIdentifierRequest) ServiceID() SID { return ReadDataByIdentifier }
+
+func (m *ReadDataByIdentifierRequest) MarshalPayload() ([]byte, error) {
+	var buf []byte
+	for _, did := range m.DataIdentifiers {
+		buf = putUint(buf, uint64(did), 2)
+	}
+	return buf, nil
+}
+
+func (m *ReadDataByIdentifierRequest) UnmarshalPayload(data []byte) error {
+	if len(data) == 0 || len(data)%2 != 0 {
+		return errLength(ReadDataByIdentifier)
+	}
+	r := newReader(ReadDataByIdentifier, data)
+	m.DataIdentifiers = make([]uint16, 0, len(data)/2)
+	for r.remaining() > 0 {
+		m.DataIdentifiers = append(m.DataIdentifiers, r.uint16())
+	}
+	return r.done()
+}
+
+// ReadDataByIdentifierResponse is 0x62 ([dataIdentifier][dataRecord])...
+// The length of a data record is only known to the server, so decoding places
+// everything after the first data identifier into a single record.
+type ReadDataByIdentifierResponse struct {
+	Records []DataRecord
+}
+
+func (m *ReadDataByIdentifierResponse) ServiceID() SID { return ReadDataByIdentifier + 0x40 }
+
+func (m *ReadDataByIdentifierResponse) MarshalPayload() ([]byte, error) {
+	var buf []byte
+	for _, rec := range m.Records {
+		buf = putUint(buf, uint64(rec.DataIdentifier), 2)
+		buf = append(buf, rec.Data...)
+	}
+	return buf, nil
+}
+
+func (m *ReadDataByIdentifierResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadDataByIdentifier, data)
+	rec := DataRecord{DataIdentifier: r.uint16()}
+	rec.Data = r.rest()
+	m.Records = []DataRecord{rec}
+	return r.done()
+}
+
+// ReadMemoryByAddressRequest is 0x23 [addressAndLengthFormatIdentifier][memoryAddress][memorySize].
+type ReadMemoryByAddressRequest struct {
+	AddressAndLengthFormatIdentifier byte
+	MemoryAddress                    uint64
+	MemorySize                       uint64
+}
+
+func (m *ReadMemoryByAddressRequest) ServiceID() SID { return ReadMemoryByAddress }
+
+func (m *ReadMemoryByAddressRequest) MarshalPayload() ([]byte, error) {
+	return AddressAndLength{Format: m.AddressAndLengthFormatIdentifier, Address: m.MemoryAddress, Size: m.MemorySize}.Append(nil, ReadMemoryByAddress)
+}
+
+func (m *ReadMemoryByAddressRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadMemoryByAddress, data)
+	a := r.addressAndLength()
+	m.AddressAndLengthFormatIdentifier, m.MemoryAddress, m.MemorySize = a.Format, a.Address, a.Size
+	return r.done()
+}
+
+// ReadMemoryByAddressResponse is 0x63 [dataRecord].
+type ReadMemoryByAddressResponse struct {
+	DataRecord []byte
+}
+
+func (m *ReadMemoryByAddressResponse) ServiceID() SID { return ReadMemoryByAddress + 0x40 }
+
+func (m *ReadMemoryByAddressResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte(nil), m.DataRecord...), nil
+}
+
+func (m *ReadMemoryByAddressResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadMemoryByAddress, data)
+	m.DataRecord = r.rest()
+	return r.done()
+}
+
+// ReadScalingDataByIdentifierRequest is 0x24 [dataIdentifier].
+type ReadScalingDataByIdentifierRequest struct {
+	DataIdentifier uint16
+}
+
+func (m *ReadScalingDataByIdentifierRequest) ServiceID() SID { return ReadScalingDataByIdentifier }
+
+func (m *ReadScalingDataByIdentifierRequest) MarshalPayload() ([]byte, error) {
+	return putUint(nil, uint64(m.DataIdentifier), 2), nil
+}
+
+func (m *ReadScalingDataByIdentifierRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadScalingDataByIdentifier, data)
+	m.DataIdentifier = r.uint16()
+	return r.done()
+}
+
+// ReadScalingDataByIdentifierResponse is 0x64 [dataIdentifier][scalingByte][scalingByteExtension]...
+type ReadScalingDataByIdentifierResponse struct {
+	DataIdentifier uint16
+	ScalingData    []byte
+}
+
+func (m *ReadScalingDataByIdentifierResponse) ServiceID() SID {
+	return ReadScalingDataByIdentifier + 0x40
+}
+
+func (m *ReadScalingDataByIdentifierResponse) MarshalPayload() ([]byte, error) {
+	return append(putUint(nil, uint64(m.DataIdentifier), 2), m.ScalingData...), nil
+}
+
+func (m *ReadScalingDataByIdentifierResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadScalingDataByIdentifier, data)
+	m.DataIdentifier = r.uint16()
+	m.ScalingData = r.rest()
+	return r.done()
+}
+
+// ReadDataByPeriodicIdentifierRequest is 0x2A [transmissionMode][periodicDataIdentifier]...
+// Periodic data identifiers are the low byte of the 0xF2xx data identifiers.
+type ReadDataByPeriodicIdentifierRequest struct {
+	TransmissionMode        byte
+	PeriodicDataIdentifiers []byte
+}
+
+func (m *ReadDataByPeriodicIdentifierRequest) ServiceID() SID {
+	return ReadDataByPeriodicIdentifier
+}
+
+func (m *ReadDataByPeriodicIdentifierRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.TransmissionMode}, m.PeriodicDataIdentifiers...), nil
+}
+
+func (m *ReadDataByPeriodicIdentifierRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadDataByPeriodicIdentifier, data)
+	m.TransmissionMode = r.byte()
+	m.PeriodicDataIdentifiers = r.rest()
+	if err := r.done(); err != nil {
+		return err
+	}
+	if m.TransmissionMode == 0x00 || m.TransmissionMode > 0x04 {
+		return errOutOfRange(ReadDataByPeriodicIdentifier, "unknown transmissionMode")
+	}
+	// stopSending (0x04) may omit the identifiers to stop every periodic identifier
+	if m.TransmissionMode != 0x04 && len(m.PeriodicDataIdentifiers) == 0 {
+		return errLength(ReadDataByPeriodicIdentifier)
+	}
+	return nil
+}
+
+// ReadDataByPeriodicIdentifierResponse is 0x6A.
+type ReadDataByPeriodicIdentifierResponse struct{}
+
+func (m *ReadDataByPeriodicIdentifierResponse) ServiceID() SID {
+	return ReadDataByPeriodicIdentifier + 0x40
+}
+
+func (m *ReadDataByPeriodicIdentifierResponse) MarshalPayload() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (m *ReadDataByPeriodicIdentifierResponse) UnmarshalPayload(data []byte) error {
+	return newReader(ReadDataByPeriodicIdentifier, data).done()
+}
+
+// SourceDataIdentifier is one defineByIdentifier source of a dynamically
+// defined data identifier. PositionInSourceDataRecord is one based.
+type SourceDataIdentifier struct {
+	DataIdentifier             uint16
+	PositionInSourceDataRecord byte
+	MemorySize                 byte
+}
+
+// MemorySource is one defineByMemoryAddress source of a dynamically defined
+// data identifier.
+type MemorySource struct {
+	MemoryAddress uint64
+	MemorySize    uint64
+}
+
+// DynamicallyDefineDataIdentifierRequest is 0x2C [definitionType][dynamicallyDefinedDataIdentifier][sources].
+// Sources holds the defineByIdentifier (0x01) definitions, while
+// AddressAndLengthFormatIdentifier and MemorySources hold the
+// defineByMemoryAddress (0x02) ones. For clearDynamicallyDefinedDataIdentifier
+// (0x03) a zero DynamicallyDefinedDataIdentifier clears every definition.
+type DynamicallyDefineDataIdentifierRequest struct {
+	DefinitionType                   byte
+	DynamicallyDefinedDataIdentifier uint16
+	Sources                          []SourceDataIdentifier
+	AddressAndLengthFormatIdentifier byte
+	MemorySources                    []MemorySource
+}
+
+func (m *DynamicallyDefineDataIdentifierRequest) ServiceID() SID {
+	return DynamicallyDefineDataIdentifier
+}
+
+func (m *DynamicallyDefineDataIdentifierRequest) MarshalPayload() ([]byte, error) {
+	buf := []byte{m.DefinitionType}
+	switch m.DefinitionType & 0x7F {
+	case DefineByIdentifier:
+		buf = putUint(buf, uint64(m.DynamicallyDefinedDataIdentifier), 2)
+		for _, src := range m.Sources {
+			buf = putUint(buf, uint64(src.DataIdentifier), 2)
+			buf = append(buf, src.PositionInSourceDataRecord, src.MemorySize)
+		}
+	case DefineByMemoryAddress:
+		buf = putUint(buf, uint64(m.DynamicallyDefinedDataIdentifier), 2)
+		buf = append(buf, m.AddressAndLengthFormatIdentifier)
+		for _, src := range m.MemorySources {
+			loc := AddressAndLength{Format: m.AddressAndLengthFormatIdentifier, Address: src.MemoryAddress, Size: src.MemorySize}
+			if err := loc.Validate(DynamicallyDefineDataIdentifier); err != nil {
+				return nil, err
+			}
+			// the format is only sent once
+			buf = loc.appendLocation(buf)
+		}
+	case ClearDynamicallyDefinedDataIdentifier:
+		if m.DynamicallyDefinedDataIdentifier != 0 {
+			buf = putUint(buf, uint64(m.DynamicallyDefinedDataIdentifier), 2)
+		}
+	}
+	return buf, nil
+}
+
+func (m *DynamicallyDefineDataIdentifierRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(DynamicallyDefineDataIdentifier, data)
+	m.DefinitionType = r.byte()
+	if r.err != nil {
+		return r.err
+	}
+	m.DynamicallyDefinedDataIdentifier = 0
+	m.Sources = nil
+	m.AddressAndLengthFormatIdentifier = 0
+	m.MemorySources = nil
+	switch m.DefinitionType & 0x7F {
+	case DefineByIdentifier:
+		m.DynamicallyDefinedDataIdentifier = r.uint16()
+		if r.err == nil && (r.remaining() == 0 || r.remaining()%4 != 0) {
+			return errLength(DynamicallyDefineDataIdentifier)
+		}
+		for r.err == nil && r.remaining() > 0 {
+			m.Sources = append(m.Sources, SourceDataIdentifier{
+				DataIdentifier:             r.uint16(),
+				PositionInSourceDataRecord: r.byte(),
+				MemorySize:                 r.byte(),
+			})
+		}
+	case DefineByMemoryAddress:
+		m.DynamicallyDefinedDataIdentifier = r.uint16()
+		loc := r.addressAndLength()
+		if r.err != nil {
+			return r.err
+		}
+		m.AddressAndLengthFormatIdentifier = loc.Format
+		addrLen, sizeLen := loc.Lengths()
+		if r.remaining()%(addrLen+sizeLen) != 0 {
+			return errLength(DynamicallyDefineDataIdentifier)
+		}
+		for r.err == nil {
+			m.MemorySources = append(m.MemorySources, MemorySource{MemoryAddress: loc.Address, MemorySize: loc.Size})
+			if r.remaining() == 0 {
+				break
+			}
+			loc = r.location(loc.Format)
+		}
+	case ClearDynamicallyDefinedDataIdentifier:
+		if r.remaining() > 0 {
+			m.DynamicallyDefinedDataIdentifier = r.uint16()
+		}
+	default:
+		return errSubFunction(DynamicallyDefineDataIdentifier, m.DefinitionType)
+	}
+	return r.done()
+}
+
+// DynamicallyDefineDataIdentifierResponse is 0x6C [definitionType][dynamicallyDefinedDataIdentifier].
+// The identifier is omitted when a clear request did not name one.
+type DynamicallyDefineDataIdentifierResponse struct {
+	DefinitionType                   byte
+	DynamicallyDefinedDataIdentifier uint16
+}
+
+func (m *DynamicallyDefineDataIdentifierResponse) ServiceID() SID {
+	return DynamicallyDefineDataIdentifier + 0x40
+}
+
+func (m *DynamicallyDefineDataIdentifierResponse) MarshalPayload() ([]byte, error) {
+	buf := []byte{m.DefinitionType}
+	if m.DefinitionType&0x7F != ClearDynamicallyDefinedDataIdentifier || m.DynamicallyDefinedDataIdentifier != 0 {
+		buf = putUint(buf, uint64(m.DynamicallyDefinedDataIdentifier), 2)
+	}
+	return buf, nil
+}
+
+func (m *DynamicallyDefineDataIdentifierResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(DynamicallyDefineDataIdentifier, data)
+	m.DefinitionType = r.byte()
+	m.DynamicallyDefinedDataIdentifier = 0
+	if r.err == nil && (r.remaining() > 0 || m.DefinitionType&0x7F != ClearDynamicallyDefinedDataIdentifier) {
+		m.DynamicallyDefinedDataIdentifier = r.uint16()
+	}
+	return r.done()
+}
+
+// WriteDataByIdentifierRequest is 0x2E [dataIdentifier][dataRecord].
+type WriteDataByIdentifierRequest struct {
+	DataIdentifier uint16
+	DataRecord     []byte
+}
+
+func (m *WriteDataByIdentifierRequest) ServiceID() SID { return WriteDataByIdentifier }
+
+func (m *WriteDataByIdentifierRequest) MarshalPayload() ([]byte, error) {
+	return append(putUint(nil, uint64(m.DataIdentifier), 2), m.DataRecord...), nil
+}
+
+func (m *WriteDataByIdentifierRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(WriteDataByIdentifier, data)
+	m.DataIdentifier = r.uint16()
+	m.DataRecord = r.rest()
+	if r.err == nil && len(m.DataRecord) == 0 {
+		return errLength(WriteDataByIdentifier)
+	}
+	return r.done()
+}
+
+// WriteDataByIdentifierResponse is 0x6E [dataIdentifier].
+type WriteDataByIdentifierResponse struct {
+	DataIdentifier uint16
+}
+
+func (m *WriteDataByIdentifierResponse) ServiceID() SID { return WriteDataByIdentifier + 0x40 }
+
+func (m *WriteDataByIdentifierResponse) MarshalPayload() ([]byte, error) {
+	return putUint(nil, uint64(m.DataIdentifier), 2), nil
+}
+
+func (m *WriteDataByIdentifierResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(WriteDataByIdentifier, data)
+	m.DataIdentifier = r.uint16()
+	return r.done()
+}
+
+// WriteMemoryByAddressRequest is 0x3D [addressAndLengthFormatIdentifier][memoryAddress][memorySize][dataRecord].
+// The data record must be exactly memorySize bytes long.
+type WriteMemoryByAddressRequest struct {
+	AddressAndLengthFormatIdentifier byte
+	MemoryAddress                    uint64
+	MemorySize                       uint64
+	DataRecord                       []byte
+}
+
+func (m *WriteMemoryByAddressRequest) ServiceID() SID { return WriteMemoryByAddress }
+
+func (m *WriteMemoryByAddressRequest) MarshalPayload() ([]byte, error) {
+	buf, err := AddressAndLength{Format: m.AddressAndLengthFormatIdentifier, Address: m.MemoryAddress, Size: m.MemorySize}.Append(nil, WriteMemoryByAddress)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, m.DataRecord...), nil
+}
+
+func (m *WriteMemoryByAddressRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(WriteMemoryByAddress, data)
+	a := r.addressAndLength()
+	m.AddressAndLengthFormatIdentifier, m.MemoryAddress, m.MemorySize = a.Format, a.Address, a.Size
+	m.DataRecord = r.rest()
+	if err := r.done(); err != nil {
+		return err
+	}
+	if m.MemorySize == 0 || uint64(len(m.DataRecord)) != m.MemorySize {
+		return errLength(WriteMemoryByAddress)
+	}
+	return nil
+}
+
+// WriteMemoryByAddressResponse is 0x7D [addressAndLengthFormatIdentifier][memoryAddress][memorySize].
+type WriteMemoryByAddressResponse struct {
+	AddressAndLengthFormatIdentifier byte
+	MemoryAddress                    uint64
+	MemorySize                       uint64
+}
+
+func (m *WriteMemoryByAddressResponse) ServiceID() SID { return WriteMemoryByAddress + 0x40 }
+
+func (m *WriteMemoryByAddressResponse) MarshalPayload() ([]byte, error) {
+	return AddressAndLength{Format: m.AddressAndLengthFormatIdentifier, Address: m.MemoryAddress, Size: m.MemorySize}.Append(nil, WriteMemoryByAddress)
+}
+
+func (m *WriteMemoryByAddressResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(WriteMemoryByAddress, data)
+	a := r.addressAndLength()
+	m.AddressAndLengthFormatIdentifier, m.MemoryAddress, m.MemorySize = a.Format, a.Address, a.Size
+	return r.done()
+}
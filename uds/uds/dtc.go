@@ -0,0 +1,89 @@
+package uds
+
+// Stored data transmission services.
+
+// ClearDiagnosticInformationRequest is 0x14 [groupOfDTC][memorySelection].
+// GroupOfDTC is a three byte value, 0xFFFFFF selects every DTC. The optional
+// memorySelection is only sent when HasMemorySelection is set.
+type ClearDiagnosticInformationRequest struct {
+	GroupOfDTC         uint32
+	MemorySelection    byte
+	HasMemorySelection bool
+}
+
+func (m *ClearDiagnosticInformationRequest) ServiceID() SID { return ClearDiagnosticInformation }
+
+func (m *ClearDiagnosticInformationRequest) MarshalPayload() ([]byte, error) {
+	if !fits(uint64(m.GroupOfDTC), 3) {
+		return nil, errOutOfRange(ClearDiagnosticInformation, "groupOfDTC is longer than three bytes")
+	}
+	buf := putUint(nil, uint64(m.GroupOfDTC), 3)
+	if m.HasMemorySelection {
+		buf = append(buf, m.MemorySelection)
+	}
+	return buf, nil
+}
+
+func (m *ClearDiagnosticInformationRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ClearDiagnosticInformation, data)
+	m.GroupOfDTC = uint32(r.uint(3))
+	m.MemorySelection, m.HasMemorySelection = 0, false
+	if r.err == nil && r.remaining() == 1 {
+		m.MemorySelection, m.HasMemorySelection = r.byte(), true
+	}
+	return r.done()
+}
+
+// ClearDiagnosticInformationResponse is 0x54.
+type ClearDiagnosticInformationResponse struct{}
+
+func (m *ClearDiagnosticInformationResponse) ServiceID() SID {
+	return ClearDiagnosticInformation + 0x40
+}
+
+func (m *ClearDiagnosticInformationResponse) MarshalPayload() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (m *ClearDiagnosticInformationResponse) UnmarshalPayload(data []byte) error {
+	return newReader(ClearDiagnosticInformation, data).done()
+}
+
+// ReadDTCInformationRequest is 0x19 [reportType][record]. The record layout
+// depends on the report type.
+type ReadDTCInformationRequest struct {
+	ReportType byte
+	Record     []byte
+}
+
+func (m *ReadDTCInformationRequest) ServiceID() SID { return ReadDTCInformation }
+
+func (m *ReadDTCInformationRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.ReportType}, m.Record...), nil
+}
+
+func (m *ReadDTCInformationRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadDTCInformation, data)
+	m.ReportType = r.byte()
+	m.Record = r.rest()
+	return r.done()
+}
+
+// ReadDTCInformationResponse is 0x59 [reportType][record].
+type ReadDTCInformationResponse struct {
+	ReportType byte
+	Record     []byte
+}
+
+func (m *ReadDTCInformationResponse) ServiceID() SID { return ReadDTCInformation + 0x40 }
+
+func (m *ReadDTCInformationResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.ReportType}, m.Record...), nil
+}
+
+func (m *ReadDTCInformationResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(ReadDTCInformation, data)
+	m.ReportType = r.byte()
+	m.Record = r.rest()
+	return r.done()
+}
@@ -0,0 +1,469 @@
+package uds
+
+// Diagnostic and communication management services.
+
+// DiagnosticSessionControlRequest is 0x10 [diagnosticSessionType].
+type DiagnosticSessionControlRequest struct {
+	SessionType byte
+}
+
+func (m *DiagnosticSessionControlRequest) ServiceID() SID { return DiagnosticSessionControl }
+
+func (m *DiagnosticSessionControlRequest) MarshalPayload() ([]byte, error) {
+	return []byte{m.SessionType}, nil
+}
+
+func (m *DiagnosticSessionControlRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(DiagnosticSessionControl, data)
+	m.SessionType = r.byte()
+	return r.done()
+}
+
+// DiagnosticSessionControlResponse is 0x50 [diagnosticSessionType][sessionParameterRecord].
+// P2ServerMax has a resolution of 1ms and P2StarServerMax one of 10ms.
+type DiagnosticSessionControlResponse struct {
+	SessionType     byte
+	P2ServerMax     uint16
+	P2StarServerMax uint16
+}
+
+func (m *DiagnosticSessionControlResponse) ServiceID() SID { return DiagnosticSessionControl + 0x40 }
+
+func (m *DiagnosticSessionControlResponse) MarshalPayload() ([]byte, error) {
+	buf := []byte{m.SessionType}
+	buf = putUint(buf, uint64(m.P2ServerMax), 2)
+	return putUint(buf, uint64(m.P2StarServerMax), 2), nil
+}
+
+func (m *DiagnosticSessionControlResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(DiagnosticSessionControl, data)
+	m.SessionType = r.byte()
+	m.P2ServerMax = r.uint16()
+	m.P2StarServerMax = r.uint16()
+	return r.done()
+}
+
+// ECUResetRequest is 0x11 [resetType].
+type ECUResetRequest struct {
+	ResetType byte
+}
+
+func (m *ECUResetRequest) ServiceID() SID { return ECUReset }
+
+func (m *ECUResetRequest) MarshalPayload() ([]byte, error) {
+	return []byte{m.ResetType}, nil
+}
+
+func (m *ECUResetRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ECUReset, data)
+	m.ResetType = r.byte()
+	return r.done()
+}
+
+// ECUResetResponse is 0x51 [resetType][powerDownTime]. PowerDownTime is only
+// present when ResetType is enableRapidPowerShutDown.
+type ECUResetResponse struct {
+	ResetType     byte
+	PowerDownTime byte
+}
+
+func (m *ECUResetResponse) ServiceID() SID { return ECUReset + 0x40 }
+
+func (m *ECUResetResponse) MarshalPayload() ([]byte, error) {
+	if m.ResetType&0x7F == EnableRapidPowerShutDown {
+		return []byte{m.ResetType, m.PowerDownTime}, nil
+	}
+	return []byte{m.ResetType}, nil
+}
+
+func (m *ECUResetResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(ECUReset, data)
+	m.ResetType = r.byte()
+	m.PowerDownTime = 0
+	if m.ResetType&0x7F == EnableRapidPowerShutDown {
+		m.PowerDownTime = r.byte()
+	}
+	return r.done()
+}
+
+// SecurityAccessRequest is 0x27 [securityAccessType][securityAccessDataRecord | securityKey].
+// Odd access types request a seed, even access types send the key.
+type SecurityAccessRequest struct {
+	SecurityAccessType byte
+	Data               []byte
+}
+
+func (m *SecurityAccessRequest) ServiceID() SID { return SecurityAccess }
+
+// RequestSeed reports whether the request asks for a seed rather than sending a key.
+func (m *SecurityAccessRequest) RequestSeed() bool {
+	return (m.SecurityAccessType&0x7F)%2 == 1
+}
+
+func (m *SecurityAccessRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.SecurityAccessType}, m.Data...), nil
+}
+
+func (m *SecurityAccessRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(SecurityAccess, data)
+	m.SecurityAccessType = r.byte()
+	if r.err != nil {
+		return r.err
+	}
+	if t := m.SecurityAccessType & 0x7F; t == 0x00 || t == 0x7F || (t >= 0x43 && t <= 0x5E) {
+		return errSubFunction(SecurityAccess, m.SecurityAccessType)
+	}
+	m.Data = r.rest()
+	if !m.RequestSeed() && len(m.Data) == 0 {
+		return errLength(SecurityAccess)
+	}
+	return r.done()
+}
+
+// SecurityAccessResponse is 0x67 [securityAccessType][securitySeed].
+type SecurityAccessResponse struct {
+	SecurityAccessType byte
+	SecuritySeed       []byte
+}
+
+func (m *SecurityAccessResponse) ServiceID() SID { return SecurityAccess + 0x40 }
+
+func (m *SecurityAccessResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.SecurityAccessType}, m.SecuritySeed...), nil
+}
+
+func (m *SecurityAccessResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(SecurityAccess, data)
+	m.SecurityAccessType = r.byte()
+	m.SecuritySeed = r.rest()
+	return r.done()
+}
+
+// CommunicationControlRequest is 0x28 [controlType][communicationType][nodeIdentificationNumber].
+// NodeIdentificationNumber is only present for the enhanced address control types 0x04 and 0x05.
+type CommunicationControlRequest struct {
+	ControlType              byte
+	CommunicationType        byte
+	NodeIdentificationNumber uint16
+}
+
+func (m *CommunicationControlRequest) ServiceID() SID { return CommunicationControl }
+
+func (m *CommunicationControlRequest) hasNodeIdentification() bool {
+	t := m.ControlType & 0x7F
+	return t == 0x04 || t == 0x05
+}
+
+func (m *CommunicationControlRequest) MarshalPayload() ([]byte, error) {
+	buf := []byte{m.ControlType, m.CommunicationType}
+	if m.hasNodeIdentification() {
+		buf = putUint(buf, uint64(m.NodeIdentificationNumber), 2)
+	}
+	return buf, nil
+}
+
+func (m *CommunicationControlRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(CommunicationControl, data)
+	m.ControlType = r.byte()
+	m.CommunicationType = r.byte()
+	m.NodeIdentificationNumber = 0
+	if m.hasNodeIdentification() {
+		m.NodeIdentificationNumber = r.uint16()
+	}
+	return r.done()
+}
+
+// CommunicationControlResponse is 0x68 [controlType].
+type CommunicationControlResponse struct {
+	ControlType byte
+}
+
+func (m *CommunicationControlResponse) ServiceID() SID { return CommunicationControl + 0x40 }
+
+func (m *CommunicationControlResponse) MarshalPayload() ([]byte, error) {
+	return []byte{m.ControlType}, nil
+}
+
+func (m *CommunicationControlResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(CommunicationControl, data)
+	m.ControlType = r.byte()
+	return r.done()
+}
+
+// TesterPresentRequest is 0x3E [zeroSubFunction]. Apart from the
+// suppressPosRspMsgIndicationBit the sub-function must be zero.
+type TesterPresentRequest struct {
+	ZeroSubFunction byte
+}
+
+func (m *TesterPresentRequest) ServiceID() SID { return TesterPresent }
+
+func (m *TesterPresentRequest) MarshalPayload() ([]byte, error) {
+	return []byte{m.ZeroSubFunction}, nil
+}
+
+func (m *TesterPresentRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(TesterPresent, data)
+	m.ZeroSubFunction = r.byte()
+	if err := r.done(); err != nil {
+		return err
+	}
+	if m.ZeroSubFunction&0x7F != 0x00 {
+		return errSubFunction(TesterPresent, m.ZeroSubFunction)
+	}
+	return nil
+}
+
+// TesterPresentResponse is 0x7E [zeroSubFunction].
+type TesterPresentResponse struct {
+	ZeroSubFunction byte
+}
+
+func (m *TesterPresentResponse) ServiceID() SID { return TesterPresent + 0x40 }
+
+func (m *TesterPresentResponse) MarshalPayload() ([]byte, error) {
+	return []byte{m.ZeroSubFunction}, nil
+}
+
+func (m *TesterPresentResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(TesterPresent, data)
+	m.ZeroSubFunction = r.byte()
+	return r.done()
+}
+
+// AccessTimingParameterRequest is 0x83 [timingParameterAccessType][timingParameterRequestRecord].
+type AccessTimingParameterRequest struct {
+	AccessType    byte
+	RequestRecord []byte
+}
+
+func (m *AccessTimingParameterRequest) ServiceID() SID { return AccessTimingParameter }
+
+func (m *AccessTimingParameterRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.AccessType}, m.RequestRecord...), nil
+}
+
+func (m *AccessTimingParameterRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(AccessTimingParameter, data)
+	m.AccessType = r.byte()
+	m.RequestRecord = r.rest()
+	return r.done()
+}
+
+// AccessTimingParameterResponse is 0xC3 [timingParameterAccessType][timingParameterResponseRecord].
+type AccessTimingParameterResponse struct {
+	AccessType     byte
+	ResponseRecord []byte
+}
+
+func (m *AccessTimingParameterResponse) ServiceID() SID { return AccessTimingParameter + 0x40 }
+
+func (m *AccessTimingParameterResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.AccessType}, m.ResponseRecord...), nil
+}
+
+func (m *AccessTimingParameterResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(AccessTimingParameter, data)
+	m.AccessType = r.byte()
+	m.ResponseRecord = r.rest()
+	return r.done()
+}
+
+// SecuredDataTransmissionRequest is 0x84 [securityDataRequestRecord].
+type SecuredDataTransmissionRequest struct {
+	SecurityDataRequestRecord []byte
+}
+
+func (m *SecuredDataTransmissionRequest) ServiceID() SID { return SecuredDataTransmission }
+
+func (m *SecuredDataTransmissionRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte(nil), m.SecurityDataRequestRecord...), nil
+}
+
+func (m *SecuredDataTransmissionRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(SecuredDataTransmission, data)
+	m.SecurityDataRequestRecord = r.rest()
+	if len(m.SecurityDataRequestRecord) == 0 {
+		return errLength(SecuredDataTransmission)
+	}
+	return r.done()
+}
+
+// SecuredDataTransmissionResponse is 0xC4 [securityDataResponseRecord].
+type SecuredDataTransmissionResponse struct {
+	SecurityDataResponseRecord []byte
+}
+
+func (m *SecuredDataTransmissionResponse) ServiceID() SID { return SecuredDataTransmission + 0x40 }
+
+func (m *SecuredDataTransmissionResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte(nil), m.SecurityDataResponseRecord...), nil
+}
+
+func (m *SecuredDataTransmissionResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(SecuredDataTransmission, data)
+	m.SecurityDataResponseRecord = r.rest()
+	return r.done()
+}
+
+// ControlDTCSettingRequest is 0x85 [DTCSettingType][DTCSettingControlOptionRecord].
+type ControlDTCSettingRequest struct {
+	DTCSettingType      byte
+	ControlOptionRecord []byte
+}
+
+func (m *ControlDTCSettingRequest) ServiceID() SID { return ControlDTCSetting }
+
+func (m *ControlDTCSettingRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.DTCSettingType}, m.ControlOptionRecord...), nil
+}
+
+func (m *ControlDTCSettingRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ControlDTCSetting, data)
+	m.DTCSettingType = r.byte()
+	m.ControlOptionRecord = r.rest()
+	return r.done()
+}
+
+// ControlDTCSettingResponse is 0xC5 [DTCSettingType].
+type ControlDTCSettingResponse struct {
+	DTCSettingType byte
+}
+
+func (m *ControlDTCSettingResponse) ServiceID() SID { return ControlDTCSetting + 0x40 }
+
+func (m *ControlDTCSettingResponse) MarshalPayload() ([]byte, error) {
+	return []byte{m.DTCSettingType}, nil
+}
+
+func (m *ControlDTCSettingResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(ControlDTCSetting, data)
+	m.DTCSettingType = r.byte()
+	return r.done()
+}
+
+// ResponseOnEventRequest is 0x86 [eventType][eventWindowTime][eventTypeRecord][serviceToRespondToRecord].
+// reportActivatedEvents (0x04) carries no eventWindowTime. The length of
+// EventTypeRecord depends on the event type, ServiceToRespondToRecord holds
+// whatever follows it.
+type ResponseOnEventRequest struct {
+	EventType                byte
+	EventWindowTime          byte
+	EventTypeRecord          []byte
+	ServiceToRespondToRecord []byte
+}
+
+func (m *ResponseOnEventRequest) ServiceID() SID { return ResponseOnEvent }
+
+// eventTypeRecordLength returns the eventTypeRecord length for an event type
+// and whether the event type carries a serviceToRespondToRecord.
+func eventTypeRecordLength(eventType byte) (int, bool) {
+	switch eventType & 0x3F {
+	case 0x01, 0x02: // onDTCStatusChange, onTimerInterrupt
+		return 1, true
+	case 0x03: // onChangeOfDataIdentifier
+		return 2, true
+	case 0x07: // onComparisonOfValues
+		return 10, true
+	default:
+		return 0, false
+	}
+}
+
+func (m *ResponseOnEventRequest) MarshalPayload() ([]byte, error) {
+	buf := []byte{m.EventType}
+	if m.EventType&0x3F != 0x04 {
+		buf = append(buf, m.EventWindowTime)
+	}
+	buf = append(buf, m.EventTypeRecord...)
+	return append(buf, m.ServiceToRespondToRecord...), nil
+}
+
+func (m *ResponseOnEventRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(ResponseOnEvent, data)
+	m.EventType = r.byte()
+	m.EventWindowTime = 0
+	if m.EventType&0x3F != 0x04 {
+		m.EventWindowTime = r.byte()
+	}
+	n, hasService := eventTypeRecordLength(m.EventType)
+	m.EventTypeRecord = r.bytes(n)
+	m.ServiceToRespondToRecord = nil
+	if hasService {
+		m.ServiceToRespondToRecord = r.rest()
+		if r.err == nil && len(m.ServiceToRespondToRecord) == 0 {
+			return errLength(ResponseOnEvent)
+		}
+	}
+	return r.done()
+}
+
+// ResponseOnEventResponse is 0xC6 [eventType][numberOfIdentifiedEvents | numberOfActivatedEvents][record].
+// Record holds the remaining event specific bytes.
+type ResponseOnEventResponse struct {
+	EventType      byte
+	NumberOfEvents byte
+	Record         []byte
+}
+
+func (m *ResponseOnEventResponse) ServiceID() SID { return ResponseOnEvent + 0x40 }
+
+func (m *ResponseOnEventResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.EventType, m.NumberOfEvents}, m.Record...), nil
+}
+
+func (m *ResponseOnEventResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(ResponseOnEvent, data)
+	m.EventType = r.byte()
+	m.NumberOfEvents = r.byte()
+	m.Record = r.rest()
+	return r.done()
+}
+
+// LinkControlRequest is 0x87 [linkControlType][linkControlModeIdentifier | linkRecord].
+// Verifying a fixed baudrate (0x01) carries a one byte mode identifier,
+// verifying a specific baudrate (0x02) a three byte record and transitioning
+// (0x03) nothing at all.
+type LinkControlRequest struct {
+	LinkControlType byte
+	Record          []byte
+}
+
+func (m *LinkControlRequest) ServiceID() SID { return LinkControl }
+
+func (m *LinkControlRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.LinkControlType}, m.Record...), nil
+}
+
+func (m *LinkControlRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(LinkControl, data)
+	m.LinkControlType = r.byte()
+	switch m.LinkControlType & 0x7F {
+	case 0x01:
+		m.Record = r.bytes(1)
+	case 0x02:
+		m.Record = r.bytes(3)
+	case 0x03:
+		m.Record = nil
+	default:
+		m.Record = r.rest()
+	}
+	return r.done()
+}
+
+// LinkControlResponse is 0xC7 [linkControlType].
+type LinkControlResponse struct {
+	LinkControlType byte
+}
+
+func (m *LinkControlResponse) ServiceID() SID { return LinkControl + 0x40 }
+
+func (m *LinkControlResponse) MarshalPayload() ([]byte, error) {
+	return []byte{m.LinkControlType}, nil
+}
+
+func (m *LinkControlResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(LinkControl, data)
+	m.LinkControlType = r.byte()
+	return r.done()
+}
@@ -0,0 +1,127 @@
+package uds
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NRC is a negative response code, the last byte of a 7F [sid] [nrc] message.
+type NRC byte
+
+// String returns the name of the response code as listed in ResponseCodes.
+func (c NRC) String() string {
+	if name, ok := ResponseCodes[c]; ok {
+		return name
+	}
+	switch {
+	case c >= 0x38 && c <= 0x4F:
+		return "Reserved by Extended Data Link Security Document"
+	case c >= 0xF0 && c <= 0xFE:
+		return "Vehicle manufacturer specific conditions not correct"
+	}
+	return fmt.Sprintf("Unknown response code 0x%02X", byte(c))
+}
+
+// NegativeResponse is a 7F [sid] [nrc] message. It implements error so a
+// handler can return it directly, a zero SID is filled in with the SID of the
+// request being answered.
+type NegativeResponse struct {
+	SID  SID
+	Code NRC
+}
+
+// NewNegativeResponse returns the negative response to sid with code.
+func NewNegativeResponse(sid SID, code NRC) NegativeResponse {
+	return NegativeResponse{SID: sid, Code: code}
+}
+
+func (n NegativeResponse) Error() string {
+	return fmt.Sprintf("uds: negative response to 0x%02X: %s (0x%02X)", byte(n.SID), n.Code, byte(n.Code))
+}
+
+// Is matches negative responses with the same code. A target without SID, like
+// the Err values of this package, matches responses to any service.
+func (n NegativeResponse) Is(target error) bool {
+	t, ok := target.(NegativeResponse)
+	if !ok {
+		return false
+	}
+	return n.Code == t.Code && (t.SID == 0 || n.SID == t.SID)
+}
+
+// Bytes returns the framed 7F [sid] [nrc] message.
+func (n NegativeResponse) Bytes() []byte {
+	return []byte{byte(NR), byte(n.SID), byte(n.Code)}
+}
+
+func (n NegativeResponse) ServiceID() SID { return NR }
+
+func (n NegativeResponse) MarshalPayload() ([]byte, error) {
+	return []byte{byte(n.SID), byte(n.Code)}, nil
+}
+
+func (n *NegativeResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(NR, data)
+	n.SID = SID(r.byte())
+	n.Code = NRC(r.byte())
+	return r.done()
+}
+
+// Negative responses without a SID, meant to be returned by handlers.
+var (
+	ErrGeneralReject                          = NegativeResponse{Code: GR}
+	ErrServiceNotSupported                    = NegativeResponse{Code: SNS}
+	ErrSubFunctionNotSupported                = NegativeResponse{Code: SFNS}
+	ErrIncorrectMessageLength                 = NegativeResponse{Code: IMLOIF}
+	ErrResponseTooLong                        = NegativeResponse{Code: RTL}
+	ErrBusyRepeatRequest                      = NegativeResponse{Code: BRR}
+	ErrConditionsNotCorrect                   = NegativeResponse{Code: CNC}
+	ErrRequestSequenceError                   = NegativeResponse{Code: RSE}
+	ErrNoResponseFromSubnetComponent          = NegativeResponse{Code: NRFSC}
+	ErrFailurePreventsExecution               = NegativeResponse{Code: FPEORA}
+	ErrRequestOutOfRange                      = NegativeResponse{Code: ROOR}
+	ErrSecurityAccessDenied                   = NegativeResponse{Code: SAD}
+	ErrInvalidKey                             = NegativeResponse{Code: IK}
+	ErrExceededNumberOfAttempts               = NegativeResponse{Code: ENOA}
+	ErrRequiredTimeDelayNotExpired            = NegativeResponse{Code: RTDNE}
+	ErrCertificateInvalidTimePeriod           = NegativeResponse{Code: CVFITP}
+	ErrCertificateInvalidSignature            = NegativeResponse{Code: CVFISIG}
+	ErrCertificateInvalidChainOfTrust         = NegativeResponse{Code: CVFICOT}
+	ErrCertificateInvalidType                 = NegativeResponse{Code: CVFIT}
+	ErrCertificateInvalidFormat               = NegativeResponse{Code: CVFIF}
+	ErrCertificateInvalidContent              = NegativeResponse{Code: CVFIC}
+	ErrCertificateInvalidScope                = NegativeResponse{Code: CVFISCP}
+	ErrCertificateRevoked                     = NegativeResponse{Code: CVFICE}
+	ErrOwnershipVerificationFailed            = NegativeResponse{Code: OVF}
+	ErrChallengeCalculationFailed             = NegativeResponse{Code: CCF}
+	ErrSettingAccessRightsFailed              = NegativeResponse{Code: SARF}
+	ErrSessionKeyCreationFailed               = NegativeResponse{Code: SKCDF}
+	ErrConfigurationDataUsageFailed           = NegativeResponse{Code: CDUF}
+	ErrDeAuthenticationFailed                 = NegativeResponse{Code: DAF}
+	ErrUploadDownloadNotAccepted              = NegativeResponse{Code: UDNA}
+	ErrTransferDataSuspended                  = NegativeResponse{Code: TDS}
+	ErrGeneralProgrammingFailure              = NegativeResponse{Code: GPF}
+	ErrWrongBlockSequenceCounter              = NegativeResponse{Code: WBSC}
+	ErrResponsePending                        = NegativeResponse{Code: RCRRP}
+	ErrSubFunctionNotSupportedInActiveSession = NegativeResponse{Code: SFNSIAS}
+	ErrServiceNotSupportedInActiveSession     = NegativeResponse{Code: SNSIAS}
+)
+
+// ToNegativeResponse converts an error returned while handling a request for
+// sid into the negative response sent back. NegativeResponse and DecodeError
+// keep their code, anything else becomes a general reject.
+func ToNegativeResponse(sid SID, err error) NegativeResponse {
+	var nr NegativeResponse
+	var de *DecodeError
+	switch {
+	case errors.As(err, &nr):
+	case errors.As(err, &de):
+		nr.Code = de.NRC
+	default:
+		nr.Code = GR
+	}
+	if nr.SID == 0 {
+		nr.SID = sid
+	}
+	return nr
+}
@@ -0,0 +1,101 @@
+package uds
+
+// Input/output control and remote activation of routine services.
+
+// InputOutputControlByIdentifierRequest is 0x2F [dataIdentifier][controlOptionRecord][controlEnableMaskRecord].
+// The first byte of ControlOptionRecord is the inputOutputControlParameter,
+// the split between control state and enable mask is only known to the server.
+type InputOutputControlByIdentifierRequest struct {
+	DataIdentifier      uint16
+	ControlOptionRecord []byte
+}
+
+func (m *InputOutputControlByIdentifierRequest) ServiceID() SID {
+	return InputOutputControlByIdentifier
+}
+
+func (m *InputOutputControlByIdentifierRequest) MarshalPayload() ([]byte, error) {
+	return append(putUint(nil, uint64(m.DataIdentifier), 2), m.ControlOptionRecord...), nil
+}
+
+func (m *InputOutputControlByIdentifierRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(InputOutputControlByIdentifier, data)
+	m.DataIdentifier = r.uint16()
+	m.ControlOptionRecord = r.rest()
+	if r.err == nil && len(m.ControlOptionRecord) == 0 {
+		return errLength(InputOutputControlByIdentifier)
+	}
+	return r.done()
+}
+
+// InputOutputControlByIdentifierResponse is 0x6F [dataIdentifier][controlStatusRecord].
+type InputOutputControlByIdentifierResponse struct {
+	DataIdentifier      uint16
+	ControlStatusRecord []byte
+}
+
+func (m *InputOutputControlByIdentifierResponse) ServiceID() SID {
+	return InputOutputControlByIdentifier + 0x40
+}
+
+func (m *InputOutputControlByIdentifierResponse) MarshalPayload() ([]byte, error) {
+	return append(putUint(nil, uint64(m.DataIdentifier), 2), m.ControlStatusRecord...), nil
+}
+
+func (m *InputOutputControlByIdentifierResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(InputOutputControlByIdentifier, data)
+	m.DataIdentifier = r.uint16()
+	m.ControlStatusRecord = r.rest()
+	return r.done()
+}
+
+// RoutineControlRequest is 0x31 [routineControlType][routineIdentifier][routineControlOptionRecord].
+type RoutineControlRequest struct {
+	RoutineControlType  byte
+	RoutineIdentifier   uint16
+	ControlOptionRecord []byte
+}
+
+func (m *RoutineControlRequest) ServiceID() SID { return RoutineControl }
+
+func (m *RoutineControlRequest) MarshalPayload() ([]byte, error) {
+	buf := putUint([]byte{m.RoutineControlType}, uint64(m.RoutineIdentifier), 2)
+	return append(buf, m.ControlOptionRecord...), nil
+}
+
+func (m *RoutineControlRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(RoutineControl, data)
+	m.RoutineControlType = r.byte()
+	m.RoutineIdentifier = r.uint16()
+	m.ControlOptionRecord = r.rest()
+	if err := r.done(); err != nil {
+		return err
+	}
+	if t := m.RoutineControlType & 0x7F; t < StartRoutine || t > RequestRoutineResults {
+		return errSubFunction(RoutineControl, m.RoutineControlType)
+	}
+	return nil
+}
+
+// RoutineControlResponse is 0x71 [routineControlType][routineIdentifier][routineStatusRecord].
+// StatusRecord includes the optional routineInfo byte.
+type RoutineControlResponse struct {
+	RoutineControlType byte
+	RoutineIdentifier  uint16
+	StatusRecord       []byte
+}
+
+func (m *RoutineControlResponse) ServiceID() SID { return RoutineControl + 0x40 }
+
+func (m *RoutineControlResponse) MarshalPayload() ([]byte, error) {
+	buf := putUint([]byte{m.RoutineControlType}, uint64(m.RoutineIdentifier), 2)
+	return append(buf, m.StatusRecord...), nil
+}
+
+func (m *RoutineControlResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(RoutineControl, data)
+	m.RoutineControlType = r.byte()
+	m.RoutineIdentifier = r.uint16()
+	m.StatusRecord = r.rest()
+	return r.done()
+}
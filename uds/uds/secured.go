@@ -0,0 +1,57 @@
+package uds
+
+// SecuredData is the securityDataRequestRecord of a SecuredDataTransmission
+// request, or the securityDataResponseRecord of its response:
+//
+//	[administrativeParameter 2][signatureEncryptionCalculation]
+//	[signatureLength 2][antiReplayCounter 2][internal message][signature]
+//
+// The internal message is a complete request or response, service identifier
+// first, or its ciphertext when SecuredMessageEncrypted is set.
+type SecuredData struct {
+	AdministrativeParameter        uint16
+	SignatureEncryptionCalculation byte
+	AntiReplayCounter              uint16
+	Message                        []byte
+	Signature                      []byte
+}
+
+// Header returns the fields preceding the internal message, leaving out the
+// signature length, which is what signatures cover besides the message.
+func (s *SecuredData) Header() []byte {
+	buf := putUint(nil, uint64(s.AdministrativeParameter), 2)
+	buf = append(buf, s.SignatureEncryptionCalculation)
+	return putUint(buf, uint64(s.AntiReplayCounter), 2)
+}
+
+// MarshalRecord encodes the record.
+func (s *SecuredData) MarshalRecord() ([]byte, error) {
+	if !fits(uint64(len(s.Signature)), 2) {
+		return nil, errOutOfRange(SecuredDataTransmission, "signature longer than 0xFFFF bytes")
+	}
+	buf := putUint(nil, uint64(s.AdministrativeParameter), 2)
+	buf = append(buf, s.SignatureEncryptionCalculation)
+	buf = putUint(buf, uint64(len(s.Signature)), 2)
+	buf = putUint(buf, uint64(s.AntiReplayCounter), 2)
+	buf = append(buf, s.Message...)
+	return append(buf, s.Signature...), nil
+}
+
+// UnmarshalRecord decodes a record, which must hold an internal message of at
+// least one byte.
+func (s *SecuredData) UnmarshalRecord(data []byte) error {
+	r := newReader(SecuredDataTransmission, data)
+	s.AdministrativeParameter = r.uint16()
+	s.SignatureEncryptionCalculation = r.byte()
+	length := int(r.uint16())
+	s.AntiReplayCounter = r.uint16()
+	if r.err != nil {
+		return r.err
+	}
+	if r.remaining() <= length {
+		return errLength(SecuredDataTransmission)
+	}
+	s.Message = r.bytes(r.remaining() - length)
+	s.Signature = r.rest()
+	return r.done()
+}
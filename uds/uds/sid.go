@@ -0,0 +1,77 @@
+package uds
+
+import "fmt"
+
+// SID is a service identifier, the first byte of every UDS message.
+type SID byte
+
+// String returns the name of the service as listed in Services. Positive
+// response identifiers are named after the service they answer.
+func (s SID) String() string {
+	if s == NegativeResponseSID {
+		return "NegativeResponse"
+	}
+	if info, ok := Services[s]; ok {
+		return info.Name
+	}
+	if IsPositiveResponse(s) {
+		return Services[s-0x40].Name + "PositiveResponse"
+	}
+	return fmt.Sprintf("Unknown service 0x%02X", byte(s))
+}
+
+// ServiceInfo describes a diagnostic service defined by ISO 14229-1.
+// HasSubFunction is set for services whose second byte is a sub-function,
+// which also carries the suppressPosRspMsgIndicationBit.
+type ServiceInfo struct {
+	SID            SID
+	Name           string
+	Mnemonic       string
+	HasSubFunction bool
+}
+
+// Services lists every diagnostic service of ISO 14229-1 by request SID.
+var Services = map[SID]ServiceInfo{
+	DiagnosticSessionControl:        {DiagnosticSessionControl, "DiagnosticSessionControl", "DSC", true},
+	ECUReset:                        {ECUReset, "ECUReset", "ER", true},
+	ClearDiagnosticInformation:      {ClearDiagnosticInformation, "ClearDiagnosticInformation", "CDTCI", false},
+	ReadDTCInformation:              {ReadDTCInformation, "ReadDTCInformation", "RDTCI", true},
+	ReadDataByIdentifier:            {ReadDataByIdentifier, "ReadDataByIdentifier", "RDBI", false},
+	ReadMemoryByAddress:             {ReadMemoryByAddress, "ReadMemoryByAddress", "RMBA", false},
+	ReadScalingDataByIdentifier:     {ReadScalingDataByIdentifier, "ReadScalingDataByIdentifier", "RSDBI", false},
+	SecurityAccess:                  {SecurityAccess, "SecurityAccess", "SA", true},
+	CommunicationControl:            {CommunicationControl, "CommunicationControl", "CC", true},
+	Authentication:                  {Authentication, "Authentication", "AUTH", true},
+	ReadDataByPeriodicIdentifier:    {ReadDataByPeriodicIdentifier, "ReadDataByPeriodicIdentifier", "RDBPI", false},
+	DynamicallyDefineDataIdentifier: {DynamicallyDefineDataIdentifier, "DynamicallyDefineDataIdentifier", "DDDI", true},
+	WriteDataByIdentifier:           {WriteDataByIdentifier, "WriteDataByIdentifier", "WDBI", false},
+	InputOutputControlByIdentifier:  {InputOutputControlByIdentifier, "InputOutputControlByIdentifier", "IOCBI", false},
+	RoutineControl:                  {RoutineControl, "RoutineControl", "RC", true},
+	RequestDownload:                 {RequestDownload, "RequestDownload", "RD", false},
+	RequestUpload:                   {RequestUpload, "RequestUpload", "RU", false},
+	TransferData:                    {TransferData, "TransferData", "TD", false},
+	RequestTransferExit:             {RequestTransferExit, "RequestTransferExit", "RTE", false},
+	RequestFileTransfer:             {RequestFileTransfer, "RequestFileTransfer", "RFT", false},
+	WriteMemoryByAddress:            {WriteMemoryByAddress, "WriteMemoryByAddress", "WMBA", false},
+	TesterPresent:                   {TesterPresent, "TesterPresent", "TP", true},
+	AccessTimingParameter:           {AccessTimingParameter, "AccessTimingParameter", "ATP", true},
+	SecuredDataTransmission:         {SecuredDataTransmission, "SecuredDataTransmission", "SDT", false},
+	ControlDTCSetting:               {ControlDTCSetting, "ControlDTCSetting", "CDTCS", true},
+	ResponseOnEvent:                 {ResponseOnEvent, "ResponseOnEvent", "ROE", true},
+	LinkControl:                     {LinkControl, "LinkControl", "LC", true},
+}
+
+// PositiveResponseSID returns the identifier of a positive response to sid.
+func PositiveResponseSID(sid SID) SID {
+	return sid + 0x40
+}
+
+// IsPositiveResponse reports whether sid is the positive response identifier
+// of a service listed in Services.
+func IsPositiveResponse(sid SID) bool {
+	if sid < 0x40 {
+		return false
+	}
+	_, ok := Services[sid-0x40]
+	return ok
+}
@@ -0,0 +1,182 @@
+package uds
+
+// Upload and download services.
+
+// RequestDownloadRequest is 0x34 [dataFormatIdentifier][addressAndLengthFormatIdentifier][memoryAddress][memorySize].
+// The high nibble of DataFormatIdentifier selects the compression method and
+// the low nibble the encryption method, 0x00 means neither is used.
+type RequestDownloadRequest struct {
+	DataFormatIdentifier             byte
+	AddressAndLengthFormatIdentifier byte
+	MemoryAddress                    uint64
+	MemorySize                       uint64
+}
+
+func (m *RequestDownloadRequest) ServiceID() SID { return RequestDownload }
+
+func (m *RequestDownloadRequest) MarshalPayload() ([]byte, error) {
+	return AddressAndLength{Format: m.AddressAndLengthFormatIdentifier, Address: m.MemoryAddress, Size: m.MemorySize}.Append([]byte{m.DataFormatIdentifier}, RequestDownload)
+}
+
+func (m *RequestDownloadRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(RequestDownload, data)
+	m.DataFormatIdentifier = r.byte()
+	a := r.addressAndLength()
+	m.AddressAndLengthFormatIdentifier, m.MemoryAddress, m.MemorySize = a.Format, a.Address, a.Size
+	return r.done()
+}
+
+// RequestDownloadResponse is 0x74 [lengthFormatIdentifier][maxNumberOfBlockLength].
+// The high nibble of LengthFormatIdentifier holds the length of
+// MaxNumberOfBlockLength, when it is zero Marshal uses the shortest encoding.
+type RequestDownloadResponse struct {
+	LengthFormatIdentifier byte
+	MaxNumberOfBlockLength uint64
+}
+
+func (m *RequestDownloadResponse) ServiceID() SID { return RequestDownload + 0x40 }
+
+func (m *RequestDownloadResponse) MarshalPayload() ([]byte, error) {
+	return marshalBlockLength(RequestDownload, m.LengthFormatIdentifier, m.MaxNumberOfBlockLength)
+}
+
+func (m *RequestDownloadResponse) UnmarshalPayload(data []byte) error {
+	var err error
+	m.LengthFormatIdentifier, m.MaxNumberOfBlockLength, err = unmarshalBlockLength(RequestDownload, data)
+	return err
+}
+
+// RequestUploadRequest is 0x35 and shares the layout of RequestDownloadRequest.
+type RequestUploadRequest struct {
+	DataFormatIdentifier             byte
+	AddressAndLengthFormatIdentifier byte
+	MemoryAddress                    uint64
+	MemorySize                       uint64
+}
+
+func (m *RequestUploadRequest) ServiceID() SID { return RequestUpload }
+
+func (m *RequestUploadRequest) MarshalPayload() ([]byte, error) {
+	return AddressAndLength{Format: m.AddressAndLengthFormatIdentifier, Address: m.MemoryAddress, Size: m.MemorySize}.Append([]byte{m.DataFormatIdentifier}, RequestUpload)
+}
+
+func (m *RequestUploadRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(RequestUpload, data)
+	m.DataFormatIdentifier = r.byte()
+	a := r.addressAndLength()
+	m.AddressAndLengthFormatIdentifier, m.MemoryAddress, m.MemorySize = a.Format, a.Address, a.Size
+	return r.done()
+}
+
+// RequestUploadResponse is 0x75 and shares the layout of RequestDownloadResponse.
+type RequestUploadResponse struct {
+	LengthFormatIdentifier byte
+	MaxNumberOfBlockLength uint64
+}
+
+func (m *RequestUploadResponse) ServiceID() SID { return RequestUpload + 0x40 }
+
+func (m *RequestUploadResponse) MarshalPayload() ([]byte, error) {
+	return marshalBlockLength(RequestUpload, m.LengthFormatIdentifier, m.MaxNumberOfBlockLength)
+}
+
+func (m *RequestUploadResponse) UnmarshalPayload(data []byte) error {
+	var err error
+	m.LengthFormatIdentifier, m.MaxNumberOfBlockLength, err = unmarshalBlockLength(RequestUpload, data)
+	return err
+}
+
+func marshalBlockLength(sid SID, format byte, maxBlockLength uint64) ([]byte, error) {
+	n := int(format >> 4)
+	if n == 0 {
+		n = minBytes(maxBlockLength)
+		format = byte(n << 4)
+	}
+	if n > 8 || !fits(maxBlockLength, n) {
+		return nil, errOutOfRange(sid, "maxNumberOfBlockLength does not fit lengthFormatIdentifier")
+	}
+	return putUint([]byte{format}, maxBlockLength, n), nil
+}
+
+func unmarshalBlockLength(sid SID, data []byte) (byte, uint64, error) {
+	r := newReader(sid, data)
+	format := r.byte()
+	n := int(format >> 4)
+	if r.err == nil && (n == 0 || n > 8) {
+		return 0, 0, errLength(sid)
+	}
+	maxBlockLength := r.uint(n)
+	return format, maxBlockLength, r.done()
+}
+
+// TransferDataRequest is 0x36 [blockSequenceCounter][transferRequestParameterRecord].
+type TransferDataRequest struct {
+	BlockSequenceCounter byte
+	ParameterRecord      []byte
+}
+
+func (m *TransferDataRequest) ServiceID() SID { return TransferData }
+
+func (m *TransferDataRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.BlockSequenceCounter}, m.ParameterRecord...), nil
+}
+
+func (m *TransferDataRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(TransferData, data)
+	m.BlockSequenceCounter = r.byte()
+	m.ParameterRecord = r.rest()
+	return r.done()
+}
+
+// TransferDataResponse is 0x76 [blockSequenceCounter][transferResponseParameterRecord].
+type TransferDataResponse struct {
+	BlockSequenceCounter byte
+	ParameterRecord      []byte
+}
+
+func (m *TransferDataResponse) ServiceID() SID { return TransferData + 0x40 }
+
+func (m *TransferDataResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte{m.BlockSequenceCounter}, m.ParameterRecord...), nil
+}
+
+func (m *TransferDataResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(TransferData, data)
+	m.BlockSequenceCounter = r.byte()
+	m.ParameterRecord = r.rest()
+	return r.done()
+}
+
+// RequestTransferExitRequest is 0x37 [transferRequestParameterRecord].
+type RequestTransferExitRequest struct {
+	ParameterRecord []byte
+}
+
+func (m *RequestTransferExitRequest) ServiceID() SID { return RequestTransferExit }
+
+func (m *RequestTransferExitRequest) MarshalPayload() ([]byte, error) {
+	return append([]byte(nil), m.ParameterRecord...), nil
+}
+
+func (m *RequestTransferExitRequest) UnmarshalPayload(data []byte) error {
+	r := newReader(RequestTransferExit, data)
+	m.ParameterRecord = r.rest()
+	return r.done()
+}
+
+// RequestTransferExitResponse is 0x77 [transferResponseParameterRecord].
+type RequestTransferExitResponse struct {
+	ParameterRecord []byte
+}
+
+func (m *RequestTransferExitResponse) ServiceID() SID { return RequestTransferExit + 0x40 }
+
+func (m *RequestTransferExitResponse) MarshalPayload() ([]byte, error) {
+	return append([]byte(nil), m.ParameterRecord...), nil
+}
+
+func (m *RequestTransferExitResponse) UnmarshalPayload(data []byte) error {
+	r := newReader(RequestTransferExit, data)
+	m.ParameterRecord = r.rest()
+	return r.done()
+}
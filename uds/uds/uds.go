@@ -1,118 +1,192 @@
 package uds
 
 type Request struct {
-	SID  byte
+	SID  SID
 	Data []byte
 }
 
 type Response struct {
-	SID  byte
+	SID  SID
 	Data []byte
 }
 
+// UDS Services: name and mnemonic
 const (
-	// UDS Services: name and mnemonic
-	DiagnosticSessionControl = 0x10
-	DSC
-	ECUReset = 0x11
-	ER
-	SecurityAccess = 0x27
-	SA
-	CommunicationControl = 0x28
-	CC
-	TesterPresent = 0x3E
-	TP
-	AccessTimingParameter = 0x83
-	ATP
-	SecuredDataTransmission = 0x84
-	SDT
-	ControlDTCSetting = 0x85
-	CDTCS
-	ResponseOnEvent = 0x86
-	ROE
-	LinkControl = 0x87
-	LC
-	ReadDataByIdentifier = 0x22
-	RDBI
-	ReadMemoryByAddress = 0x23
-	RMBA
-	ReadScalingDataByIdentifier = 0x24
-	RSDBI
-	ReadDataByPeriodicIdentifier = 0x2A
-	RDBPI
-	DynamicallyDefineDataIdentifier = 0x2C
-	DDDI
-	WriteDataByIdentifier = 0x2E
-	WDBI
-	WriteMemoryByAddress = 0x3D
-	WMBA
-	ClearDiagnosticInformation = 0x14
-	CDTCI
-	ReadDTCInformation = 0x19
-	RDTCI
-	InputOutputControlByIdentifier = 0x2F
-	IOCBI
-	RoutineControl = 0x31
-	RC
-	RequestDownload = 0x34
-	RD
-	RequestUpload = 0x35
-	RU
-	TransferData = 0x36
-	TD
-	RequestTransferExit = 0x37
-	RTE
+	DiagnosticSessionControl        SID = 0x10
+	ECUReset                        SID = 0x11
+	ClearDiagnosticInformation      SID = 0x14
+	ReadDTCInformation              SID = 0x19
+	ReadDataByIdentifier            SID = 0x22
+	ReadMemoryByAddress             SID = 0x23
+	ReadScalingDataByIdentifier     SID = 0x24
+	SecurityAccess                  SID = 0x27
+	CommunicationControl            SID = 0x28
+	Authentication                  SID = 0x29
+	ReadDataByPeriodicIdentifier    SID = 0x2A
+	DynamicallyDefineDataIdentifier SID = 0x2C
+	WriteDataByIdentifier           SID = 0x2E
+	InputOutputControlByIdentifier  SID = 0x2F
+	RoutineControl                  SID = 0x31
+	RequestDownload                 SID = 0x34
+	RequestUpload                   SID = 0x35
+	TransferData                    SID = 0x36
+	RequestTransferExit             SID = 0x37
+	RequestFileTransfer             SID = 0x38
+	WriteMemoryByAddress            SID = 0x3D
+	TesterPresent                   SID = 0x3E
+	AccessTimingParameter           SID = 0x83
+	SecuredDataTransmission         SID = 0x84
+	ControlDTCSetting               SID = 0x85
+	ResponseOnEvent                 SID = 0x86
+	LinkControl                     SID = 0x87
+
+	DSC   = DiagnosticSessionControl
+	ER    = ECUReset
+	CDTCI = ClearDiagnosticInformation
+	RDTCI = ReadDTCInformation
+	RDBI  = ReadDataByIdentifier
+	RMBA  = ReadMemoryByAddress
+	RSDBI = ReadScalingDataByIdentifier
+	SA    = SecurityAccess
+	CC    = CommunicationControl
+	AUTH  = Authentication
+	RDBPI = ReadDataByPeriodicIdentifier
+	DDDI  = DynamicallyDefineDataIdentifier
+	WDBI  = WriteDataByIdentifier
+	IOCBI = InputOutputControlByIdentifier
+	RC    = RoutineControl
+	RD    = RequestDownload
+	RU    = RequestUpload
+	TD    = TransferData
+	RTE   = RequestTransferExit
+	RFT   = RequestFileTransfer
+	WMBA  = WriteMemoryByAddress
+	TP    = TesterPresent
+	ATP   = AccessTimingParameter
+	SDT   = SecuredDataTransmission
+	CDTCS = ControlDTCSetting
+	ROE   = ResponseOnEvent
+	LC    = LinkControl
+)
+
+// NegativeResponseSID is the service identifier of a negative response message.
+const (
+	NegativeResponseSID SID = 0x7F
+	NR                      = NegativeResponseSID
 )
 
 // subfunction constants
 const (
-	HardReset = 0x01
-	HR
-	DefineByIdentifier
-	KeyOffOnReset = 0x02
-	KOFFONR
-	DefineByMemoryAddress
-	SoftReset = 0x03
-	SR
-	EnableRapidPowerShutDown = 0x04
-	ERPSD
+	// DiagnosticSessionControl diagnosticSessionType
+	DefaultSession                = 0x01
+	ProgrammingSession            = 0x02
+	ExtendedDiagnosticSession     = 0x03
+	SafetySystemDiagnosticSession = 0x04
+
+	DS    = DefaultSession
+	PRGS  = ProgrammingSession
+	EXTDS = ExtendedDiagnosticSession
+	SSDS  = SafetySystemDiagnosticSession
+
+	// ECUReset resetType
+	HardReset                 = 0x01
+	KeyOffOnReset             = 0x02
+	SoftReset                 = 0x03
+	EnableRapidPowerShutDown  = 0x04
 	DisableRapidPowerShutDown = 0x05
-	DRPSD
+
+	HR      = HardReset
+	KOFFONR = KeyOffOnReset
+	SR      = SoftReset
+	ERPSD   = EnableRapidPowerShutDown
+	DRPSD   = DisableRapidPowerShutDown
+
+	// DynamicallyDefineDataIdentifier definitionType
+	DefineByIdentifier                    = 0x01
+	DefineByMemoryAddress                 = 0x02
+	ClearDynamicallyDefinedDataIdentifier = 0x03
+
+	// RoutineControl routineControlType
+	StartRoutine          = 0x01
+	StopRoutine           = 0x02
+	RequestRoutineResults = 0x03
+
+	// Authentication authenticationTask
+	DeAuthenticate                       = 0x00
+	VerifyCertificateUnidirectional      = 0x01
+	VerifyCertificateBidirectional       = 0x02
+	ProofOfOwnership                     = 0x03
+	TransmitCertificate                  = 0x04
+	RequestChallengeForAuthentication    = 0x05
+	VerifyProofOfOwnershipUnidirectional = 0x06
+	VerifyProofOfOwnershipBidirectional  = 0x07
+	AuthenticationConfiguration          = 0x08
+
+	// Authentication authenticationReturnParameter
+	AuthRequestAccepted                               = 0x00
+	AuthGeneralReject                                 = 0x01
+	AuthenticationConfigurationAPCE                   = 0x02
+	AuthenticationConfigurationACRAsymmetric          = 0x03
+	AuthenticationConfigurationACRSymmetric           = 0x04
+	DeAuthenticationSuccessful                        = 0x10
+	CertificateVerifiedOwnershipVerificationNecessary = 0x11
+	OwnershipVerifiedAuthenticationComplete           = 0x12
+	CertificateVerified                               = 0x13
+
+	// SecuredDataTransmission administrative parameter bits
+	SecuredRequestMessage             = 0x0001
+	SecuredPreEstablishedKey          = 0x0004
+	SecuredMessageEncrypted           = 0x0008
+	SecuredMessageSigned              = 0x0010
+	SecuredResponseSignatureRequested = 0x0020
 )
 
 // Response Code constants
 const (
-	GR      = 0x10
-	SNS     = 0x11
-	SFNS    = 0x12
-	IMLOIF  = 0x13
-	RTL     = 0x14
-	BRR     = 0x21
-	CNC     = 0x22
-	RSE     = 0x24
-	NRFSC   = 0x25
-	FPEORA  = 0x26
-	ROOR    = 0x31
-	SAD     = 0x33
-	IK      = 0x35
-	ENOA    = 0x36
-	RTDNE   = 0x37
-	UDNA    = 0x70
-	TDS     = 0x71
-	GPF     = 0x72
-	WBSC    = 0x73
-	RCRRP   = 0x78
-	SFNSIAS = 0x7E
-	SNSIAS  = 0x7F
-	NR
+	GR      NRC = 0x10
+	SNS     NRC = 0x11
+	SFNS    NRC = 0x12
+	IMLOIF  NRC = 0x13
+	RTL     NRC = 0x14
+	BRR     NRC = 0x21
+	CNC     NRC = 0x22
+	RSE     NRC = 0x24
+	NRFSC   NRC = 0x25
+	FPEORA  NRC = 0x26
+	ROOR    NRC = 0x31
+	SAD     NRC = 0x33
+	IK      NRC = 0x35
+	ENOA    NRC = 0x36
+	RTDNE   NRC = 0x37
+	CVFITP  NRC = 0x50
+	CVFISIG NRC = 0x51
+	CVFICOT NRC = 0x52
+	CVFIT   NRC = 0x53
+	CVFIF   NRC = 0x54
+	CVFIC   NRC = 0x55
+	CVFISCP NRC = 0x56
+	CVFICE  NRC = 0x57
+	OVF     NRC = 0x58
+	CCF     NRC = 0x59
+	SARF    NRC = 0x5A
+	SKCDF   NRC = 0x5B
+	CDUF    NRC = 0x5C
+	DAF     NRC = 0x5D
+	UDNA    NRC = 0x70
+	TDS     NRC = 0x71
+	GPF     NRC = 0x72
+	WBSC    NRC = 0x73
+	RCRRP   NRC = 0x78
+	SFNSIAS NRC = 0x7E
+	SNSIAS  NRC = 0x7F
 )
 
 //Response Codes
-var ResponseCodes = map[int]string{
+var ResponseCodes = map[NRC]string{
 	0x10: "General reject",
 	0x11: "Service not supported",
-	0x12: "Sub-Function not support",
-	0x13: "InCorrect message length or invalid format",
+	0x12: "Sub-Function not supported",
+	0x13: "Incorrect message length or invalid format",
 	0x14: "Response too long",
 	0x21: "Busy repeat request",
 	0x22: "Conditions not correct",
@@ -125,6 +199,20 @@ var ResponseCodes = map[int]string{
 	0x36: "Exceeded number of attempts",
 	0x37: "Required time delay not expired",
 	0x38: "Reserved by Extended Data Link Security Document",
+	0x50: "Certificate verification failed - Invalid Time Period",
+	0x51: "Certificate verification failed - Invalid Signature",
+	0x52: "Certificate verification failed - Invalid Chain of Trust",
+	0x53: "Certificate verification failed - Invalid Type",
+	0x54: "Certificate verification failed - Invalid Format",
+	0x55: "Certificate verification failed - Invalid Content",
+	0x56: "Certificate verification failed - Invalid Scope",
+	0x57: "Certificate verification failed - Invalid Certificate (revoked)",
+	0x58: "Ownership verification failed",
+	0x59: "Challenge calculation failed",
+	0x5A: "Setting Access Rights failed",
+	0x5B: "Session key creation/derivation failed",
+	0x5C: "Configuration data usage failed",
+	0x5D: "DeAuthentication failed",
 	0x70: "Upload/Download not accepted",
 	0x71: "Transfer data suspended",
 	0x72: "General programming failure",
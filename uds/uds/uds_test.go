@@ -0,0 +1,595 @@
+package uds
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// nrcOf returns the code of the negative response a server sends for err.
+func nrcOf(err error) NRC {
+	if err == nil {
+		return 0
+	}
+	return ToNegativeResponse(0, err).Code
+}
+
+// newMessage returns an empty message of the type of m.
+func newMessage(m Message) Message {
+	return reflect.New(reflect.TypeOf(m).Elem()).Interface().(Message)
+}
+
+func TestServiceIdentifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		sid      SID
+		mnemonic SID
+		want     byte
+	}{
+		{"DiagnosticSessionControl", DiagnosticSessionControl, DSC, 0x10},
+		{"ECUReset", ECUReset, ER, 0x11},
+		{"ClearDiagnosticInformation", ClearDiagnosticInformation, CDTCI, 0x14},
+		{"ReadDTCInformation", ReadDTCInformation, RDTCI, 0x19},
+		{"ReadDataByIdentifier", ReadDataByIdentifier, RDBI, 0x22},
+		{"ReadMemoryByAddress", ReadMemoryByAddress, RMBA, 0x23},
+		{"ReadScalingDataByIdentifier", ReadScalingDataByIdentifier, RSDBI, 0x24},
+		{"SecurityAccess", SecurityAccess, SA, 0x27},
+		{"CommunicationControl", CommunicationControl, CC, 0x28},
+		{"Authentication", Authentication, AUTH, 0x29},
+		{"ReadDataByPeriodicIdentifier", ReadDataByPeriodicIdentifier, RDBPI, 0x2A},
+		{"DynamicallyDefineDataIdentifier", DynamicallyDefineDataIdentifier, DDDI, 0x2C},
+		{"WriteDataByIdentifier", WriteDataByIdentifier, WDBI, 0x2E},
+		{"InputOutputControlByIdentifier", InputOutputControlByIdentifier, IOCBI, 0x2F},
+		{"RoutineControl", RoutineControl, RC, 0x31},
+		{"RequestDownload", RequestDownload, RD, 0x34},
+		{"RequestUpload", RequestUpload, RU, 0x35},
+		{"TransferData", TransferData, TD, 0x36},
+		{"RequestTransferExit", RequestTransferExit, RTE, 0x37},
+		{"RequestFileTransfer", RequestFileTransfer, RFT, 0x38},
+		{"WriteMemoryByAddress", WriteMemoryByAddress, WMBA, 0x3D},
+		{"TesterPresent", TesterPresent, TP, 0x3E},
+		{"AccessTimingParameter", AccessTimingParameter, ATP, 0x83},
+		{"SecuredDataTransmission", SecuredDataTransmission, SDT, 0x84},
+		{"ControlDTCSetting", ControlDTCSetting, CDTCS, 0x85},
+		{"ResponseOnEvent", ResponseOnEvent, ROE, 0x86},
+		{"LinkControl", LinkControl, LC, 0x87},
+	}
+	if len(tests) != len(Services) {
+		t.Errorf("Services has %d entries, want %d", len(Services), len(tests))
+	}
+	for _, tt := range tests {
+		if byte(tt.sid) != tt.want {
+			t.Errorf("%s = 0x%02X, want 0x%02X", tt.name, byte(tt.sid), tt.want)
+		}
+		if tt.mnemonic != tt.sid {
+			t.Errorf("mnemonic of %s = 0x%02X, want 0x%02X", tt.name, byte(tt.mnemonic), tt.want)
+		}
+		info, ok := Services[tt.sid]
+		if !ok {
+			t.Errorf("%s missing from Services", tt.name)
+			continue
+		}
+		if info.SID != tt.sid || info.Name != tt.name {
+			t.Errorf("Services[0x%02X] = {0x%02X %s}, want {0x%02X %s}", tt.want, byte(info.SID), info.Name, tt.want, tt.name)
+		}
+		if tt.sid.String() != tt.name {
+			t.Errorf("SID(0x%02X).String() = %q, want %q", tt.want, tt.sid.String(), tt.name)
+		}
+		if got := PositiveResponseSID(tt.sid); byte(got) != tt.want+0x40 || !IsPositiveResponse(got) {
+			t.Errorf("PositiveResponseSID(%s) = 0x%02X, want 0x%02X", tt.name, byte(got), tt.want+0x40)
+		}
+		if IsPositiveResponse(tt.sid) {
+			t.Errorf("IsPositiveResponse(%s) = true, want false", tt.name)
+		}
+	}
+	if NR != 0x7F || NegativeResponseSID != 0x7F {
+		t.Errorf("NR = 0x%02X, want 0x7F", byte(NR))
+	}
+	if IsPositiveResponse(NR) {
+		t.Error("IsPositiveResponse(NR) = true, want false")
+	}
+}
+
+func TestSubFunctions(t *testing.T) {
+	tests := []struct {
+		name  string
+		value byte
+		want  byte
+	}{
+		{"DefaultSession", DefaultSession, 0x01},
+		{"DS", DS, 0x01},
+		{"ProgrammingSession", ProgrammingSession, 0x02},
+		{"PRGS", PRGS, 0x02},
+		{"ExtendedDiagnosticSession", ExtendedDiagnosticSession, 0x03},
+		{"EXTDS", EXTDS, 0x03},
+		{"SafetySystemDiagnosticSession", SafetySystemDiagnosticSession, 0x04},
+		{"SSDS", SSDS, 0x04},
+		{"HardReset", HardReset, 0x01},
+		{"HR", HR, 0x01},
+		{"KeyOffOnReset", KeyOffOnReset, 0x02},
+		{"KOFFONR", KOFFONR, 0x02},
+		{"SoftReset", SoftReset, 0x03},
+		{"SR", SR, 0x03},
+		{"EnableRapidPowerShutDown", EnableRapidPowerShutDown, 0x04},
+		{"ERPSD", ERPSD, 0x04},
+		{"DisableRapidPowerShutDown", DisableRapidPowerShutDown, 0x05},
+		{"DRPSD", DRPSD, 0x05},
+		{"DefineByIdentifier", DefineByIdentifier, 0x01},
+		{"DefineByMemoryAddress", DefineByMemoryAddress, 0x02},
+		{"ClearDynamicallyDefinedDataIdentifier", ClearDynamicallyDefinedDataIdentifier, 0x03},
+		{"StartRoutine", StartRoutine, 0x01},
+		{"StopRoutine", StopRoutine, 0x02},
+		{"RequestRoutineResults", RequestRoutineResults, 0x03},
+		{"DeAuthenticate", DeAuthenticate, 0x00},
+		{"VerifyCertificateUnidirectional", VerifyCertificateUnidirectional, 0x01},
+		{"VerifyCertificateBidirectional", VerifyCertificateBidirectional, 0x02},
+		{"ProofOfOwnership", ProofOfOwnership, 0x03},
+		{"TransmitCertificate", TransmitCertificate, 0x04},
+		{"RequestChallengeForAuthentication", RequestChallengeForAuthentication, 0x05},
+		{"VerifyProofOfOwnershipUnidirectional", VerifyProofOfOwnershipUnidirectional, 0x06},
+		{"VerifyProofOfOwnershipBidirectional", VerifyProofOfOwnershipBidirectional, 0x07},
+		{"AuthenticationConfiguration", AuthenticationConfiguration, 0x08},
+		{"SecuredRequestMessage", SecuredRequestMessage, 0x01},
+		{"SecuredPreEstablishedKey", SecuredPreEstablishedKey, 0x04},
+		{"SecuredMessageEncrypted", SecuredMessageEncrypted, 0x08},
+		{"SecuredMessageSigned", SecuredMessageSigned, 0x10},
+		{"SecuredResponseSignatureRequested", SecuredResponseSignatureRequested, 0x20},
+	}
+	for _, tt := range tests {
+		if tt.value != tt.want {
+			t.Errorf("%s = 0x%02X, want 0x%02X", tt.name, tt.value, tt.want)
+		}
+	}
+}
+
+func TestResponseCodes(t *testing.T) {
+	tests := []struct {
+		code NRC
+		want byte
+	}{
+		{GR, 0x10}, {SNS, 0x11}, {SFNS, 0x12}, {IMLOIF, 0x13}, {RTL, 0x14},
+		{BRR, 0x21}, {CNC, 0x22}, {RSE, 0x24}, {NRFSC, 0x25}, {FPEORA, 0x26},
+		{ROOR, 0x31}, {SAD, 0x33}, {IK, 0x35}, {ENOA, 0x36}, {RTDNE, 0x37},
+		{CVFITP, 0x50}, {CVFISIG, 0x51}, {CVFICOT, 0x52}, {CVFIT, 0x53}, {CVFIF, 0x54},
+		{CVFIC, 0x55}, {CVFISCP, 0x56}, {CVFICE, 0x57}, {OVF, 0x58}, {CCF, 0x59},
+		{SARF, 0x5A}, {SKCDF, 0x5B}, {CDUF, 0x5C}, {DAF, 0x5D},
+		{UDNA, 0x70}, {TDS, 0x71}, {GPF, 0x72}, {WBSC, 0x73}, {RCRRP, 0x78},
+		{SFNSIAS, 0x7E}, {SNSIAS, 0x7F},
+	}
+	for _, tt := range tests {
+		if byte(tt.code) != tt.want {
+			t.Errorf("%s = 0x%02X, want 0x%02X", tt.code, byte(tt.code), tt.want)
+		}
+		if _, ok := ResponseCodes[tt.code]; !ok {
+			t.Errorf("0x%02X missing from ResponseCodes", tt.want)
+		}
+	}
+}
+
+func TestAddressAndLength(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want AddressAndLength
+		nrc  NRC
+	}{
+		{"one byte", []byte{0x11, 0x50, 0x10}, AddressAndLength{0x11, 0x50, 0x10}, 0},
+		{"mixed lengths", []byte{0x24, 0x00, 0x00, 0x80, 0x00, 0x01, 0x00}, AddressAndLength{0x24, 0x8000, 0x100}, 0},
+		{"last address", []byte{0x11, 0xFF, 0x01}, AddressAndLength{0x11, 0xFF, 0x01}, 0},
+		{"empty", nil, AddressAndLength{}, IMLOIF},
+		{"zero address length", []byte{0x10, 0x50}, AddressAndLength{}, ROOR},
+		{"zero size length", []byte{0x01, 0x50}, AddressAndLength{}, ROOR},
+		{"address length above 8", []byte{0x19, 0x50}, AddressAndLength{}, ROOR},
+		{"short address", []byte{0x14, 0x00, 0x50}, AddressAndLength{}, IMLOIF},
+		{"short size", []byte{0x21, 0x50, 0x10}, AddressAndLength{}, IMLOIF},
+		{"trailing bytes", []byte{0x11, 0x50, 0x10, 0x00}, AddressAndLength{}, IMLOIF},
+		{"past last address", []byte{0x11, 0xF0, 0x20}, AddressAndLength{}, ROOR},
+		{"overflow", []byte{0x18, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF0, 0x20}, AddressAndLength{}, ROOR},
+	}
+	for _, tt := range tests {
+		got, err := ParseAddressAndLength(ReadMemoryByAddress, tt.data)
+		if tt.nrc != 0 {
+			if nr := ToNegativeResponse(ReadMemoryByAddress, err); err == nil || nr.Code != tt.nrc {
+				t.Errorf("%s: error %v, want %s", tt.name, err, tt.nrc)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %+v, %v, want %+v", tt.name, got, err, tt.want)
+			continue
+		}
+		b, err := got.Append(nil, ReadMemoryByAddress)
+		if err != nil || string(b) != string(tt.data) {
+			t.Errorf("%s: Append = % X, %v", tt.name, b, err)
+		}
+	}
+
+	if a := NewAddressAndLength(0x8000, 0x10); a.Format != 0x12 {
+		t.Errorf("NewAddressAndLength format = 0x%02X, want 0x12", a.Format)
+	}
+	rest := []byte{0xAA, 0xBB}
+	if _, got, err := DecodeAddressAndLength(WriteMemoryByAddress, append([]byte{0x11, 0x50, 0x02}, rest...)); err != nil || string(got) != string(rest) {
+		t.Errorf("DecodeAddressAndLength rest = % X, %v", got, err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Message
+		// msg is the complete message, service identifier first
+		msg string
+	}{
+		{"DiagnosticSessionControl", &DiagnosticSessionControlRequest{SessionType: ExtendedDiagnosticSession}, "10 03"},
+		{"DiagnosticSessionControl suppressed", &DiagnosticSessionControlRequest{SessionType: 0x82}, "10 82"},
+		{"DiagnosticSessionControl response", &DiagnosticSessionControlResponse{SessionType: ExtendedDiagnosticSession, P2ServerMax: 50, P2StarServerMax: 500}, "50 03 0032 01f4"},
+		{"ECUReset", &ECUResetRequest{ResetType: HardReset}, "11 01"},
+		{"ECUReset response", &ECUResetResponse{ResetType: HardReset}, "51 01"},
+		{"ECUReset response powerDownTime", &ECUResetResponse{ResetType: EnableRapidPowerShutDown, PowerDownTime: 0x0A}, "51 04 0a"},
+		{"SecurityAccess requestSeed", &SecurityAccessRequest{SecurityAccessType: 0x01, Data: []byte{}}, "27 01"},
+		{"SecurityAccess requestSeed record", &SecurityAccessRequest{SecurityAccessType: 0x03, Data: []byte{0xAA}}, "27 03 aa"},
+		{"SecurityAccess sendKey", &SecurityAccessRequest{SecurityAccessType: 0x02, Data: []byte{0x01, 0x02, 0x03, 0x04}}, "27 02 01020304"},
+		{"SecurityAccess response", &SecurityAccessResponse{SecurityAccessType: 0x01, SecuritySeed: []byte{0x41, 0x41}}, "67 01 4141"},
+		{"CommunicationControl", &CommunicationControlRequest{ControlType: 0x03, CommunicationType: 0x01}, "28 03 01"},
+		{"CommunicationControl enhanced address", &CommunicationControlRequest{ControlType: 0x04, CommunicationType: 0x01, NodeIdentificationNumber: 0x0A0B}, "28 04 01 0a0b"},
+		{"CommunicationControl response", &CommunicationControlResponse{ControlType: 0x03}, "68 03"},
+		{"Authentication deAuthenticate", &AuthenticationRequest{AuthenticationTask: DeAuthenticate}, "29 00"},
+		{"Authentication verifyCertificateUnidirectional", &AuthenticationRequest{AuthenticationTask: VerifyCertificateUnidirectional, Certificate: []byte{0xAA, 0xBB}, Challenge: []byte{}}, "29 01 00 0002 aabb 0000"},
+		{"Authentication verifyCertificateBidirectional", &AuthenticationRequest{AuthenticationTask: VerifyCertificateBidirectional, CommunicationConfiguration: 0x01, Certificate: []byte{0xAA}, Challenge: []byte{0xC1, 0xC2}}, "29 02 01 0001 aa 0002 c1c2"},
+		{"Authentication proofOfOwnership", &AuthenticationRequest{AuthenticationTask: ProofOfOwnership, ProofOfOwnership: []byte{0x01, 0x02}, EphemeralPublicKey: []byte{}}, "29 03 0002 0102 0000"},
+		{"Authentication transmitCertificate", &AuthenticationRequest{AuthenticationTask: TransmitCertificate, Record: []byte{0x00, 0x01, 0xAA}}, "29 04 0001aa"},
+		{"Authentication response deAuthenticate", &AuthenticationResponse{AuthenticationTask: DeAuthenticate, ReturnParameter: DeAuthenticationSuccessful}, "69 00 10"},
+		{"Authentication response verifyCertificateUnidirectional", &AuthenticationResponse{AuthenticationTask: VerifyCertificateUnidirectional, ReturnParameter: CertificateVerifiedOwnershipVerificationNecessary, Challenge: []byte{0xC1}, EphemeralPublicKey: []byte{}}, "69 01 11 0001 c1 0000"},
+		{"Authentication response verifyCertificateBidirectional", &AuthenticationResponse{AuthenticationTask: VerifyCertificateBidirectional, ReturnParameter: CertificateVerifiedOwnershipVerificationNecessary, Challenge: []byte{0xC1}, Certificate: []byte{0xAA}, ProofOfOwnership: []byte{0x01}, EphemeralPublicKey: []byte{}}, "69 02 11 0001 c1 0001 aa 0001 01 0000"},
+		{"Authentication response proofOfOwnership", &AuthenticationResponse{AuthenticationTask: ProofOfOwnership, ReturnParameter: OwnershipVerifiedAuthenticationComplete, SessionKeyInfo: []byte{}}, "69 03 12 0000"},
+		{"Authentication response authenticationConfiguration", &AuthenticationResponse{AuthenticationTask: AuthenticationConfiguration, ReturnParameter: AuthenticationConfigurationAPCE}, "69 08 02"},
+		{"Authentication response requestChallengeForAuthentication", &AuthenticationResponse{AuthenticationTask: RequestChallengeForAuthentication, ReturnParameter: 0x00, Record: []byte{0x01}}, "69 05 00 01"},
+		{"TesterPresent", &TesterPresentRequest{}, "3e 00"},
+		{"TesterPresent suppressed", &TesterPresentRequest{ZeroSubFunction: 0x80}, "3e 80"},
+		{"TesterPresent response", &TesterPresentResponse{}, "7e 00"},
+		{"AccessTimingParameter", &AccessTimingParameterRequest{AccessType: 0x01, RequestRecord: []byte{}}, "83 01"},
+		{"AccessTimingParameter record", &AccessTimingParameterRequest{AccessType: 0x04, RequestRecord: []byte{0x00, 0x32}}, "83 04 0032"},
+		{"AccessTimingParameter response", &AccessTimingParameterResponse{AccessType: 0x01, ResponseRecord: []byte{0x00, 0x32}}, "c3 01 0032"},
+		{"SecuredDataTransmission", &SecuredDataTransmissionRequest{SecurityDataRequestRecord: []byte{0x00, 0x11}}, "84 0011"},
+		{"SecuredDataTransmission response", &SecuredDataTransmissionResponse{SecurityDataResponseRecord: []byte{0x00, 0x10}}, "c4 0010"},
+		{"ControlDTCSetting", &ControlDTCSettingRequest{DTCSettingType: 0x02, ControlOptionRecord: []byte{}}, "85 02"},
+		{"ControlDTCSetting record", &ControlDTCSettingRequest{DTCSettingType: 0x01, ControlOptionRecord: []byte{0xFF, 0xFF, 0xFF}}, "85 01 ffffff"},
+		{"ControlDTCSetting response", &ControlDTCSettingResponse{DTCSettingType: 0x02}, "c5 02"},
+		{"ResponseOnEvent stopResponseOnEvent", &ResponseOnEventRequest{EventType: 0x00, EventWindowTime: 0x02, EventTypeRecord: []byte{}}, "86 00 02"},
+		{"ResponseOnEvent onDTCStatusChange", &ResponseOnEventRequest{EventType: 0x01, EventWindowTime: 0x02, EventTypeRecord: []byte{0x08}, ServiceToRespondToRecord: []byte{0x19, 0x02, 0x08}}, "86 01 02 08 190208"},
+		{"ResponseOnEvent onTimerInterrupt", &ResponseOnEventRequest{EventType: 0x02, EventWindowTime: 0x02, EventTypeRecord: []byte{0x03}, ServiceToRespondToRecord: []byte{0x3E, 0x00}}, "86 02 02 03 3e00"},
+		{"ResponseOnEvent onChangeOfDataIdentifier", &ResponseOnEventRequest{EventType: 0x03, EventWindowTime: 0x02, EventTypeRecord: []byte{0x01, 0x00}, ServiceToRespondToRecord: []byte{0x22, 0x01, 0x00}}, "86 03 02 0100 220100"},
+		{"ResponseOnEvent storeEvent", &ResponseOnEventRequest{EventType: 0x43, EventWindowTime: 0x02, EventTypeRecord: []byte{0x01, 0x00}, ServiceToRespondToRecord: []byte{0x22, 0x01, 0x00}}, "86 43 02 0100 220100"},
+		{"ResponseOnEvent reportActivatedEvents", &ResponseOnEventRequest{EventType: 0x04, EventTypeRecord: []byte{}}, "86 04"},
+		{"ResponseOnEvent startResponseOnEvent", &ResponseOnEventRequest{EventType: 0x05, EventWindowTime: 0x02, EventTypeRecord: []byte{}}, "86 05 02"},
+		{"ResponseOnEvent onComparisonOfValues", &ResponseOnEventRequest{EventType: 0x07, EventWindowTime: 0x02, EventTypeRecord: unhex("0100 01 00000010 00 0000"), ServiceToRespondToRecord: []byte{0x22, 0x01, 0x00}}, "86 07 02 0100010000001000 0000 220100"},
+		{"ResponseOnEvent response", &ResponseOnEventResponse{EventType: 0x03, NumberOfEvents: 0x00, Record: unhex("02 0100 220100")}, "c6 03 00 02 0100 220100"},
+		{"LinkControl verifyModeTransitionWithFixedParameter", &LinkControlRequest{LinkControlType: 0x01, Record: []byte{0x12}}, "87 01 12"},
+		{"LinkControl verifyModeTransitionWithSpecificParameter", &LinkControlRequest{LinkControlType: 0x02, Record: []byte{0x03, 0xD0, 0x90}}, "87 02 03d090"},
+		{"LinkControl transitionMode", &LinkControlRequest{LinkControlType: 0x03}, "87 03"},
+		{"LinkControl vehicle manufacturer specific", &LinkControlRequest{LinkControlType: 0x41, Record: []byte{0xAA}}, "87 41 aa"},
+		{"LinkControl response", &LinkControlResponse{LinkControlType: 0x03}, "c7 03"},
+
+		{"ReadDataByIdentifier", &ReadDataByIdentifierRequest{DataIdentifiers: []uint16{0xF190, 0x0100}}, "22 f190 0100"},
+		{"ReadDataByIdentifier response", &ReadDataByIdentifierResponse{Records: []DataRecord{{DataIdentifier: 0xF190, Data: []byte("VIN")}}}, "62 f190 56494e"},
+		{"ReadMemoryByAddress", &ReadMemoryByAddressRequest{AddressAndLengthFormatIdentifier: 0x24, MemoryAddress: 0x20001000, MemorySize: 0x0100}, "23 24 20001000 0100"},
+		{"ReadMemoryByAddress response", &ReadMemoryByAddressResponse{DataRecord: []byte{0xAA, 0xBB}}, "63 aabb"},
+		{"ReadScalingDataByIdentifier", &ReadScalingDataByIdentifierRequest{DataIdentifier: 0xF190}, "24 f190"},
+		{"ReadScalingDataByIdentifier response", &ReadScalingDataByIdentifierResponse{DataIdentifier: 0xF190, ScalingData: []byte{0x6F}}, "64 f190 6f"},
+		{"ReadDataByPeriodicIdentifier", &ReadDataByPeriodicIdentifierRequest{TransmissionMode: 0x01, PeriodicDataIdentifiers: []byte{0xE3, 0x24}}, "2a 01 e324"},
+		{"ReadDataByPeriodicIdentifier stopSending all", &ReadDataByPeriodicIdentifierRequest{TransmissionMode: 0x04, PeriodicDataIdentifiers: []byte{}}, "2a 04"},
+		{"ReadDataByPeriodicIdentifier response", &ReadDataByPeriodicIdentifierResponse{}, "6a"},
+		{"DynamicallyDefineDataIdentifier defineByIdentifier", &DynamicallyDefineDataIdentifierRequest{DefinitionType: DefineByIdentifier, DynamicallyDefinedDataIdentifier: 0xF301, Sources: []SourceDataIdentifier{{0x1234, 1, 2}, {0x5678, 3, 1}}}, "2c 01 f301 1234 01 02 5678 03 01"},
+		{"DynamicallyDefineDataIdentifier defineByMemoryAddress", &DynamicallyDefineDataIdentifierRequest{DefinitionType: DefineByMemoryAddress, DynamicallyDefinedDataIdentifier: 0xF302, AddressAndLengthFormatIdentifier: 0x14, MemorySources: []MemorySource{{0x20001000, 0x10}, {0x20002000, 0x04}}}, "2c 02 f302 14 20001000 10 20002000 04"},
+		{"DynamicallyDefineDataIdentifier clear", &DynamicallyDefineDataIdentifierRequest{DefinitionType: ClearDynamicallyDefinedDataIdentifier, DynamicallyDefinedDataIdentifier: 0xF301}, "2c 03 f301"},
+		{"DynamicallyDefineDataIdentifier clear all", &DynamicallyDefineDataIdentifierRequest{DefinitionType: ClearDynamicallyDefinedDataIdentifier}, "2c 03"},
+		{"DynamicallyDefineDataIdentifier response", &DynamicallyDefineDataIdentifierResponse{DefinitionType: DefineByIdentifier, DynamicallyDefinedDataIdentifier: 0xF301}, "6c 01 f301"},
+		{"DynamicallyDefineDataIdentifier response clear all", &DynamicallyDefineDataIdentifierResponse{DefinitionType: ClearDynamicallyDefinedDataIdentifier}, "6c 03"},
+		{"WriteDataByIdentifier", &WriteDataByIdentifierRequest{DataIdentifier: 0xF190, DataRecord: []byte{0x01, 0x02}}, "2e f190 0102"},
+		{"WriteDataByIdentifier response", &WriteDataByIdentifierResponse{DataIdentifier: 0xF190}, "6e f190"},
+		{"WriteMemoryByAddress", &WriteMemoryByAddressRequest{AddressAndLengthFormatIdentifier: 0x12, MemoryAddress: 0x2000, MemorySize: 2, DataRecord: []byte{0xAA, 0xBB}}, "3d 12 2000 02 aabb"},
+		{"WriteMemoryByAddress response", &WriteMemoryByAddressResponse{AddressAndLengthFormatIdentifier: 0x12, MemoryAddress: 0x2000, MemorySize: 2}, "7d 12 2000 02"},
+
+		{"ClearDiagnosticInformation", &ClearDiagnosticInformationRequest{GroupOfDTC: 0xFFFFFF}, "14 ffffff"},
+		{"ClearDiagnosticInformation memorySelection", &ClearDiagnosticInformationRequest{GroupOfDTC: 0x123456, MemorySelection: 0x01, HasMemorySelection: true}, "14 123456 01"},
+		{"ClearDiagnosticInformation response", &ClearDiagnosticInformationResponse{}, "54"},
+		{"ReadDTCInformation", &ReadDTCInformationRequest{ReportType: 0x02, Record: []byte{0x08}}, "19 02 08"},
+		{"ReadDTCInformation response", &ReadDTCInformationResponse{ReportType: 0x02, Record: unhex("ff 123456 08")}, "59 02 ff12345608"},
+
+		{"InputOutputControlByIdentifier", &InputOutputControlByIdentifierRequest{DataIdentifier: 0x0100, ControlOptionRecord: []byte{0x03, 0x01}}, "2f 0100 0301"},
+		{"InputOutputControlByIdentifier response", &InputOutputControlByIdentifierResponse{DataIdentifier: 0x0100, ControlStatusRecord: []byte{0x01}}, "6f 0100 01"},
+		{"RoutineControl", &RoutineControlRequest{RoutineControlType: StartRoutine, RoutineIdentifier: 0xFF00, ControlOptionRecord: []byte{0xAA}}, "31 01 ff00 aa"},
+		{"RoutineControl without options", &RoutineControlRequest{RoutineControlType: RequestRoutineResults, RoutineIdentifier: 0xFF00, ControlOptionRecord: []byte{}}, "31 03 ff00"},
+		{"RoutineControl response", &RoutineControlResponse{RoutineControlType: StartRoutine, RoutineIdentifier: 0xFF00, StatusRecord: []byte{0x00}}, "71 01 ff00 00"},
+
+		{"RequestDownload", &RequestDownloadRequest{DataFormatIdentifier: 0x00, AddressAndLengthFormatIdentifier: 0x44, MemoryAddress: 0x1000, MemorySize: 2}, "34 00 44 00001000 00000002"},
+		{"RequestDownload response", &RequestDownloadResponse{LengthFormatIdentifier: 0x20, MaxNumberOfBlockLength: 0x0402}, "74 20 0402"},
+		{"RequestUpload", &RequestUploadRequest{DataFormatIdentifier: 0x11, AddressAndLengthFormatIdentifier: 0x12, MemoryAddress: 0x2000, MemorySize: 0x10}, "35 11 12 2000 10"},
+		{"RequestUpload response", &RequestUploadResponse{LengthFormatIdentifier: 0x10, MaxNumberOfBlockLength: 0x82}, "75 10 82"},
+		{"TransferData", &TransferDataRequest{BlockSequenceCounter: 0x01, ParameterRecord: []byte{0xAA, 0xBB}}, "36 01 aabb"},
+		{"TransferData response", &TransferDataResponse{BlockSequenceCounter: 0x01, ParameterRecord: []byte{}}, "76 01"},
+		{"RequestTransferExit", &RequestTransferExitRequest{ParameterRecord: []byte{}}, "37"},
+		{"RequestTransferExit response", &RequestTransferExitResponse{ParameterRecord: []byte{0xCC}}, "77 cc"},
+	}
+	for _, tt := range tests {
+		msg := unhex(tt.msg)
+		if got, err := Marshal(tt.m); err != nil || !bytes.Equal(got, msg) {
+			t.Errorf("%s: Marshal = % X, %v, want % X", tt.name, got, err, msg)
+		}
+		got := newMessage(tt.m)
+		if err := Unmarshal(msg, got); err != nil || !reflect.DeepEqual(got, tt.m) {
+			t.Errorf("%s: Unmarshal = %+v, %v, want %+v", tt.name, got, err, tt.m)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Message
+		msg  string
+		nrc  NRC
+	}{
+		{"DiagnosticSessionControl empty", &DiagnosticSessionControlRequest{}, "10", IMLOIF},
+		{"DiagnosticSessionControl over-long", &DiagnosticSessionControlRequest{}, "10 03 00", IMLOIF},
+		{"DiagnosticSessionControl response truncated", &DiagnosticSessionControlResponse{}, "50 03 0032", IMLOIF},
+		{"ECUReset empty", &ECUResetRequest{}, "11", IMLOIF},
+		{"ECUReset over-long", &ECUResetRequest{}, "11 01 00", IMLOIF},
+		{"ECUReset response without powerDownTime", &ECUResetResponse{}, "51 04", IMLOIF},
+		{"ECUReset response over-long", &ECUResetResponse{}, "51 01 0a", IMLOIF},
+		{"SecurityAccess empty", &SecurityAccessRequest{}, "27", IMLOIF},
+		{"SecurityAccess sendKey without key", &SecurityAccessRequest{}, "27 02", IMLOIF},
+		{"SecurityAccess ISOSAEReserved 0x00", &SecurityAccessRequest{}, "27 00", SFNS},
+		{"SecurityAccess ISOSAEReserved 0x43", &SecurityAccessRequest{}, "27 43", SFNS},
+		{"SecurityAccess ISOSAEReserved 0x5E", &SecurityAccessRequest{}, "27 5e", SFNS},
+		{"SecurityAccess ISOSAEReserved 0x7F", &SecurityAccessRequest{}, "27 ff", SFNS},
+		{"SecurityAccess response empty", &SecurityAccessResponse{}, "67", IMLOIF},
+		{"CommunicationControl truncated", &CommunicationControlRequest{}, "28 03", IMLOIF},
+		{"CommunicationControl over-long", &CommunicationControlRequest{}, "28 03 01 00", IMLOIF},
+		{"CommunicationControl truncated nodeIdentificationNumber", &CommunicationControlRequest{}, "28 05 01 0a", IMLOIF},
+		{"Authentication empty", &AuthenticationRequest{}, "29", IMLOIF},
+		{"Authentication deAuthenticate over-long", &AuthenticationRequest{}, "29 00 00", IMLOIF},
+		{"Authentication truncated certificate", &AuthenticationRequest{}, "29 01 00 0004 aabb", IMLOIF},
+		{"Authentication without challenge", &AuthenticationRequest{}, "29 01 00 0001 aa", IMLOIF},
+		{"Authentication over-long certificate", &AuthenticationRequest{}, "29 01 00 0001 aa 0000 00", IMLOIF},
+		{"Authentication proofOfOwnership without ephemeral public key", &AuthenticationRequest{}, "29 03 0002 0102", IMLOIF},
+		{"Authentication ISOSAEReserved", &AuthenticationRequest{}, "29 09", SFNS},
+		{"Authentication ISOSAEReserved 0x7F", &AuthenticationRequest{}, "29 7f", SFNS},
+		{"Authentication response without returnParameter", &AuthenticationResponse{}, "69 00", IMLOIF},
+		{"Authentication response truncated challenge", &AuthenticationResponse{}, "69 01 11 0002 c1", IMLOIF},
+		{"TesterPresent empty", &TesterPresentRequest{}, "3e", IMLOIF},
+		{"TesterPresent over-long", &TesterPresentRequest{}, "3e 00 00", IMLOIF},
+		{"TesterPresent sub-function", &TesterPresentRequest{}, "3e 01", SFNS},
+		{"TesterPresent response over-long", &TesterPresentResponse{}, "7e 00 00", IMLOIF},
+		{"AccessTimingParameter empty", &AccessTimingParameterRequest{}, "83", IMLOIF},
+		{"SecuredDataTransmission empty", &SecuredDataTransmissionRequest{}, "84", IMLOIF},
+		{"ControlDTCSetting empty", &ControlDTCSettingRequest{}, "85", IMLOIF},
+		{"ControlDTCSetting response over-long", &ControlDTCSettingResponse{}, "c5 02 00", IMLOIF},
+		{"ResponseOnEvent empty", &ResponseOnEventRequest{}, "86", IMLOIF},
+		{"ResponseOnEvent without eventWindowTime", &ResponseOnEventRequest{}, "86 02", IMLOIF},
+		{"ResponseOnEvent without timer rate", &ResponseOnEventRequest{}, "86 02 02", IMLOIF},
+		{"ResponseOnEvent without service", &ResponseOnEventRequest{}, "86 02 02 03", IMLOIF},
+		{"ResponseOnEvent truncated DID", &ResponseOnEventRequest{}, "86 03 02 01", IMLOIF},
+		{"ResponseOnEvent truncated comparison", &ResponseOnEventRequest{}, "86 07 02 000000000000000000", IMLOIF},
+		{"ResponseOnEvent comparison without service", &ResponseOnEventRequest{}, "86 07 02 00000000000000000000", IMLOIF},
+		{"ResponseOnEvent reportActivatedEvents over-long", &ResponseOnEventRequest{}, "86 04 00", IMLOIF},
+		{"ResponseOnEvent stopResponseOnEvent over-long", &ResponseOnEventRequest{}, "86 00 02 00", IMLOIF},
+		{"ResponseOnEvent response truncated", &ResponseOnEventResponse{}, "c6 03", IMLOIF},
+		{"LinkControl empty", &LinkControlRequest{}, "87", IMLOIF},
+		{"LinkControl without mode identifier", &LinkControlRequest{}, "87 01", IMLOIF},
+		{"LinkControl over-long mode identifier", &LinkControlRequest{}, "87 01 12 00", IMLOIF},
+		{"LinkControl truncated linkRecord", &LinkControlRequest{}, "87 02 03d0", IMLOIF},
+		{"LinkControl over-long linkRecord", &LinkControlRequest{}, "87 02 03d09000", IMLOIF},
+		{"LinkControl transitionMode over-long", &LinkControlRequest{}, "87 03 00", IMLOIF},
+		{"LinkControl response empty", &LinkControlResponse{}, "c7", IMLOIF},
+
+		{"ReadDataByIdentifier empty", &ReadDataByIdentifierRequest{}, "22", IMLOIF},
+		{"ReadDataByIdentifier truncated", &ReadDataByIdentifierRequest{}, "22 f1", IMLOIF},
+		{"ReadDataByIdentifier odd", &ReadDataByIdentifierRequest{}, "22 f190 01", IMLOIF},
+		{"ReadDataByIdentifier response truncated", &ReadDataByIdentifierResponse{}, "62 f1", IMLOIF},
+		{"ReadMemoryByAddress empty", &ReadMemoryByAddressRequest{}, "23", IMLOIF},
+		{"ReadMemoryByAddress truncated", &ReadMemoryByAddressRequest{}, "23 24 2000", IMLOIF},
+		{"ReadMemoryByAddress over-long", &ReadMemoryByAddressRequest{}, "23 11 50 10 00", IMLOIF},
+		{"ReadMemoryByAddress zero address length", &ReadMemoryByAddressRequest{}, "23 10 50", ROOR},
+		{"ReadMemoryByAddress size length above 8", &ReadMemoryByAddressRequest{}, "23 91 50", ROOR},
+		{"ReadMemoryByAddress past last address", &ReadMemoryByAddressRequest{}, "23 11 f0 20", ROOR},
+		{"ReadScalingDataByIdentifier truncated", &ReadScalingDataByIdentifierRequest{}, "24 f1", IMLOIF},
+		{"ReadScalingDataByIdentifier over-long", &ReadScalingDataByIdentifierRequest{}, "24 f190 00", IMLOIF},
+		{"ReadDataByPeriodicIdentifier empty", &ReadDataByPeriodicIdentifierRequest{}, "2a", IMLOIF},
+		{"ReadDataByPeriodicIdentifier without identifiers", &ReadDataByPeriodicIdentifierRequest{}, "2a 01", IMLOIF},
+		{"ReadDataByPeriodicIdentifier transmissionMode 0x00", &ReadDataByPeriodicIdentifierRequest{}, "2a 00 e3", ROOR},
+		{"ReadDataByPeriodicIdentifier transmissionMode 0x05", &ReadDataByPeriodicIdentifierRequest{}, "2a 05 e3", ROOR},
+		{"ReadDataByPeriodicIdentifier response over-long", &ReadDataByPeriodicIdentifierResponse{}, "6a 00", IMLOIF},
+		{"DynamicallyDefineDataIdentifier empty", &DynamicallyDefineDataIdentifierRequest{}, "2c", IMLOIF},
+		{"DynamicallyDefineDataIdentifier without sources", &DynamicallyDefineDataIdentifierRequest{}, "2c 01 f301", IMLOIF},
+		{"DynamicallyDefineDataIdentifier truncated identifier", &DynamicallyDefineDataIdentifierRequest{}, "2c 01 f3", IMLOIF},
+		{"DynamicallyDefineDataIdentifier truncated source", &DynamicallyDefineDataIdentifierRequest{}, "2c 01 f301 1234 01", IMLOIF},
+		{"DynamicallyDefineDataIdentifier without format", &DynamicallyDefineDataIdentifierRequest{}, "2c 02 f302", IMLOIF},
+		{"DynamicallyDefineDataIdentifier truncated memory source", &DynamicallyDefineDataIdentifierRequest{}, "2c 02 f302 14 20001000", IMLOIF},
+		{"DynamicallyDefineDataIdentifier truncated second memory source", &DynamicallyDefineDataIdentifierRequest{}, "2c 02 f302 14 20001000 10 2000", IMLOIF},
+		{"DynamicallyDefineDataIdentifier zero size length", &DynamicallyDefineDataIdentifierRequest{}, "2c 02 f302 04 20001000", ROOR},
+		{"DynamicallyDefineDataIdentifier second source past last address", &DynamicallyDefineDataIdentifierRequest{}, "2c 02 f302 11 10 10 f0 20", ROOR},
+		{"DynamicallyDefineDataIdentifier clear truncated", &DynamicallyDefineDataIdentifierRequest{}, "2c 03 f3", IMLOIF},
+		{"DynamicallyDefineDataIdentifier clear over-long", &DynamicallyDefineDataIdentifierRequest{}, "2c 03 f301 00", IMLOIF},
+		{"DynamicallyDefineDataIdentifier ISOSAEReserved 0x00", &DynamicallyDefineDataIdentifierRequest{}, "2c 00 f301", SFNS},
+		{"DynamicallyDefineDataIdentifier ISOSAEReserved 0x04", &DynamicallyDefineDataIdentifierRequest{}, "2c 04 f301", SFNS},
+		{"DynamicallyDefineDataIdentifier response without identifier", &DynamicallyDefineDataIdentifierResponse{}, "6c 01", IMLOIF},
+		{"DynamicallyDefineDataIdentifier response over-long", &DynamicallyDefineDataIdentifierResponse{}, "6c 01 f301 00", IMLOIF},
+		{"WriteDataByIdentifier without dataRecord", &WriteDataByIdentifierRequest{}, "2e f190", IMLOIF},
+		{"WriteDataByIdentifier truncated", &WriteDataByIdentifierRequest{}, "2e f1", IMLOIF},
+		{"WriteDataByIdentifier response over-long", &WriteDataByIdentifierResponse{}, "6e f190 00", IMLOIF},
+		{"WriteMemoryByAddress short dataRecord", &WriteMemoryByAddressRequest{}, "3d 12 2000 02 aa", IMLOIF},
+		{"WriteMemoryByAddress long dataRecord", &WriteMemoryByAddressRequest{}, "3d 12 2000 02 aabbcc", IMLOIF},
+		{"WriteMemoryByAddress zero size", &WriteMemoryByAddressRequest{}, "3d 12 2000 00", IMLOIF},
+		{"WriteMemoryByAddress zero address length", &WriteMemoryByAddressRequest{}, "3d 10 20 aa", ROOR},
+		{"WriteMemoryByAddress response truncated", &WriteMemoryByAddressResponse{}, "7d 12 2000", IMLOIF},
+
+		{"ClearDiagnosticInformation truncated", &ClearDiagnosticInformationRequest{}, "14 ffff", IMLOIF},
+		{"ClearDiagnosticInformation over-long", &ClearDiagnosticInformationRequest{}, "14 ffffff 01 02", IMLOIF},
+		{"ClearDiagnosticInformation response over-long", &ClearDiagnosticInformationResponse{}, "54 00", IMLOIF},
+		{"ReadDTCInformation empty", &ReadDTCInformationRequest{}, "19", IMLOIF},
+		{"ReadDTCInformation response empty", &ReadDTCInformationResponse{}, "59", IMLOIF},
+
+		{"InputOutputControlByIdentifier without controlOptionRecord", &InputOutputControlByIdentifierRequest{}, "2f 0100", IMLOIF},
+		{"InputOutputControlByIdentifier response truncated", &InputOutputControlByIdentifierResponse{}, "6f 01", IMLOIF},
+		{"RoutineControl truncated", &RoutineControlRequest{}, "31 01 ff", IMLOIF},
+		{"RoutineControl ISOSAEReserved 0x00", &RoutineControlRequest{}, "31 00 ff00", SFNS},
+		{"RoutineControl ISOSAEReserved 0x04", &RoutineControlRequest{}, "31 04 ff00", SFNS},
+		{"RoutineControl response truncated", &RoutineControlResponse{}, "71 01 ff", IMLOIF},
+
+		{"RequestDownload truncated", &RequestDownloadRequest{}, "34 00 44 00001000", IMLOIF},
+		{"RequestDownload over-long", &RequestDownloadRequest{}, "34 00 11 50 10 00", IMLOIF},
+		{"RequestDownload zero format", &RequestDownloadRequest{}, "34 00 00", ROOR},
+		{"RequestDownload response zero length", &RequestDownloadResponse{}, "74 00", IMLOIF},
+		{"RequestDownload response length above 8", &RequestDownloadResponse{}, "74 90 000000000000000001", IMLOIF},
+		{"RequestDownload response truncated", &RequestDownloadResponse{}, "74 20 04", IMLOIF},
+		{"RequestDownload response over-long", &RequestDownloadResponse{}, "74 10 04 02", IMLOIF},
+		{"RequestUpload truncated", &RequestUploadRequest{}, "35 00", IMLOIF},
+		{"RequestUpload address length above 8", &RequestUploadRequest{}, "35 00 19", ROOR},
+		{"RequestUpload response empty", &RequestUploadResponse{}, "75", IMLOIF},
+		{"TransferData empty", &TransferDataRequest{}, "36", IMLOIF},
+		{"TransferData response empty", &TransferDataResponse{}, "76", IMLOIF},
+	}
+	for _, tt := range tests {
+		if err := Unmarshal(unhex(tt.msg), tt.m); nrcOf(err) != tt.nrc {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.nrc)
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Message
+		nrc  NRC
+	}{
+		{"ReadMemoryByAddress address longer than format", &ReadMemoryByAddressRequest{AddressAndLengthFormatIdentifier: 0x11, MemoryAddress: 0x1234, MemorySize: 1}, ROOR},
+		{"ReadMemoryByAddress zero format", &ReadMemoryByAddressRequest{MemoryAddress: 0x12, MemorySize: 1}, ROOR},
+		{"WriteMemoryByAddress past last address", &WriteMemoryByAddressRequest{AddressAndLengthFormatIdentifier: 0x11, MemoryAddress: 0xF0, MemorySize: 0x20, DataRecord: make([]byte, 0x20)}, ROOR},
+		{"WriteMemoryByAddress response size longer than format", &WriteMemoryByAddressResponse{AddressAndLengthFormatIdentifier: 0x12, MemoryAddress: 0x2000, MemorySize: 0x100}, ROOR},
+		{"DynamicallyDefineDataIdentifier memory source longer than format", &DynamicallyDefineDataIdentifierRequest{DefinitionType: DefineByMemoryAddress, DynamicallyDefinedDataIdentifier: 0xF302, AddressAndLengthFormatIdentifier: 0x11, MemorySources: []MemorySource{{0x10, 0x01}, {0x1234, 0x01}}}, ROOR},
+		{"ClearDiagnosticInformation groupOfDTC longer than three bytes", &ClearDiagnosticInformationRequest{GroupOfDTC: 0x1000000}, ROOR},
+		{"RequestDownload address longer than format", &RequestDownloadRequest{AddressAndLengthFormatIdentifier: 0x11, MemoryAddress: 0x100, MemorySize: 1}, ROOR},
+		{"RequestUpload zero format", &RequestUploadRequest{MemoryAddress: 0x10, MemorySize: 1}, ROOR},
+		{"RequestDownload response maxNumberOfBlockLength longer than format", &RequestDownloadResponse{LengthFormatIdentifier: 0x10, MaxNumberOfBlockLength: 0x0402}, ROOR},
+		{"RequestUpload response length above 8", &RequestUploadResponse{LengthFormatIdentifier: 0x90, MaxNumberOfBlockLength: 1}, ROOR},
+		{"Authentication certificate longer than 0xFFFF bytes", &AuthenticationRequest{AuthenticationTask: VerifyCertificateUnidirectional, Certificate: make([]byte, 0x10000)}, ROOR},
+		{"Authentication response challenge longer than 0xFFFF bytes", &AuthenticationResponse{AuthenticationTask: VerifyCertificateUnidirectional, Challenge: make([]byte, 0x10000)}, ROOR},
+	}
+	for _, tt := range tests {
+		if b, err := Marshal(tt.m); nrcOf(err) != tt.nrc {
+			t.Errorf("%s: Marshal = % X, %v, want %s", tt.name, b, err, tt.nrc)
+		}
+	}
+
+	// the shortest encoding is used without a lengthFormatIdentifier
+	if b, err := Marshal(&RequestDownloadResponse{MaxNumberOfBlockLength: 0x0402}); err != nil || !bytes.Equal(b, unhex("74 20 0402")) {
+		t.Errorf("RequestDownloadResponse without lengthFormatIdentifier = % X, %v", b, err)
+	}
+}
+
+func TestEventTypeRecordLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventType  byte
+		length     int
+		hasService bool
+	}{
+		{"stopResponseOnEvent", 0x00, 0, false},
+		{"onDTCStatusChange", 0x01, 1, true},
+		{"onTimerInterrupt", 0x02, 1, true},
+		{"onChangeOfDataIdentifier", 0x03, 2, true},
+		{"reportActivatedEvents", 0x04, 0, false},
+		{"startResponseOnEvent", 0x05, 0, false},
+		{"clearResponseOnEvent", 0x06, 0, false},
+		{"onComparisonOfValues", 0x07, 10, true},
+		{"storeEvent onChangeOfDataIdentifier", 0x43, 2, true},
+		{"suppressed onTimerInterrupt", 0x82, 1, true},
+		{"stored and suppressed onComparisonOfValues", 0xC7, 10, true},
+	}
+	for _, tt := range tests {
+		if length, hasService := eventTypeRecordLength(tt.eventType); length != tt.length || hasService != tt.hasService {
+			t.Errorf("%s: got %d, %v, want %d, %v", tt.name, length, hasService, tt.length, tt.hasService)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want Message
+		nrc  NRC
+	}{
+		{"DiagnosticSessionControl", "10 03", &DiagnosticSessionControlRequest{SessionType: ExtendedDiagnosticSession}, 0},
+		{"RoutineControl", "31 01 ff00", &RoutineControlRequest{RoutineControlType: StartRoutine, RoutineIdentifier: 0xFF00, ControlOptionRecord: []byte{}}, 0},
+		{"invalid", "27 00", nil, SFNS},
+		{"without codec", "38 01", nil, SNS},
+		{"response", "50 03", nil, SNS},
+	}
+	for _, tt := range tests {
+		got, err := ParseRequest(unhex(tt.msg))
+		if nrcOf(err) != tt.nrc || (tt.want != nil && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: got %+v, %v, want %+v, %s", tt.name, got, err, tt.want, tt.nrc)
+		}
+	}
+	if _, err := ParseRequest(nil); err != ErrEmptyMessage {
+		t.Errorf("empty request: got %v, want %v", err, ErrEmptyMessage)
+	}
+	if err := Unmarshal(unhex("11 01"), &DiagnosticSessionControlRequest{}); err == nil {
+		t.Error("Unmarshal of another service succeeded")
+	}
+	if err := Unmarshal(nil, &DiagnosticSessionControlRequest{}); err != ErrEmptyMessage {
+		t.Errorf("Unmarshal of nothing: got %v, want %v", err, ErrEmptyMessage)
+	}
+}
+
+func TestSecuredData(t *testing.T) {
+	s := SecuredData{
+		AdministrativeParameter:        SecuredRequestMessage | SecuredMessageSigned,
+		SignatureEncryptionCalculation: 0x01,
+		AntiReplayCounter:              0x0102,
+		Message:                        []byte{0x22, 0xF1, 0x90},
+		Signature:                      []byte{0xAA, 0xBB},
+	}
+	record := unhex("0011 01 0002 0102 22f190 aabb")
+	if got, err := s.MarshalRecord(); err != nil || !bytes.Equal(got, record) {
+		t.Errorf("MarshalRecord = % X, %v, want % X", got, err, record)
+	}
+	if !bytes.Equal(s.Header(), unhex("0011 01 0102")) {
+		t.Errorf("Header = % X", s.Header())
+	}
+	var got SecuredData
+	if err := got.UnmarshalRecord(record); err != nil || !reflect.DeepEqual(got, s) {
+		t.Errorf("UnmarshalRecord = %+v, %v, want %+v", got, err, s)
+	}
+
+	tests := []struct {
+		name   string
+		record string
+	}{
+		{"empty", ""},
+		{"truncated header", "0011 01 0002 01"},
+		{"without message", "0011 01 0000 0102"},
+		{"signature only", "0011 01 0002 0102 aabb"},
+		{"truncated signature", "0011 01 0004 0102 22 aabb"},
+	}
+	for _, tt := range tests {
+		if err := new(SecuredData).UnmarshalRecord(unhex(tt.record)); nrcOf(err) != IMLOIF {
+			t.Errorf("%s: got %v, want %s", tt.name, err, IMLOIF)
+		}
+	}
+	if _, err := (&SecuredData{Signature: make([]byte, 0x10000)}).MarshalRecord(); nrcOf(err) != ROOR {
+		t.Errorf("signature longer than 0xFFFF bytes: got %v, want %s", err, ROOR)
+	}
+}
@@ -26,7 +26,7 @@ func WriteMemory(memory *[]byte, input []byte, offset int) error {
 		return errors.New("input larger than destination")
 	}
 	//check if input extends beyond end of memory
-	if len(input)+offset > len((*memory)) {
+	if offset < 0 || len(input)+offset > len((*memory)) {
 		return errors.New("input does not fit within destination offset")
 	}
 	//write input to memory offset
@@ -40,7 +40,7 @@ func WriteMemory(memory *[]byte, input []byte, offset int) error {
 //ReadMemory: returns a section of memory by offset and size
 func ReadMemory(memory []byte, offset int, size int) ([]byte, error) {
 	//check if the offset or size are beyond the target
-	if offset > len(memory) || offset+size > len(memory) {
+	if offset < 0 || size < 0 || offset > len(memory) || offset+size > len(memory) {
 		return nil, errors.New("offset extends beyond memory bounds")
 	}
 	if size > len(memory) {
@@ -104,6 +104,9 @@ func BytesToUInt(input []byte) (uint, error) {
 }
 
 //ParseAddressAndLengthFormat: parses an addressAndLengthFormatIdentifier
+//
+// Deprecated: use uds.ParseAddressAndLength, which also validates the
+// address and size.
 func ParseAddressAndLengthFormat(formatIdentfier byte) (addrSize int, mSize int) {
 	addressLength := int(formatIdentfier & 0xf)
 	sizeLength := int(formatIdentfier&0xf0) >> 4